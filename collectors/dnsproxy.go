@@ -0,0 +1,461 @@
+package collectors
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/subprocessors"
+	"github.com/dmachard/go-logger"
+	"github.com/miekg/dns"
+)
+
+// DnsProxy is a forwarding proxy, the queries received on udp and tcp are sent to the upstream
+// resolver and both the queries and the replies are decoded by the dns processor
+type DnsProxy struct {
+	dnsutils.ReadyState
+	sync.Mutex
+	done      chan bool
+	udpConn   net.PacketConn
+	tcpListen net.Listener
+	conns     map[net.Conn]bool
+	stopped   bool
+	wg        sync.WaitGroup
+	upstream  string
+	timeout   time.Duration
+	pending   chan bool
+	identity  string
+	loggers   []dnsutils.Worker
+	config    *dnsutils.Config
+	logger    *logger.Logger
+	name      string
+}
+
+func NewDnsProxy(loggers []dnsutils.Worker, config *dnsutils.Config, logger *logger.Logger, name string) *DnsProxy {
+	logger.Info("collector dns proxy - enabled")
+	s := &DnsProxy{
+		done:    make(chan bool),
+		conns:   make(map[net.Conn]bool),
+		config:  config,
+		loggers: loggers,
+		logger:  logger,
+		name:    name,
+	}
+	s.ReadConfig()
+	return s
+}
+
+func (c *DnsProxy) ReadConfig() {
+	c.upstream = net.JoinHostPort(c.config.Collectors.DnsProxy.UpstreamAddress, strconv.Itoa(c.config.Collectors.DnsProxy.UpstreamPort))
+	c.timeout = time.Duration(c.config.Collectors.DnsProxy.Timeout) * time.Second
+	c.pending = make(chan bool, c.config.Collectors.DnsProxy.UdpMaxPending)
+	c.identity = c.config.Subprocessors.ServerId
+}
+
+func (c *DnsProxy) LogInfo(msg string, v ...interface{}) {
+	c.logger.Info("collector dns proxy - "+msg, v...)
+}
+
+func (c *DnsProxy) LogError(msg string, v ...interface{}) {
+	c.logger.Error("collector dns proxy - "+msg, v...)
+}
+
+func (c *DnsProxy) Loggers() []chan dnsutils.DnsMessage {
+	channels := []chan dnsutils.DnsMessage{}
+	for _, p := range c.loggers {
+		channels = append(channels, p.Channel())
+	}
+	return channels
+}
+
+func (c *DnsProxy) Channel() chan dnsutils.DnsMessage {
+	return nil
+}
+
+// Release closes the listeners and the connections after a failure of run
+func (c *DnsProxy) Release() {
+	c.Close()
+}
+
+func (c *DnsProxy) Stop() {
+	c.LogInfo("stopping...")
+
+	c.Lock()
+	c.stopped = true
+	c.Unlock()
+	c.Close()
+
+	// read done channel and block until run is terminated
+	<-c.done
+	close(c.done)
+}
+
+// Close stops listening, then closes the tcp connections
+func (c *DnsProxy) Close() {
+	if c.udpConn != nil {
+		c.udpConn.Close()
+	}
+	if c.tcpListen != nil {
+		c.tcpListen.Close()
+	}
+
+	c.Lock()
+	for conn := range c.conns {
+		conn.Close()
+	}
+	c.Unlock()
+}
+
+func (c *DnsProxy) isStopped() bool {
+	c.Lock()
+	defer c.Unlock()
+	return c.stopped
+}
+
+// retryDelay returns the delay before to read or accept again after a temporary error, doubled
+// on each consecutive error up to one second, false is returned if the error is not temporary
+func retryDelay(err error, delay time.Duration) (time.Duration, bool) {
+	if ne, ok := err.(net.Error); !ok || !ne.Temporary() {
+		return 0, false
+	}
+	if delay == 0 {
+		delay = 5 * time.Millisecond
+	} else {
+		delay *= 2
+	}
+	if delay > time.Second {
+		delay = time.Second
+	}
+	return delay, true
+}
+
+func (c *DnsProxy) Listen() error {
+	addrlisten := net.JoinHostPort(c.config.Collectors.DnsProxy.ListenIP, strconv.Itoa(c.config.Collectors.DnsProxy.ListenPort))
+
+	udpConn, err := net.ListenPacket("udp", addrlisten)
+	if err != nil {
+		return err
+	}
+	tcpListen, err := net.Listen("tcp", addrlisten)
+	if err != nil {
+		udpConn.Close()
+		return err
+	}
+
+	c.LogInfo("is listening on %s, forwarding to %s", addrlisten, c.upstream)
+	c.udpConn = udpConn
+	c.tcpListen = tcpListen
+	return nil
+}
+
+// NewMessage prepares a dns message for the dns processor, the addresses of the replies
+// are swapped by the processor
+func (c *DnsProxy) NewMessage(payload []byte, protocol string, from net.Addr, to net.Addr, ts time.Time) dnsutils.DnsMessage {
+	dm := dnsutils.DnsMessage{}
+	dm.Init()
+
+	dm.DnsTap.Identity = c.identity
+	dm.DnsTap.TimeSec = int(ts.Unix())
+	dm.DnsTap.TimeNsec = int(ts.UnixNano() - ts.Unix()*1e9)
+
+	dm.NetworkInfo.Protocol = protocol
+	dm.NetworkInfo.QueryIp, dm.NetworkInfo.QueryPort, _ = net.SplitHostPort(from.String())
+	dm.NetworkInfo.ResponseIp, dm.NetworkInfo.ResponsePort, _ = net.SplitHostPort(to.String())
+	dm.NetworkInfo.Family = "INET"
+	if ip := net.ParseIP(dm.NetworkInfo.QueryIp); ip != nil && ip.To4() == nil {
+		dm.NetworkInfo.Family = "INET6"
+	}
+
+	dm.DNS.Payload = payload
+	dm.DNS.Length = len(payload)
+	return dm
+}
+
+// readTcpMessage reads a dns message prefixed by its length
+func readTcpMessage(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeTcpMessage writes a dns message prefixed by its length
+func writeTcpMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ExchangeUdp sends the query to the upstream resolver and returns the reply
+func (c *DnsProxy) ExchangeUdp(query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("udp", c.upstream, c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// servfail returns the SERVFAIL reply sent to the client when the upstream resolver fails,
+// nil is returned if the query is too short to be answered
+func servfail(query []byte) []byte {
+	req := new(dns.Msg)
+	if err := req.Unpack(query); err == nil {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeServerFailure)
+		if reply, err := m.Pack(); err == nil {
+			return reply
+		}
+	}
+
+	// malformed query, only the header is kept with the same id
+	if len(query) < 12 {
+		return nil
+	}
+	reply := make([]byte, 12)
+	copy(reply, query[:4])
+	reply[2] = reply[2]&0x79 | 0x80
+	reply[3] = dns.RcodeServerFailure
+	return reply
+}
+
+func (c *DnsProxy) ForwardUdp(messages chan dnsutils.DnsMessage, query []byte, client net.Addr) {
+	start := time.Now()
+	messages <- c.NewMessage(query, "UDP", client, c.udpConn.LocalAddr(), start)
+
+	reply, err := c.ExchangeUdp(query)
+	if err != nil {
+		c.LogError("%s - upstream error: %s", client, err)
+		if reply = servfail(query); reply == nil {
+			return
+		}
+	}
+	end := time.Now()
+
+	if _, err := c.udpConn.WriteTo(reply, client); err != nil {
+		c.LogError("%s - write error: %s", client, err)
+	}
+
+	dm := c.NewMessage(reply, "UDP", c.udpConn.LocalAddr(), client, end)
+	dm.DnsTap.Latency = end.Sub(start).Seconds()
+	messages <- dm
+}
+
+// ServeUdp forwards the queries until the collector is stopped, the error is returned
+// if the socket can't be read anymore
+func (c *DnsProxy) ServeUdp(messages chan dnsutils.DnsMessage) error {
+	buf := make([]byte, 65535)
+	var delay time.Duration
+	for {
+		n, client, err := c.udpConn.ReadFrom(buf)
+		if err != nil {
+			if c.isStopped() {
+				return nil
+			}
+			var retry bool
+			if delay, retry = retryDelay(err, delay); !retry {
+				return err
+			}
+			c.LogError("udp read error: %s, retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		// the queries are forwarded in parallel, up to the maximum of pending queries
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		c.pending <- true
+		c.wg.Add(1)
+		go func() {
+			defer func() {
+				<-c.pending
+				c.wg.Done()
+			}()
+			c.ForwardUdp(messages, query, client)
+		}()
+	}
+}
+
+// ExchangeTcp sends the query on the upstream connection, dialed if nil, and returns the reply,
+// the upstream connection is closed on error
+func (c *DnsProxy) ExchangeTcp(upstream net.Conn, query []byte) (net.Conn, []byte, error) {
+	if upstream == nil {
+		var err error
+		upstream, err = net.DialTimeout("tcp", c.upstream, c.timeout)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	upstream.SetDeadline(time.Now().Add(c.timeout))
+	if err := writeTcpMessage(upstream, query); err != nil {
+		upstream.Close()
+		return nil, nil, err
+	}
+	reply, err := readTcpMessage(upstream)
+	if err != nil {
+		upstream.Close()
+		return nil, nil, err
+	}
+	return upstream, reply, nil
+}
+
+// HandleTcpConn forwards the queries of the client one by one on a dedicated upstream connection
+func (c *DnsProxy) HandleTcpConn(messages chan dnsutils.DnsMessage, conn net.Conn) {
+	// close connection on function exit
+	defer conn.Close()
+
+	var upstream net.Conn
+	defer func() {
+		if upstream != nil {
+			upstream.Close()
+		}
+	}()
+
+	peer := conn.RemoteAddr()
+	for {
+		query, err := readTcpMessage(conn)
+		if err != nil {
+			return
+		}
+		start := time.Now()
+		messages <- c.NewMessage(query, "TCP", peer, conn.LocalAddr(), start)
+
+		// on error, the client gets a SERVFAIL reply and the next query is sent on a new connection
+		var reply []byte
+		upstream, reply, err = c.ExchangeTcp(upstream, query)
+		if err != nil {
+			c.LogError("%s - upstream error: %s", peer, err)
+			if reply = servfail(query); reply == nil {
+				return
+			}
+		}
+		end := time.Now()
+
+		if err := writeTcpMessage(conn, reply); err != nil {
+			c.LogError("%s - write error: %s", peer, err)
+			return
+		}
+
+		dm := c.NewMessage(reply, "TCP", conn.LocalAddr(), peer, end)
+		dm.DnsTap.Latency = end.Sub(start).Seconds()
+		messages <- dm
+	}
+}
+
+// ServeTcp accepts the connections until the collector is stopped, the error is returned
+// if the listener can't be used anymore
+func (c *DnsProxy) ServeTcp(messages chan dnsutils.DnsMessage) error {
+	var delay time.Duration
+	for {
+		conn, err := c.tcpListen.Accept()
+		if err != nil {
+			if c.isStopped() {
+				return nil
+			}
+			var retry bool
+			if delay, retry = retryDelay(err, delay); !retry {
+				return err
+			}
+			c.LogError("tcp accept error: %s, retrying in %v", err, delay)
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		c.Lock()
+		if c.stopped {
+			c.Unlock()
+			conn.Close()
+			continue
+		}
+		c.conns[conn] = true
+		c.Unlock()
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.HandleTcpConn(messages, conn)
+
+			c.Lock()
+			delete(c.conns, conn)
+			c.Unlock()
+		}()
+	}
+}
+
+func (c *DnsProxy) Run() {
+	c.LogInfo("starting collector...")
+	if c.udpConn == nil {
+		if err := c.Listen(); err != nil {
+			panic(fmt.Sprintf("listening failed: %v", err))
+		}
+	}
+
+	// ready once listening, the upstream resolver is not checked, its failures are
+	// answered with SERVFAIL replies
+	c.SetReady(true)
+
+	dns_subprocessor := subprocessors.NewDnsProcessor(c.config, c.logger)
+	dns_subprocessor.SetCollector(c.name)
+	go dns_subprocessor.Run(c.Loggers())
+
+	// serve until the collector is stopped, on error the other transport is closed too
+	errs := make(chan error, 2)
+	var serve sync.WaitGroup
+	serve.Add(2)
+	go func() {
+		defer serve.Done()
+		if err := c.ServeUdp(dns_subprocessor.GetChannel()); err != nil {
+			errs <- fmt.Errorf("udp: %v", err)
+			c.Close()
+		}
+	}()
+	go func() {
+		defer serve.Done()
+		if err := c.ServeTcp(dns_subprocessor.GetChannel()); err != nil {
+			errs <- fmt.Errorf("tcp: %v", err)
+			c.Close()
+		}
+	}()
+	serve.Wait()
+
+	// wait the pending queries before to stop the dns processor
+	c.wg.Wait()
+	dns_subprocessor.Stop()
+
+	// the collector is restarted by the supervisor
+	select {
+	case err := <-errs:
+		c.SetReady(false)
+		panic(fmt.Sprintf("serve error: %v", err))
+	default:
+	}
+
+	c.SetReady(false)
+	c.LogInfo("run terminated")
+	c.done <- true
+}
@@ -0,0 +1,339 @@
+package collectors
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/loggers"
+	"github.com/dmachard/go-dnscollector/subprocessors"
+	"github.com/dmachard/go-logger"
+)
+
+// fakeResolver replies to the udp and tcp queries with the same message and the QR flag set
+func fakeResolver(t *testing.T) (int, func()) {
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("fake resolver error: %s", err)
+	}
+	port := udpConn.LocalAddr().(*net.UDPAddr).Port
+	tcpListen, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+	if err != nil {
+		t.Fatalf("fake resolver error: %s", err)
+	}
+
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := udpConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			buf[2] |= 0x80
+			udpConn.WriteTo(buf[:n], addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcpListen.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					msg, err := readTcpMessage(conn)
+					if err != nil {
+						return
+					}
+					msg[2] |= 0x80
+					writeTcpMessage(conn, msg)
+				}
+			}()
+		}
+	}()
+
+	return port, func() {
+		udpConn.Close()
+		tcpListen.Close()
+	}
+}
+
+func TestDnsProxyRun(t *testing.T) {
+	upstreamPort, stop := fakeResolver(t)
+	defer stop()
+
+	g := loggers.NewFakeLogger()
+	config := dnsutils.GetFakeConfig()
+	config.Collectors.DnsProxy.ListenIP = "127.0.0.1"
+	config.Collectors.DnsProxy.UpstreamPort = upstreamPort
+
+	c := NewDnsProxy([]dnsutils.Worker{g}, config, logger.New(false), "dns-proxy")
+	if err := c.Listen(); err != nil {
+		log.Fatal("collector dns proxy listening error: ", err)
+	}
+	go c.Run()
+	defer c.Stop()
+
+	dnsquery, err := subprocessors.GetFakeDns()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+
+	address := "127.0.0.1:" + strconv.Itoa(config.Collectors.DnsProxy.ListenPort)
+	for _, transport := range []string{"udp", "tcp"} {
+		conn, err := net.Dial(transport, address)
+		if err != nil {
+			t.Fatalf("could not connect to the proxy: %s", err)
+		}
+
+		// send the query and read the reply of the upstream resolver
+		var reply []byte
+		if transport == "udp" {
+			conn.Write(dnsquery)
+			reply = make([]byte, 512)
+			n, _ := conn.Read(reply)
+			reply = reply[:n]
+		} else {
+			writeTcpMessage(conn, dnsquery)
+			reply, _ = readTcpMessage(conn)
+		}
+		conn.Close()
+		if len(reply) != len(dnsquery) || reply[2]&0x80 == 0 {
+			t.Fatalf("%s - invalid reply: %v", transport, reply)
+		}
+
+		// the query and the reply are logged
+		for _, operation := range []string{"CLIENT_QUERY", "CLIENT_RESPONSE"} {
+			msg := <-g.Channel()
+			if msg.DnsTap.Operation != operation {
+				t.Errorf("%s - want %s, got %s", transport, operation, msg.DnsTap.Operation)
+			}
+			if msg.NetworkInfo.QueryIp != "127.0.0.1" {
+				t.Errorf("%s - invalid query ip: %s", transport, msg.NetworkInfo.QueryIp)
+			}
+			if operation == "CLIENT_RESPONSE" && msg.DnsTap.Latency <= 0 {
+				t.Errorf("%s - latency not computed", transport)
+			}
+		}
+	}
+}
+
+func TestDnsProxyUdpMaxPending(t *testing.T) {
+	upstreamPort, stop := fakeResolver(t)
+	defer stop()
+
+	g := loggers.NewFakeLogger()
+	config := dnsutils.GetFakeConfig()
+	config.Collectors.DnsProxy.ListenIP = "127.0.0.1"
+	config.Collectors.DnsProxy.UpstreamPort = upstreamPort
+	config.Collectors.DnsProxy.UdpMaxPending = 1
+
+	c := NewDnsProxy([]dnsutils.Worker{g}, config, logger.New(false), "dns-proxy")
+	if err := c.Listen(); err != nil {
+		log.Fatal("collector dns proxy listening error: ", err)
+	}
+	go c.Run()
+	defer c.Stop()
+
+	dnsquery, err := subprocessors.GetFakeDns()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+
+	conn, err := net.Dial("udp", "127.0.0.1:"+strconv.Itoa(config.Collectors.DnsProxy.ListenPort))
+	if err != nil {
+		t.Fatalf("could not connect to the proxy: %s", err)
+	}
+	defer conn.Close()
+
+	// the queries over the limit wait and are forwarded one by one
+	for i := 0; i < 3; i++ {
+		conn.Write(dnsquery)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 3; i++ {
+		reply := make([]byte, 512)
+		if _, err := conn.Read(reply); err != nil {
+			t.Fatalf("reply %d not received: %s", i, err)
+		}
+	}
+	for i := 0; i < 6; i++ {
+		<-g.Channel()
+	}
+}
+
+func TestDnsProxyServeError(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+	config.Collectors.DnsProxy.ListenIP = "127.0.0.1"
+
+	c := NewDnsProxy([]dnsutils.Worker{loggers.NewFakeLogger()}, config, logger.New(false), "dns-proxy")
+	if err := c.Listen(); err != nil {
+		log.Fatal("collector dns proxy listening error: ", err)
+	}
+
+	failure := make(chan interface{})
+	go func() {
+		defer func() { failure <- recover() }()
+		c.Run()
+	}()
+
+	// the socket is closed without stopping the collector, run fails to be restarted
+	c.udpConn.Close()
+	select {
+	case r := <-failure:
+		if r == nil {
+			t.Errorf("run should fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("run not terminated")
+	}
+}
+
+func TestDnsProxySupervisorRestart(t *testing.T) {
+	upstreamPort, stop := fakeResolver(t)
+	defer stop()
+
+	g := loggers.NewFakeLogger()
+	config := dnsutils.GetFakeConfig()
+	config.Collectors.DnsProxy.ListenIP = "127.0.0.1"
+	config.Collectors.DnsProxy.UpstreamPort = upstreamPort
+
+	c := NewDnsProxy([]dnsutils.Worker{g}, config, logger.New(false), "dns-proxy-restart")
+	if err := c.Listen(); err != nil {
+		log.Fatal("collector dns proxy listening error: ", err)
+	}
+	factory := func() (dnsutils.Worker, error) {
+		return NewDnsProxy([]dnsutils.Worker{g}, config, logger.New(false), "dns-proxy-restart"), nil
+	}
+	o := dnsutils.NewSupervisor("dns-proxy-restart", c, factory, config, logger.New(false))
+	go o.Run()
+	defer o.Stop()
+
+	// the failed collector is replaced by a new one listening on the same port
+	c.udpConn.Close()
+	var health dnsutils.WorkerHealth
+	for i := 0; i < 50; i++ {
+		if health, _ = dnsutils.Health.Get("dns-proxy-restart"); health.Restarts == 1 && health.State == dnsutils.WorkerRunning {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if health.Restarts != 1 || health.State != dnsutils.WorkerRunning {
+		t.Fatalf("collector not restarted: %+v", health)
+	}
+
+	dnsquery, err := subprocessors.GetFakeDns()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+	var reply []byte
+	for i := 0; i < 50 && len(reply) == 0; i++ {
+		conn, err := net.Dial("tcp", "127.0.0.1:"+strconv.Itoa(config.Collectors.DnsProxy.ListenPort))
+		if err != nil {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		writeTcpMessage(conn, dnsquery)
+		reply, _ = readTcpMessage(conn)
+		conn.Close()
+	}
+	if len(reply) != len(dnsquery) || reply[2]&0x80 == 0 {
+		t.Errorf("invalid reply: %v", reply)
+	}
+}
+
+func TestDnsProxyRetryDelay(t *testing.T) {
+	temporary := &net.OpError{Op: "accept", Err: syscall.EMFILE}
+	delay, retry := retryDelay(temporary, 0)
+	if !retry || delay != 5*time.Millisecond {
+		t.Errorf("temporary error should be retried: %v %v", retry, delay)
+	}
+	if delay, _ = retryDelay(temporary, 800*time.Millisecond); delay != time.Second {
+		t.Errorf("delay should be limited to one second: %v", delay)
+	}
+	if _, retry = retryDelay(net.ErrClosed, 0); retry {
+		t.Errorf("closed listener should not be retried")
+	}
+}
+
+func TestDnsProxyServfail(t *testing.T) {
+	// upstream resolver not reachable
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstreamPort := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	g := loggers.NewFakeLogger()
+	config := dnsutils.GetFakeConfig()
+	config.Collectors.DnsProxy.ListenIP = "127.0.0.1"
+	config.Collectors.DnsProxy.UpstreamPort = upstreamPort
+	config.Collectors.DnsProxy.Timeout = 1
+
+	c := NewDnsProxy([]dnsutils.Worker{g}, config, logger.New(false), "dns-proxy")
+	if err := c.Listen(); err != nil {
+		log.Fatal("collector dns proxy listening error: ", err)
+	}
+	go c.Run()
+	defer c.Stop()
+
+	dnsquery, err := subprocessors.GetFakeDns()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+
+	address := "127.0.0.1:" + strconv.Itoa(config.Collectors.DnsProxy.ListenPort)
+	for _, transport := range []string{"udp", "tcp"} {
+		conn, err := net.Dial(transport, address)
+		if err != nil {
+			t.Fatalf("could not connect to the proxy: %s", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		// the client gets a SERVFAIL reply with the id of the query
+		var reply []byte
+		if transport == "udp" {
+			conn.Write(dnsquery)
+			reply = make([]byte, 512)
+			n, _ := conn.Read(reply)
+			reply = reply[:n]
+		} else {
+			writeTcpMessage(conn, dnsquery)
+			reply, _ = readTcpMessage(conn)
+		}
+		conn.Close()
+		if len(reply) < 12 || reply[0] != dnsquery[0] || reply[1] != dnsquery[1] || reply[2]&0x80 == 0 || reply[3]&0x0f != 2 {
+			t.Fatalf("%s - invalid servfail reply: %v", transport, reply)
+		}
+
+		// the failure is logged as a reply
+		for _, operation := range []string{"CLIENT_QUERY", "CLIENT_RESPONSE"} {
+			msg := <-g.Channel()
+			if msg.DnsTap.Operation != operation {
+				t.Errorf("%s - want %s, got %s", transport, operation, msg.DnsTap.Operation)
+			}
+			if operation == "CLIENT_RESPONSE" && msg.DNS.Rcode != "SERVFAIL" {
+				t.Errorf("%s - want SERVFAIL, got %s", transport, msg.DNS.Rcode)
+			}
+		}
+	}
+}
+
+func TestDnsProxyServfailHeader(t *testing.T) {
+	// malformed query, only the header is answered
+	query := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0, 0xff}
+	reply := servfail(query)
+	want := []byte{0x12, 0x34, 0x81, 0x02, 0, 0, 0, 0, 0, 0, 0, 0}
+	if string(reply) != string(want) {
+		t.Errorf("invalid servfail reply: %v", reply)
+	}
+	if servfail(query[:4]) != nil {
+		t.Errorf("no reply expected for a truncated header")
+	}
+}
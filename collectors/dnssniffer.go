@@ -2,10 +2,14 @@ package collectors
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
@@ -13,6 +17,7 @@ import (
 	"github.com/dmachard/go-logger"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
 	"golang.org/x/net/bpf"
 	"golang.org/x/sys/unix"
 )
@@ -22,61 +27,6 @@ func Htons(v uint16) int {
 	return int((v << 8) | (v >> 8))
 }
 
-func GetBpfFilter(port int) []bpf.Instruction {
-	// bpf filter: (ip  or ip6 ) and (udp or tcp) and port 53
-	// fragmented packets are ignored
-	var filter = []bpf.Instruction{
-		// Load eth.type (2 bytes at offset 12) and push-it in register A
-		bpf.LoadAbsolute{Off: 12, Size: 2},
-		// if eth.type == IPv4 continue with the next instruction
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0800, SkipTrue: 0, SkipFalse: 10},
-		// Load ip.proto (1 byte at offset 23) and push-it in register A
-		bpf.LoadAbsolute{Off: 23, Size: 1},
-		// ip.proto == UDP ?
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x11, SkipTrue: 1, SkipFalse: 0},
-		// ip.proto == TCP ?
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x6, SkipTrue: 0, SkipFalse: 16},
-		// load flags and fragment offset (2 bytes at offset 20) to ignore fragmented packet
-		bpf.LoadAbsolute{Off: 20, Size: 2},
-		// Only look at the last 13 bits of the data saved in regiter A
-		//  0x1fff == 0001 1111 1111 1111 (fragment offset)
-		// If any of the data in fragment offset is true, ignore the packet
-		bpf.JumpIf{Cond: bpf.JumpBitsSet, Val: 0x1fff, SkipTrue: 14, SkipFalse: 0},
-		// Load ip.length
-		// Register X = ip header len * 4
-		bpf.LoadMemShift{Off: 14},
-		// Load source port in tcp or udp (2 bytes at offset x+14)
-		bpf.LoadIndirect{Off: 14, Size: 2},
-		// source port equal to 53 ?
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(port), SkipTrue: 10, SkipFalse: 0},
-		// Load estination port in tcp or udp  (2 bytes at offset x+16)
-		bpf.LoadIndirect{Off: 16, Size: 2},
-		// destination port equal to 53 ?
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(port), SkipTrue: 8, SkipFalse: 9},
-		// if eth.type == IPv6 continue with the next instruction
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x86dd, SkipTrue: 0, SkipFalse: 8},
-		// Load ipv6.nxt (2 bytes at offset 12) and push-it in register A
-		bpf.LoadAbsolute{Off: 20, Size: 1},
-		// ip.proto == UDP ?
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x11, SkipTrue: 1, SkipFalse: 0},
-		// ip.proto == TCP ?
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x6, SkipTrue: 0, SkipFalse: 5},
-		// Load source port tcp or udp (2 bytes at offset 54)
-		bpf.LoadAbsolute{Off: 54, Size: 2},
-		// source port equal to 53 ?
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(port), SkipTrue: 2, SkipFalse: 0},
-		// Load destination port tcp or udp (2 bytes at offset 56)
-		bpf.LoadAbsolute{Off: 56, Size: 2},
-		// destination port equal to 53 ?
-		bpf.JumpIf{Cond: bpf.JumpEqual, Val: uint32(port), SkipTrue: 0, SkipFalse: 1},
-		// Keep the packet and send up to 65k of the packet to userspace
-		bpf.RetConstant{Val: 0xFFFF},
-		// Ignore packet
-		bpf.RetConstant{Val: 0},
-	}
-	return filter
-}
-
 func ApplyBpfFilter(filter []bpf.Instruction, fd int) (err error) {
 	var assembled []bpf.RawInstruction
 	if assembled, err = bpf.Assemble(filter); err != nil {
@@ -95,21 +45,39 @@ func RemoveBpfFilter(fd int) (err error) {
 	return syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_DETACH_FILTER, 0)
 }
 
+// the fanout group ids must be unique in the system, the sniffers don't share their sockets
+var fanoutGroups uint32
+
 type DnsSniffer struct {
+	dnsutils.ReadyState
 	done           chan bool
 	exit           chan bool
-	fd             int
+	fds            []int
+	rings          []*tpacketRing
+	fanoutGroup    int
 	port           int
 	device         string
+	linkType       string
+	expression     string
+	filter         []bpf.Instruction
+	vm             *bpf.VM
 	capturequeries bool
 	capturereplies bool
 	identity       string
+	flowTimeout    time.Duration
+	defragTimeout  time.Duration
+	decodeErrors   *dnsutils.TelemetryValue
+	mu             sync.Mutex
+	assembler      *tcpassembly.Assembler
+	defragmenter   *ipDefragmenter
+	processor      chan dnsutils.DnsMessage
 	loggers        []dnsutils.Worker
 	config         *dnsutils.Config
 	logger         *logger.Logger
+	name           string
 }
 
-func NewDnsSniffer(loggers []dnsutils.Worker, config *dnsutils.Config, logger *logger.Logger) *DnsSniffer {
+func NewDnsSniffer(loggers []dnsutils.Worker, config *dnsutils.Config, logger *logger.Logger, name string) *DnsSniffer {
 	logger.Info("collector dns sniffer - enabled")
 	s := &DnsSniffer{
 		done:    make(chan bool),
@@ -117,6 +85,7 @@ func NewDnsSniffer(loggers []dnsutils.Worker, config *dnsutils.Config, logger *l
 		config:  config,
 		loggers: loggers,
 		logger:  logger,
+		name:    name,
 	}
 	s.ReadConfig()
 	return s
@@ -144,6 +113,20 @@ func (c *DnsSniffer) ReadConfig() {
 	c.capturequeries = c.config.Collectors.DnsSniffer.CaptureDnsQueries
 	c.capturereplies = c.config.Collectors.DnsSniffer.CaptureDnsReplies
 	c.device = c.config.Collectors.DnsSniffer.Device
+	c.linkType = c.config.Collectors.DnsSniffer.LinkType
+
+	// the filter expression replaces the port filter
+	c.expression = c.config.Collectors.DnsSniffer.BpfFilter
+	if len(c.expression) == 0 {
+		c.expression = fmt.Sprintf("port %d", c.port)
+		if len(c.config.Collectors.DnsSniffer.TlsKeyLogFile) > 0 {
+			// the udp packets of quic are not captured
+			c.expression += fmt.Sprintf(" or (tcp and (port %d or port %d))", c.config.Collectors.DnsSniffer.DotPort,
+				c.config.Collectors.DnsSniffer.DohPort)
+		}
+	}
+	c.flowTimeout = time.Duration(c.config.Collectors.DnsSniffer.TcpFlowTimeout) * time.Second
+	c.defragTimeout = time.Duration(c.config.Collectors.DnsSniffer.DefragTimeout) * time.Second
 }
 
 func (c *DnsSniffer) Channel() chan dnsutils.DnsMessage {
@@ -161,14 +144,70 @@ func (c *DnsSniffer) Stop() {
 	close(c.done)
 }
 
+// Listen opens a raw socket per fanout worker, the packets are spread between the sockets
+// of the fanout group according to their flow
 func (c *DnsSniffer) Listen() error {
-
-	// raw socket
-	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, Htons(syscall.ETH_P_ALL))
+	// the filter is applied to the sockets and to the reassembled datagrams
+	filter, err := dnsutils.GetBpfFilter(c.expression, c.linkType)
+	if err != nil {
+		return err
+	}
+	c.vm, err = bpf.NewVM(filter)
 	if err != nil {
 		return err
 	}
+	c.filter = filter
+
+	workers := c.config.Collectors.DnsSniffer.FanoutWorkers
+	c.fanoutGroup = (os.Getpid() + int(atomic.AddUint32(&fanoutGroups, 1))) & 0xffff
+	for i := 0; i < workers; i++ {
+		fd, ring, err := c.OpenSocket(workers > 1)
+		if err != nil {
+			c.CloseSockets()
+			return err
+		}
+		c.fds = append(c.fds, fd)
+		c.rings = append(c.rings, ring)
+	}
+	return nil
+}
+
+// OpenSocket creates a raw socket, with a ring buffer if enabled
+func (c *DnsSniffer) OpenSocket(fanout bool) (int, *tpacketRing, error) {
+
+	// raw socket, the link-layer header is removed by the kernel in cooked mode
+	sockType := syscall.SOCK_RAW
+	if c.linkType == dnsutils.LinkTypeLinuxSLL {
+		sockType = syscall.SOCK_DGRAM
+	}
+	fd, err := syscall.Socket(syscall.AF_PACKET, sockType, Htons(syscall.ETH_P_ALL))
+	if err != nil {
+		return 0, nil, err
+	}
 
+	// the ring buffer must be set up before binding the socket
+	var ring *tpacketRing
+	if c.config.Collectors.DnsSniffer.RingBuffer {
+		ring, err = newTpacketRing(fd, c.config.Collectors.DnsSniffer.RingBlockSize,
+			c.config.Collectors.DnsSniffer.RingBlockCount, c.config.Collectors.DnsSniffer.RingBlockTimeout)
+		if err != nil {
+			syscall.Close(fd)
+			return 0, nil, err
+		}
+	}
+
+	err = c.SetupSocket(fd, fanout)
+	if err != nil {
+		if ring != nil {
+			ring.Close()
+		}
+		syscall.Close(fd)
+		return 0, nil, err
+	}
+	return fd, ring, nil
+}
+
+func (c *DnsSniffer) SetupSocket(fd int, fanout bool) error {
 	// bind to device ?
 	if c.device != "" {
 		iface, err := net.InterfaceByName(c.device)
@@ -186,158 +225,401 @@ func (c *DnsSniffer) Listen() error {
 	}
 
 	// set nano timestamp
-	err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TIMESTAMPNS, 1)
+	err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_TIMESTAMPNS, 1)
 	if err != nil {
 		return err
 	}
 
-	filter := GetBpfFilter(c.port)
-	err = ApplyBpfFilter(filter, fd)
+	err = ApplyBpfFilter(c.filter, fd)
 	if err != nil {
 		return err
 	}
 
-	c.fd = fd
+	// join the fanout group of the sniffer, the fragments are reassembled by the kernel
+	// before choosing the socket so all the fragments of a datagram go to the same worker
+	if fanout {
+		mode := unix.PACKET_FANOUT_HASH | unix.PACKET_FANOUT_FLAG_DEFRAG
+		if err := syscall.SetsockoptInt(fd, unix.SOL_PACKET, unix.PACKET_FANOUT, c.fanoutGroup|mode<<16); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (c *DnsSniffer) Run() {
-	c.LogInfo("starting collector...")
-	defer RemoveBpfFilter(c.fd)
-	defer syscall.Close(c.fd)
-
-	if c.fd == 0 {
-		if err := c.Listen(); err != nil {
-			c.LogError("init raw socket failed: %v\n", err)
-			os.Exit(1)
+func (c *DnsSniffer) CloseSockets() {
+	for i, fd := range c.fds {
+		RemoveBpfFilter(fd)
+		if c.rings[i] != nil {
+			c.rings[i].Close()
 		}
+		syscall.Close(fd)
 	}
+	c.fds = nil
+	c.rings = nil
+}
 
-	dns_subprocessor := subprocessors.NewDnsProcessor(c.config, c.logger)
-	go dns_subprocessor.Run(c.Loggers())
+// Forward sends the dns message to the dns processor according to the capture settings
+func (c *DnsSniffer) Forward(dm dnsutils.DnsMessage, processor chan dnsutils.DnsMessage) {
+	dm.DnsTap.Identity = c.identity
 
-	go func() {
-		buf := make([]byte, 65536)
-		oob := make([]byte, 100)
-		for {
-			//flags, from
-			bufN, oobn, _, _, err := syscall.Recvmsg(c.fd, buf, oob, 0)
-			if err != nil {
-				panic(err)
-			}
-			if bufN == 0 {
-				panic("buf empty")
-			}
-			if bufN > len(buf) {
-				panic("buf overflow")
-			}
-			if oobn == 0 {
-				panic("oob missing")
-			}
+	// just decode QR
+	if len(dm.DNS.Payload) < 4 {
+		c.decodeErrors.Inc()
+		return
+	}
+	qr := binary.BigEndian.Uint16(dm.DNS.Payload[2:4]) >> 15
+
+	if int(qr) == 0 && c.capturequeries {
+		processor <- dm
+	}
+	if int(qr) == 1 && c.capturereplies {
+		processor <- dm
+	}
+}
 
-			scms, err := syscall.ParseSocketControlMessage(oob[:oobn])
-			if err != nil {
-				panic(err)
+// NewAssembler creates the tcp reassembly of the flows, the memory used to buffer the
+// out-of-order segments is limited
+func (c *DnsSniffer) NewAssembler(processor chan dnsutils.DnsMessage) *tcpassembly.Assembler {
+	factory := &dnsStreamFactory{
+		handler:      func(dm dnsutils.DnsMessage) { c.Forward(dm, processor) },
+		decodeErrors: c.decodeErrors,
+	}
+	if keylog := c.config.Collectors.DnsSniffer.TlsKeyLogFile; len(keylog) > 0 {
+		factory.keylog = newTlsKeyLog(keylog)
+		factory.dotPort = c.config.Collectors.DnsSniffer.DotPort
+		factory.dohPort = c.config.Collectors.DnsSniffer.DohPort
+		factory.sessions = make(map[string]*tlsSessionState)
+	}
+	assembler := tcpassembly.NewAssembler(tcpassembly.NewStreamPool(factory))
+	assembler.MaxBufferedPagesTotal = c.config.Collectors.DnsSniffer.TcpMaxBufferedPages
+	assembler.MaxBufferedPagesPerConnection = c.config.Collectors.DnsSniffer.TcpMaxBufferedPagesPerFlow
+	return assembler
+}
+
+// Defrag returns the transport layer of the fragmented ip packet once all the fragments are
+// received, nil is returned while fragments are missing
+func (c *DnsSniffer) Defrag(defragmenter *ipDefragmenter, decoded []gopacket.LayerType, ip4 *layers.IPv4, ip6 *layers.IPv6,
+	ts time.Time) ([]byte, layers.IPProtocol, bool, error) {
+	for _, layertyp := range decoded {
+		switch layertyp {
+		case layers.LayerTypeIPv4:
+			more := ip4.Flags&layers.IPv4MoreFragments != 0
+			if !more && ip4.FragOffset == 0 {
+				return nil, 0, false, nil
 			}
-			if len(scms) != 1 {
-				continue
+			datagram, err := defragmenter.Defrag(ip4.NetworkFlow(), ip4.Protocol, uint32(ip4.Id), int(ip4.FragOffset)*8, more, ip4.Payload, ts)
+			return datagram, ip4.Protocol, true, err
+
+		case layers.LayerTypeIPv6:
+			if ip6.NextHeader != layers.IPProtocolIPv6Fragment {
+				return nil, 0, false, nil
 			}
-			scm := scms[0]
-			if scm.Header.Type != syscall.SCM_TIMESTAMPNS {
-				panic("scm timestampns missing")
+
+			// fragment header: next header, reserved, offset and flags, identification
+			if len(ip6.Payload) < 8 {
+				return nil, 0, true, errInvalidFragment
 			}
-			tsec := binary.LittleEndian.Uint32(scm.Data[:4])
-			nsec := binary.LittleEndian.Uint32(scm.Data[8:12])
-
-			var eth layers.Ethernet
-			var ip4 layers.IPv4
-			var ip6 layers.IPv6
-			var tcp layers.TCP
-			var udp layers.UDP
-			parser := gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet, &eth, &ip4, &ip6, &tcp, &udp)
-			decodedLayers := make([]gopacket.LayerType, 0, 10)
-
-			// copy packet data from buffer
-			pkt := make([]byte, bufN)
-			copy(pkt, buf[:bufN])
-
-			// decode-it
-			parser.DecodeLayers(pkt, &decodedLayers)
-
-			dm := dnsutils.DnsMessage{}
-			dm.Init()
-
-			ignore_packet := false
-			for _, layertyp := range decodedLayers {
-				switch layertyp {
-				case layers.LayerTypeIPv4:
-					dm.NetworkInfo.Family = "INET"
-					dm.NetworkInfo.QueryIp = ip4.SrcIP.String()
-					dm.NetworkInfo.ResponseIp = ip4.DstIP.String()
-
-				case layers.LayerTypeIPv6:
-					dm.NetworkInfo.QueryIp = ip6.SrcIP.String()
-					dm.NetworkInfo.ResponseIp = ip6.DstIP.String()
-					dm.NetworkInfo.Family = "INET6"
-					fmt.Println(eth)
-
-				case layers.LayerTypeUDP:
-					dm.NetworkInfo.QueryPort = fmt.Sprint(int(udp.SrcPort))
-					dm.NetworkInfo.ResponsePort = fmt.Sprint(int(udp.DstPort))
-					dm.DNS.Payload = udp.Payload
-					dm.DNS.Length = len(udp.Payload)
-					dm.NetworkInfo.Protocol = "UDP"
-
-				case layers.LayerTypeTCP:
-					// ignore SYN/ACK packet
-					if !tcp.PSH {
-						ignore_packet = true
-						continue
-					}
-
-					dnsLengthField := binary.BigEndian.Uint16(tcp.Payload[0:2])
-					if len(tcp.Payload) < int(dnsLengthField) {
-						ignore_packet = true
-						continue
-					}
-
-					dm.NetworkInfo.QueryPort = fmt.Sprint(int(tcp.SrcPort))
-					dm.NetworkInfo.ResponsePort = fmt.Sprint(int(tcp.DstPort))
-					dm.DNS.Payload = tcp.Payload[2:]
-					dm.DNS.Length = len(tcp.Payload[2:])
-					dm.NetworkInfo.Protocol = "TCP"
+			h := ip6.Payload
+			proto := layers.IPProtocol(h[0])
+			offset := int(binary.BigEndian.Uint16(h[2:4]) & 0xfff8)
+			more := h[3]&0x1 != 0
+			datagram, err := defragmenter.Defrag(ip6.NetworkFlow(), proto, binary.BigEndian.Uint32(h[4:8]), offset, more, h[8:], ts)
+			return datagram, proto, true, err
+		}
+	}
+	return nil, 0, false, nil
+}
 
-				}
+// RebuildPacket returns the packet of the reassembled datagram with the link-layer header and
+// the ip header of the last fragment received, the fragmentation fields are removed
+func (c *DnsSniffer) RebuildPacket(linkHeader []byte, decoded []gopacket.LayerType, ip4 *layers.IPv4, ip6 *layers.IPv6,
+	proto layers.IPProtocol, datagram []byte) []byte {
+	pkt := append([]byte{}, linkHeader...)
+	for _, layertyp := range decoded {
+		switch layertyp {
+		case layers.LayerTypeIPv4:
+			hdr := append([]byte{}, ip4.Contents...)
+			// total length, only the don't fragment flag is kept
+			binary.BigEndian.PutUint16(hdr[2:4], uint16(len(hdr)+len(datagram)))
+			hdr[6] &= 0x40
+			hdr[7] = 0
+			return append(append(pkt, hdr...), datagram...)
+
+		case layers.LayerTypeIPv6:
+			hdr := append([]byte{}, ip6.Contents...)
+			// payload length and next header without the fragment header
+			binary.BigEndian.PutUint16(hdr[4:6], uint16(len(datagram)))
+			hdr[6] = byte(proto)
+			return append(append(pkt, hdr...), datagram...)
+		}
+	}
+	return nil
+}
+
+// HandlePacket decodes the packet captured, the packet data must not be reused by the caller
+func (c *DnsSniffer) HandlePacket(pkt []byte, ts time.Time) {
+	var eth layers.Ethernet
+	var dot1q layers.Dot1Q
+	var ip4 layers.IPv4
+	var ip6 layers.IPv6
+	var tcp layers.TCP
+	var udp layers.UDP
+
+	// the packet starts with the ip header without link-layer header
+	firstLayer := layers.LayerTypeEthernet
+	if c.linkType != dnsutils.LinkTypeEthernet {
+		firstLayer = layers.LayerTypeIPv4
+		if len(pkt) > 0 && pkt[0]>>4 == 6 {
+			firstLayer = layers.LayerTypeIPv6
+		}
+	}
+	parser := gopacket.NewDecodingLayerParser(firstLayer, &eth, &dot1q, &ip4, &ip6, &tcp, &udp)
+	decodedLayers := make([]gopacket.LayerType, 0, 10)
+
+	// decode-it
+	parser.DecodeLayers(pkt, &decodedLayers)
+
+	// the fragmented datagrams are decoded once all the fragments are received
+	c.mu.Lock()
+	datagram, proto, fragmented, err := c.Defrag(c.defragmenter, decodedLayers, &ip4, &ip6, ts)
+	c.mu.Unlock()
+	if fragmented {
+		if err != nil {
+			c.decodeErrors.Inc()
+		}
+		if datagram == nil {
+			return
+		}
+
+		// size of the link-layer header with the vlan tag
+		linkHeaderLen := 0
+		for _, layertyp := range decodedLayers {
+			switch layertyp {
+			case layers.LayerTypeEthernet:
+				linkHeaderLen += len(eth.Contents)
+			case layers.LayerTypeDot1Q:
+				linkHeaderLen += len(dot1q.Contents)
 			}
+		}
 
-			if !ignore_packet {
-				dm.DnsTap.Identity = c.identity
+		// the fragments are captured whatever the filter, the reassembled packet is filtered again
+		// because the ports are only in the first fragment
+		pkt = c.RebuildPacket(pkt[:linkHeaderLen], decodedLayers, &ip4, &ip6, proto, datagram)
+		if n, err := c.vm.Run(pkt); err != nil || n == 0 {
+			return
+		}
+		c.HandlePacket(pkt, ts)
+		return
+	}
 
-				// set timestamp
-				dm.DnsTap.TimeSec = int(tsec)
-				dm.DnsTap.TimeNsec = int(nsec)
+	dm := dnsutils.DnsMessage{}
+	dm.Init()
+
+	var netFlow gopacket.Flow
+	ignore_packet := false
+	for _, layertyp := range decodedLayers {
+		switch layertyp {
+		case layers.LayerTypeIPv4:
+			dm.NetworkInfo.Family = "INET"
+			dm.NetworkInfo.QueryIp = ip4.SrcIP.String()
+			dm.NetworkInfo.ResponseIp = ip4.DstIP.String()
+			netFlow = ip4.NetworkFlow()
+
+		case layers.LayerTypeIPv6:
+			dm.NetworkInfo.QueryIp = ip6.SrcIP.String()
+			dm.NetworkInfo.ResponseIp = ip6.DstIP.String()
+			dm.NetworkInfo.Family = "INET6"
+			netFlow = ip6.NetworkFlow()
+
+		case layers.LayerTypeUDP:
+			dm.NetworkInfo.QueryPort = fmt.Sprint(int(udp.SrcPort))
+			dm.NetworkInfo.ResponsePort = fmt.Sprint(int(udp.DstPort))
+			dm.DNS.Payload = udp.Payload
+			dm.DNS.Length = len(udp.Payload)
+			dm.NetworkInfo.Protocol = "UDP"
+
+		case layers.LayerTypeTCP:
+			// the dns messages are extracted from the reassembled flow
+			ignore_packet = true
+			c.mu.Lock()
+			c.assembler.AssembleWithTimestamp(netFlow, &tcp, ts)
+			c.mu.Unlock()
+		}
+	}
 
-				// just decode QR
-				if len(dm.DNS.Payload) < 4 {
-					continue
-				}
-				qr := binary.BigEndian.Uint16(dm.DNS.Payload[2:4]) >> 15
+	if !ignore_packet {
+		// set timestamp
+		dm.DnsTap.TimeSec = int(ts.Unix())
+		dm.DnsTap.TimeNsec = ts.Nanosecond()
 
-				if int(qr) == 0 && c.capturequeries {
-					dns_subprocessor.GetChannel() <- dm
-				}
-				if int(qr) == 1 && c.capturereplies {
-					dns_subprocessor.GetChannel() <- dm
+		c.Forward(dm, c.processor)
+	}
+}
+
+// ReadSocket receives the packets one by one with their timestamp until the quit channel
+// is closed, the receive timeout lets the reader check the quit channel without traffic
+func (c *DnsSniffer) ReadSocket(fd int, quit chan bool) error {
+	timeout := syscall.Timeval{Usec: 100000}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 65536)
+	oob := make([]byte, 100)
+	for {
+		select {
+		case <-quit:
+			return nil
+		default:
+		}
+
+		//flags, from
+		bufN, oobn, _, _, err := syscall.Recvmsg(fd, buf, oob, 0)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if bufN == 0 {
+			return errors.New("buf empty")
+		}
+		if bufN > len(buf) {
+			return errors.New("buf overflow")
+		}
+		if oobn == 0 {
+			return errors.New("oob missing")
+		}
+
+		scms, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return err
+		}
+		if len(scms) != 1 {
+			continue
+		}
+		scm := scms[0]
+		if scm.Header.Type != syscall.SCM_TIMESTAMPNS {
+			return errors.New("scm timestampns missing")
+		}
+		tsec := binary.LittleEndian.Uint32(scm.Data[:4])
+		nsec := binary.LittleEndian.Uint32(scm.Data[8:12])
+
+		// copy packet data from buffer
+		pkt := make([]byte, bufN)
+		copy(pkt, buf[:bufN])
+
+		c.HandlePacket(pkt, time.Unix(int64(tsec), int64(nsec)))
+	}
+}
+
+// ReadRing reads the blocks of the ring buffer until the quit channel is closed,
+// the packets are timestamped by the kernel in the ring
+func (c *DnsSniffer) ReadRing(ring *tpacketRing, quit chan bool) error {
+	handler := func(data []byte, ts time.Time) {
+		// copy packet data from the block before giving it back to the kernel
+		pkt := make([]byte, len(data))
+		copy(pkt, data)
+
+		c.HandlePacket(pkt, ts)
+	}
+
+	for {
+		select {
+		case <-quit:
+			return nil
+		default:
+		}
+
+		if err := ring.ReadBlock(100, handler); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *DnsSniffer) Run() {
+	c.LogInfo("starting collector...")
+
+	if len(c.fds) == 0 {
+		if err := c.Listen(); err != nil {
+			panic(fmt.Sprintf("init raw socket failed: %v", err))
+		}
+	}
+	defer c.CloseSockets()
+	c.SetReady(true)
+
+	dns_subprocessor := subprocessors.NewDnsProcessor(c.config, c.logger)
+	dns_subprocessor.SetCollector(c.name)
+	go dns_subprocessor.Run(c.Loggers())
+
+	// packets too short to be decoded and incomplete tcp messages
+	c.decodeErrors = dnsutils.Telemetry.Get(dnsutils.MetricDecodeErrors, c.name)
+
+	// the tcp flows and the ip fragments are reassembled by the capture goroutines
+	// and expired by the run loop
+	c.processor = dns_subprocessor.GetChannel()
+	c.assembler = c.NewAssembler(c.processor)
+	c.defragmenter = newIpDefragmenter(c.config.Collectors.DnsSniffer.DefragMaxDatagrams)
+	flush := time.NewTicker(time.Second)
+	defer flush.Stop()
+
+	// one capture goroutine per socket, the errors and the panics are reported to the run loop
+	errs := make(chan error, len(c.fds))
+	quit := make(chan bool)
+	var wg sync.WaitGroup
+	for i, fd := range c.fds {
+		wg.Add(1)
+		if c.rings[i] == nil {
+			go func(fd int) {
+				defer wg.Done()
+				if err := dnsutils.RecoverError(func() error { return c.ReadSocket(fd, quit) }); err != nil {
+					errs <- err
 				}
-			}
+			}(fd)
+			continue
 		}
-	}()
 
-	<-c.exit
+		go func(ring *tpacketRing) {
+			defer wg.Done()
+			if err := dnsutils.RecoverError(func() error { return c.ReadRing(ring, quit) }); err != nil {
+				errs <- err
+			}
+		}(c.rings[i])
+	}
+
+	// the capture goroutines are stopped before closing the sockets and the dns processor,
+	// the ring buffers must not be read anymore when they are unmapped and the packets not
+	// sent anymore to the closed processor channel
+	stopCapture := func() {
+		close(quit)
+		wg.Wait()
+		c.CloseSockets()
+	}
+
+LOOP:
+	for {
+		select {
+		case <-c.exit:
+			break LOOP
+		case <-flush.C:
+			// close the idle flows and drop the incomplete datagrams
+			c.mu.Lock()
+			c.assembler.FlushOlderThan(time.Now().Add(-c.flowTimeout))
+			c.decodeErrors.Add(int64(c.defragmenter.DiscardOlderThan(time.Now().Add(-c.defragTimeout))))
+			c.mu.Unlock()
+		case err := <-errs:
+			// the collector is restarted by the supervisor
+			stopCapture()
+			dns_subprocessor.Stop()
+			panic(fmt.Sprintf("capture error: %v", err))
+		}
+	}
+	stopCapture()
 
 	// stop dns processor
 	dns_subprocessor.Stop()
 
+	c.SetReady(false)
 	c.LogInfo("run terminated")
 	c.done <- true
 }
@@ -4,15 +4,17 @@ import (
 	"log"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
 	"github.com/dmachard/go-dnscollector/loggers"
+	"github.com/dmachard/go-dnscollector/subprocessors"
 	"github.com/dmachard/go-logger"
 )
 
 func TestDnsSnifferRun(t *testing.T) {
 	g := loggers.NewFakeLogger()
-	c := NewDnsSniffer([]dnsutils.Worker{g}, dnsutils.GetFakeConfig(), logger.New(false))
+	c := NewDnsSniffer([]dnsutils.Worker{g}, dnsutils.GetFakeConfig(), logger.New(false), "dns-sniffer")
 	if err := c.Listen(); err != nil {
 		log.Fatal("collector sniffer listening error: ", err)
 	}
@@ -29,3 +31,70 @@ func TestDnsSnifferRun(t *testing.T) {
 		}
 	}
 }
+
+func TestDnsSnifferRingRun(t *testing.T) {
+	g := loggers.NewFakeLogger()
+	config := dnsutils.GetFakeConfig()
+	config.Collectors.DnsSniffer.RingBuffer = true
+	config.Collectors.DnsSniffer.FanoutWorkers = 2
+	c := NewDnsSniffer([]dnsutils.Worker{g}, config, logger.New(false), "dns-sniffer")
+	if err := c.Listen(); err != nil {
+		log.Fatal("collector sniffer listening error: ", err)
+	}
+	go c.Run()
+
+	// send dns query
+	net.LookupIP("dns.collector")
+
+	// waiting message in channel
+	for {
+		msg := <-g.Channel()
+		if msg.DnsTap.Operation == "CLIENT_QUERY" && msg.DNS.Qname == "dns.collector" {
+			break
+		}
+	}
+}
+
+func TestDnsSnifferStop(t *testing.T) {
+	g := loggers.NewFakeLogger()
+	c := NewDnsSniffer([]dnsutils.Worker{g}, dnsutils.GetFakeConfig(), logger.New(false), "dns-sniffer")
+	if err := c.Listen(); err != nil {
+		log.Fatal("collector sniffer listening error: ", err)
+	}
+	go c.Run()
+
+	// the packets are still captured while the collector is stopped
+	quit := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			case <-g.Channel():
+			}
+		}
+	}()
+	go func() {
+		dnsquery, _ := subprocessors.GetFakeDns()
+		conn, err := net.Dial("udp", "127.0.0.1:53")
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-time.After(time.Millisecond):
+				conn.Write(dnsquery)
+			}
+		}
+	}()
+
+	time.Sleep(500 * time.Millisecond)
+	c.Stop()
+
+	// no packet is sent anymore to the stopped dns processor
+	time.Sleep(500 * time.Millisecond)
+	close(quit)
+}
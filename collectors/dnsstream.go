@@ -0,0 +1,120 @@
+package collectors
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// dnsStreamFactory creates a stream for each direction of the tcp flows,
+// the dns messages found are passed to the handler
+type dnsStreamFactory struct {
+	handler      func(dm dnsutils.DnsMessage)
+	decodeErrors *dnsutils.TelemetryValue
+	// the dns over tls and https sessions are decrypted with the key log
+	keylog   *tlsKeyLog
+	dotPort  int
+	dohPort  int
+	sessions map[string]*tlsSessionState
+}
+
+func (f *dnsStreamFactory) New(netFlow, tcpFlow gopacket.Flow) tcpassembly.Stream {
+	if f.keylog != nil {
+		if stream := f.NewTlsStream(netFlow, tcpFlow); stream != nil {
+			return stream
+		}
+	}
+	return &dnsStream{netFlow: netFlow, tcpFlow: tcpFlow, factory: f}
+}
+
+// extractDnsMessages passes the complete dns messages prefixed by their length to the handler,
+// the remaining bytes are returned
+func extractDnsMessages(buf []byte, handler func(payload []byte)) []byte {
+	for len(buf) >= 2 {
+		dnsLengthField := int(binary.BigEndian.Uint16(buf[0:2]))
+		if len(buf) < dnsLengthField+2 {
+			break
+		}
+
+		payload := make([]byte, dnsLengthField)
+		copy(payload, buf[2:dnsLengthField+2])
+		buf = buf[dnsLengthField+2:]
+
+		handler(payload)
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	return buf
+}
+
+// newStreamMessage returns the dns message sent on the tcp flow with the transport protocol
+func newStreamMessage(netFlow, tcpFlow gopacket.Flow, protocol string, payload []byte, ts time.Time) dnsutils.DnsMessage {
+	dm := dnsutils.DnsMessage{}
+	dm.Init()
+
+	src, dst := netFlow.Endpoints()
+	srcPort, dstPort := tcpFlow.Endpoints()
+
+	dm.NetworkInfo.Family = "INET"
+	if len(src.Raw()) == net.IPv6len {
+		dm.NetworkInfo.Family = "INET6"
+	}
+	dm.NetworkInfo.Protocol = protocol
+	dm.NetworkInfo.QueryIp = net.IP(src.Raw()).String()
+	dm.NetworkInfo.QueryPort = strconv.Itoa(int(binary.BigEndian.Uint16(srcPort.Raw())))
+	dm.NetworkInfo.ResponseIp = net.IP(dst.Raw()).String()
+	dm.NetworkInfo.ResponsePort = strconv.Itoa(int(binary.BigEndian.Uint16(dstPort.Raw())))
+
+	dm.DnsTap.TimeSec = int(ts.Unix())
+	dm.DnsTap.TimeNsec = int(ts.UnixNano() - ts.Unix()*1e9)
+
+	dm.DNS.Payload = payload
+	dm.DNS.Length = len(payload)
+	return dm
+}
+
+// dnsStream extracts the dns messages prefixed by their length from the reassembled data,
+// a message can be split across several segments and several messages can be pipelined
+// in the same segment
+type dnsStream struct {
+	netFlow gopacket.Flow
+	tcpFlow gopacket.Flow
+	buf     []byte
+	factory *dnsStreamFactory
+}
+
+func (s *dnsStream) Reassembled(reassemblies []tcpassembly.Reassembly) {
+	for _, r := range reassemblies {
+		// bytes are missing, the pending message can't be completed
+		if r.Skip != 0 {
+			if len(s.buf) > 0 {
+				s.factory.decodeErrors.Inc()
+			}
+			s.buf = nil
+		}
+		s.buf = append(s.buf, r.Bytes...)
+
+		seen := r.Seen
+		s.buf = extractDnsMessages(s.buf, func(payload []byte) {
+			s.factory.handler(s.NewMessage(payload, seen))
+		})
+	}
+}
+
+func (s *dnsStream) ReassemblyComplete() {
+	// the flow is closed or expired with an incomplete message
+	if len(s.buf) > 0 {
+		s.factory.decodeErrors.Inc()
+	}
+	s.buf = nil
+}
+
+func (s *dnsStream) NewMessage(payload []byte, ts time.Time) dnsutils.DnsMessage {
+	return newStreamMessage(s.netFlow, s.tcpFlow, "TCP", payload, ts)
+}
@@ -0,0 +1,88 @@
+package collectors
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/subprocessors"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// fakeTcpSegment returns the decoded layers of a tcp segment from the client to the server
+func fakeTcpSegment(t *testing.T, seq uint32, syn bool, payload []byte) (gopacket.Flow, *layers.TCP) {
+	ip4 := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolTCP,
+		SrcIP:    net.ParseIP("192.168.1.1"),
+		DstIP:    net.ParseIP("192.168.1.254"),
+	}
+	tcp := &layers.TCP{SrcPort: 42000, DstPort: 53, Seq: seq, SYN: syn, ACK: !syn, Window: 65535}
+	tcp.SetNetworkLayerForChecksum(ip4)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ip4, tcp, gopacket.Payload(payload)); err != nil {
+		t.Fatalf("packet serialize error: %s", err)
+	}
+
+	packet := gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.Default)
+	return packet.NetworkLayer().NetworkFlow(), packet.TransportLayer().(*layers.TCP)
+}
+
+func TestDnsStreamReassembly(t *testing.T) {
+	dnsquery, err := subprocessors.GetFakeDns()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+	msg := make([]byte, 2+len(dnsquery))
+	binary.BigEndian.PutUint16(msg, uint16(len(dnsquery)))
+	copy(msg[2:], dnsquery)
+
+	var messages []dnsutils.DnsMessage
+	factory := &dnsStreamFactory{
+		handler:      func(dm dnsutils.DnsMessage) { messages = append(messages, dm) },
+		decodeErrors: &dnsutils.TelemetryValue{},
+	}
+	assembler := tcpassembly.NewAssembler(tcpassembly.NewStreamPool(factory))
+
+	// two pipelined queries in the same segment, then a query split in two segments
+	// with the second part received first
+	pipelined := append(append([]byte{}, msg...), msg...)
+	segments := []struct {
+		seq     uint32
+		syn     bool
+		payload []byte
+	}{
+		{seq: 1000, syn: true},
+		{seq: 1001, payload: pipelined},
+		{seq: 1001 + uint32(len(pipelined)) + 5, payload: msg[5:]},
+		{seq: 1001 + uint32(len(pipelined)), payload: msg[:5]},
+	}
+	ts := time.Now()
+	for _, s := range segments {
+		netFlow, tcp := fakeTcpSegment(t, s.seq, s.syn, s.payload)
+		assembler.AssembleWithTimestamp(netFlow, tcp, ts)
+	}
+	assembler.FlushAll()
+
+	if len(messages) != 3 {
+		t.Fatalf("want 3 dns messages, got %d", len(messages))
+	}
+	for _, dm := range messages {
+		if string(dm.DNS.Payload) != string(dnsquery) {
+			t.Errorf("invalid payload: %v", dm.DNS.Payload)
+		}
+		if dm.NetworkInfo.Protocol != "TCP" || dm.NetworkInfo.QueryIp != "192.168.1.1" || dm.NetworkInfo.QueryPort != "42000" {
+			t.Errorf("invalid network info: %+v", dm.NetworkInfo)
+		}
+	}
+	if factory.decodeErrors.Get() != 0 {
+		t.Errorf("unexpected decode errors: %d", factory.decodeErrors.Get())
+	}
+}
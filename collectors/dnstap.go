@@ -3,9 +3,12 @@ package collectors
 import (
 	"bufio"
 	"crypto/tls"
+	"fmt"
 	"net"
 	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
@@ -15,22 +18,27 @@ import (
 )
 
 type Dnstap struct {
+	dnsutils.ReadyState
 	done     chan bool
 	listen   net.Listener
 	conns    []net.Conn
+	wg       sync.WaitGroup
 	sockPath string
+	connid   uint64
 	loggers  []dnsutils.Worker
 	config   *dnsutils.Config
 	logger   *logger.Logger
+	name     string
 }
 
-func NewDnstap(loggers []dnsutils.Worker, config *dnsutils.Config, logger *logger.Logger) *Dnstap {
+func NewDnstap(loggers []dnsutils.Worker, config *dnsutils.Config, logger *logger.Logger, name string) *Dnstap {
 	logger.Info("collector dnstap - enabled")
 	s := &Dnstap{
 		done:    make(chan bool),
 		config:  config,
 		loggers: loggers,
 		logger:  logger,
+		name:    name,
 	}
 	s.ReadConfig()
 	return s
@@ -66,6 +74,16 @@ func (c *Dnstap) HandleConn(conn net.Conn) {
 
 	// start dnstap subprocessor
 	dnstap_subprocessor := subprocessors.NewDnstapProcessor(c.config, c.logger)
+	dnstap_subprocessor.SetCollector(c.name)
+
+	// the frames are counted per connection, the clients of the unix socket have no address
+	connection := peer
+	if len(c.sockPath) > 0 {
+		connection = fmt.Sprintf("unix#%d", atomic.AddUint64(&c.connid, 1))
+	}
+	dnstap_subprocessor.SetConnection(c.name, connection)
+	defer dnsutils.Telemetry.Remove(dnsutils.MetricFramesReceived, c.name, connection)
+
 	go dnstap_subprocessor.Run(c.Loggers())
 
 	// frame stream library
@@ -96,6 +114,16 @@ func (c *Dnstap) Channel() chan dnsutils.DnsMessage {
 	return nil
 }
 
+// Release closes the listener and the connections after a failure of run
+func (c *Dnstap) Release() {
+	for _, conn := range c.conns {
+		conn.Close()
+	}
+	if c.listen != nil {
+		c.listen.Close()
+	}
+}
+
 func (c *Dnstap) Stop() {
 	c.LogInfo("stopping...")
 
@@ -112,6 +140,9 @@ func (c *Dnstap) Stop() {
 	// read done channel and block until run is terminated
 	<-c.done
 	close(c.done)
+
+	// wait until the dnstap processors have sent all the dns messages to the loggers
+	c.wg.Wait()
 }
 
 func (c *Dnstap) Listen() error {
@@ -131,7 +162,7 @@ func (c *Dnstap) Listen() error {
 		var cer tls.Certificate
 		cer, err = tls.LoadX509KeyPair(c.config.Collectors.Dnstap.CertFile, c.config.Collectors.Dnstap.KeyFile)
 		if err != nil {
-			c.logger.Fatal("loading certificate failed:", err)
+			return err
 		}
 		config := &tls.Config{Certificates: []tls.Certificate{cer}}
 
@@ -163,9 +194,15 @@ func (c *Dnstap) Run() {
 	c.LogInfo("starting collector...")
 	if c.listen == nil {
 		if err := c.Listen(); err != nil {
-			c.logger.Fatal("collector dnstap listening failed: ", err)
+			panic(fmt.Sprintf("listening failed: %v", err))
 		}
 	}
+	c.SetReady(true)
+
+	// the panic of a connection handler is reported to run, the listener is closed
+	// to unblock accept
+	failure := make(chan error, 1)
+
 	for {
 		// Accept() blocks waiting for new connection.
 		conn, err := c.listen.Accept()
@@ -174,10 +211,36 @@ func (c *Dnstap) Run() {
 		}
 
 		c.conns = append(c.conns, conn)
-		go c.HandleConn(conn)
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			err := dnsutils.RecoverError(func() error {
+				c.HandleConn(conn)
+				return nil
+			})
+			if err != nil {
+				select {
+				case failure <- err:
+					c.listen.Close()
+				default:
+				}
+			}
+		}()
+
+	}
 
+	select {
+	case err := <-failure:
+		// close the other connections, the collector is restarted by the supervisor
+		for _, conn := range c.conns {
+			conn.Close()
+		}
+		c.wg.Wait()
+		panic(fmt.Sprintf("connection error: %v", err))
+	default:
 	}
 
+	c.SetReady(false)
 	c.LogInfo("run terminated")
 	c.done <- true
 }
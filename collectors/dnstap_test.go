@@ -17,7 +17,7 @@ import (
 
 func TestDnstapTcpRun(t *testing.T) {
 	g := loggers.NewFakeLogger()
-	c := NewDnstap([]dnsutils.Worker{g}, dnsutils.GetFakeConfig(), logger.New(false))
+	c := NewDnstap([]dnsutils.Worker{g}, dnsutils.GetFakeConfig(), logger.New(false), "dnstap")
 	if err := c.Listen(); err != nil {
 		log.Fatal("collector dnstap tcp listening error: ", err)
 	}
@@ -64,13 +64,35 @@ func TestDnstapTcpRun(t *testing.T) {
 	if msg.DnsTap.Operation != "CLIENT_QUERY" {
 		t.Errorf("want CLIENT_QUERY, got %s", msg.DnsTap.Operation)
 	}
+
+	// the frames are counted per connection, the value is removed on close
+	connection := conn.LocalAddr().String()
+	if !hasFramesReceived("dnstap", connection) {
+		t.Errorf("no frames received for the connection %s", connection)
+	}
+	conn.Close()
+	for i := 0; i < 50 && hasFramesReceived("dnstap", connection); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if hasFramesReceived("dnstap", connection) {
+		t.Errorf("frames received not removed for the connection %s", connection)
+	}
+}
+
+func hasFramesReceived(collector string, connection string) bool {
+	for _, v := range dnsutils.Telemetry.Values(dnsutils.MetricFramesReceived) {
+		if v.Labels()[0] == collector && v.Labels()[1] == connection && v.Get() > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 func TestDnstapUnixRun(t *testing.T) {
 	g := loggers.NewFakeLogger()
 	config := dnsutils.GetFakeConfig()
 	config.Collectors.Dnstap.SockPath = "/tmp/dnscollector.sock"
-	c := NewDnstap([]dnsutils.Worker{g}, config, logger.New(false))
+	c := NewDnstap([]dnsutils.Worker{g}, config, logger.New(false), "dnstap")
 	if err := c.Listen(); err != nil {
 		log.Fatal("collector dnstap unix listening  error: ", err)
 	}
@@ -0,0 +1,268 @@
+package collectors
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/subprocessors"
+	"github.com/dmachard/go-dnstap-protobuf"
+	"github.com/dmachard/go-framestream"
+	"github.com/dmachard/go-logger"
+	"google.golang.org/protobuf/proto"
+)
+
+// DnstapReader reads the frame stream files written by the dns servers, from a file or
+// from a directory of rotated files, the frames are replayed as fast as possible or
+// with their original timing
+type DnstapReader struct {
+	dnsutils.ReadyState
+	done           chan bool
+	exit           chan bool
+	path           string
+	originalTiming bool
+	origin         time.Time
+	start          time.Time
+	loggers        []dnsutils.Worker
+	config         *dnsutils.Config
+	logger         *logger.Logger
+	name           string
+}
+
+func NewDnstapReader(loggers []dnsutils.Worker, config *dnsutils.Config, logger *logger.Logger, name string) *DnstapReader {
+	logger.Info("collector dnstap reader - enabled")
+	s := &DnstapReader{
+		done:    make(chan bool),
+		exit:    make(chan bool),
+		config:  config,
+		loggers: loggers,
+		logger:  logger,
+		name:    name,
+	}
+	s.ReadConfig()
+	return s
+}
+
+func (c *DnstapReader) ReadConfig() {
+	c.path = c.config.Collectors.DnstapReader.Path
+	c.originalTiming = c.config.Collectors.DnstapReader.OriginalTiming
+}
+
+func (c *DnstapReader) LogInfo(msg string, v ...interface{}) {
+	c.logger.Info("collector dnstap reader - "+msg, v...)
+}
+
+func (c *DnstapReader) LogError(msg string, v ...interface{}) {
+	c.logger.Error("collector dnstap reader - "+msg, v...)
+}
+
+func (c *DnstapReader) Loggers() []chan dnsutils.DnsMessage {
+	channels := []chan dnsutils.DnsMessage{}
+	for _, p := range c.loggers {
+		channels = append(channels, p.Channel())
+	}
+	return channels
+}
+
+func (c *DnstapReader) Channel() chan dnsutils.DnsMessage {
+	return nil
+}
+
+func (c *DnstapReader) Stop() {
+	c.LogInfo("stopping...")
+
+	// exit to close properly
+	c.exit <- true
+
+	// read done channel and block until run is terminated
+	<-c.done
+	close(c.done)
+}
+
+// Files returns the files to read, the files of a directory are sorted from the oldest
+// to the newest modification time to follow the rotation
+func (c *DnstapReader) Files() ([]string, error) {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{c.path}, nil
+	}
+
+	entries, err := ioutil.ReadDir(c.path)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+
+	files := []string{}
+	for _, f := range entries {
+		if !f.Mode().IsRegular() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		files = append(files, filepath.Join(c.path, f.Name()))
+	}
+	return files, nil
+}
+
+// frameTime returns the time of the dnstap message, the zero time if unknown
+func frameTime(data []byte) time.Time {
+	dt := &dnstap.Dnstap{}
+	if err := proto.Unmarshal(data, dt); err != nil || dt.GetMessage() == nil {
+		return time.Time{}
+	}
+
+	msg := dt.GetMessage()
+	if msg.ResponseTimeSec != nil {
+		return time.Unix(int64(msg.GetResponseTimeSec()), int64(msg.GetResponseTimeNsec()))
+	}
+	if msg.QueryTimeSec != nil {
+		return time.Unix(int64(msg.GetQueryTimeSec()), int64(msg.GetQueryTimeNsec()))
+	}
+	return time.Time{}
+}
+
+// Delay returns the time to wait before sending the frame to keep the original timing,
+// the first frame read is the origin of the replay
+func (c *DnstapReader) Delay(data []byte) time.Duration {
+	if !c.originalTiming {
+		return 0
+	}
+
+	ts := frameTime(data)
+	if ts.IsZero() {
+		return 0
+	}
+	if c.origin.IsZero() {
+		c.origin = ts
+		c.start = time.Now()
+		return 0
+	}
+	return ts.Sub(c.origin) - time.Since(c.start)
+}
+
+// isStopFrame returns true for the control frame ending the stream, the data of a control
+// frame starts with its length which can't be the case of a dnstap message
+func isStopFrame(data []byte) bool {
+	return len(data) >= 8 &&
+		binary.BigEndian.Uint32(data[:4]) == uint32(len(data)-4) &&
+		binary.BigEndian.Uint32(data[4:8]) == framestream.CONTROL_STOP
+}
+
+// ReadFile sends the frames of the file to the dnstap processor,
+// false is returned if the collector is stopped in the meantime
+func (c *DnstapReader) ReadFile(filename string, processor chan []byte) (bool, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return true, err
+	}
+	defer fd.Close()
+
+	// frame stream library, unidirectional mode without handshake
+	fs := framestream.NewFstrm(bufio.NewReader(fd), nil, nil, 0, []byte("protobuf:dnstap.Dnstap"), false)
+	if err := fs.InitReceiver(); err != nil {
+		return true, err
+	}
+
+	// the frames are read until the stop frame or the end of the file, the error
+	// is set before closing the channel
+	var readErr error
+	frames := make(chan []byte, 512)
+	go func() {
+		defer close(frames)
+		for {
+			frame, err := fs.RecvFrame(false)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				readErr = err
+				return
+			}
+			if isStopFrame(frame.Data()) {
+				return
+			}
+			frames <- frame.Data()
+		}
+	}()
+
+	stop := func() {
+		// unblock the frame stream reader
+		fd.Close()
+		for range frames {
+		}
+	}
+
+	for {
+		select {
+		case <-c.exit:
+			stop()
+			return false, nil
+
+		case data, opened := <-frames:
+			if !opened {
+				return true, readErr
+			}
+
+			if delay := c.Delay(data); delay > 0 {
+				select {
+				case <-c.exit:
+					stop()
+					return false, nil
+				case <-time.After(delay):
+				}
+			}
+			processor <- data
+		}
+	}
+}
+
+func (c *DnstapReader) Run() {
+	c.LogInfo("starting collector...")
+	c.SetReady(true)
+
+	dnstap_subprocessor := subprocessors.NewDnstapProcessor(c.config, c.logger)
+	dnstap_subprocessor.SetCollector(c.name)
+	dnstap_subprocessor.SetConnection(c.name, c.path)
+	go dnstap_subprocessor.Run(c.Loggers())
+
+	files, err := c.Files()
+	if err != nil {
+		c.LogError("unable to list the files: %s", err)
+	}
+
+	running := true
+	for _, filename := range files {
+		c.LogInfo("reading %s", filename)
+		running, err = c.ReadFile(filename, dnstap_subprocessor.GetChannel())
+		if err != nil {
+			c.LogError("%s - read error: %s", filename, err)
+		}
+		if !running {
+			break
+		}
+	}
+
+	// nothing more to read, wait the stop
+	if running {
+		c.LogInfo("all files read")
+		<-c.exit
+	}
+
+	// stop dnstap processor
+	dnstap_subprocessor.Stop()
+
+	c.SetReady(false)
+	c.LogInfo("run terminated")
+	c.done <- true
+}
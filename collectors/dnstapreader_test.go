@@ -0,0 +1,135 @@
+package collectors
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/loggers"
+	"github.com/dmachard/go-dnscollector/subprocessors"
+	"github.com/dmachard/go-framestream"
+	"github.com/dmachard/go-logger"
+	"google.golang.org/protobuf/proto"
+)
+
+// writeFakeDnstapFile writes a frame stream file with one dnstap query per timestamp
+func writeFakeDnstapFile(t *testing.T, filename string, timestamps []time.Time) {
+	fd, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("file create error: %s", err)
+	}
+	defer fd.Close()
+
+	fs := framestream.NewFstrm(nil, bufio.NewWriter(fd), nil, 0, []byte("protobuf:dnstap.Dnstap"), false)
+	if err := fs.InitSender(); err != nil {
+		t.Fatalf("framestream init error: %s", err)
+	}
+
+	dnsquery, err := subprocessors.GetFakeDns()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+
+	for _, ts := range timestamps {
+		dt_query := subprocessors.GetFakeDnstap(dnsquery)
+		tsec := uint64(ts.Unix())
+		tnsec := uint32(ts.Nanosecond())
+		dt_query.Message.QueryTimeSec = &tsec
+		dt_query.Message.QueryTimeNsec = &tnsec
+
+		data, err := proto.Marshal(dt_query)
+		if err != nil {
+			t.Fatalf("dnstap proto marshal error %s", err)
+		}
+
+		frame := &framestream.Frame{}
+		frame.Write(data)
+		if err := fs.SendFrame(frame); err != nil {
+			t.Fatalf("send frame error %s", err)
+		}
+	}
+
+	if err := fs.ResetSender(); err != nil {
+		t.Fatalf("framestream stop error: %s", err)
+	}
+}
+
+func TestDnstapReaderRun(t *testing.T) {
+	dir, err := os.MkdirTemp("", "dnstapreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// two queries sent one second apart
+	ts := time.Now().Add(-time.Hour)
+	writeFakeDnstapFile(t, filepath.Join(dir, "dnstap.log"), []time.Time{ts, ts.Add(time.Second)})
+
+	config := dnsutils.GetFakeConfig()
+	config.Collectors.DnstapReader.Path = dir
+	config.Collectors.DnstapReader.OriginalTiming = true
+
+	g := loggers.NewFakeLogger()
+	c := NewDnstapReader([]dnsutils.Worker{g}, config, logger.New(false), "dnstap-reader")
+	go c.Run()
+	defer c.Stop()
+
+	var received []time.Time
+	for i := 0; i < 2; i++ {
+		msg := <-g.Channel()
+		if msg.DnsTap.Operation != "CLIENT_QUERY" {
+			t.Errorf("want CLIENT_QUERY, got %s", msg.DnsTap.Operation)
+		}
+		received = append(received, time.Now())
+	}
+
+	// the original timing is kept
+	if delay := received[1].Sub(received[0]); delay < 900*time.Millisecond {
+		t.Errorf("original timing not kept, second query received after %s", delay)
+	}
+}
+
+func TestDnstapReaderReadFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "dnstapreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "dnstap.log")
+	ts := time.Now()
+	writeFakeDnstapFile(t, filename, []time.Time{ts, ts})
+
+	config := dnsutils.GetFakeConfig()
+	c := NewDnstapReader([]dnsutils.Worker{}, config, logger.New(false), "dnstap-reader")
+
+	// the frames are read until the stop frame
+	frames := make(chan []byte, 10)
+	if _, err := c.ReadFile(filename, frames); err != nil {
+		t.Errorf("unexpected read error: %s", err)
+	}
+	if len(frames) != 2 {
+		t.Errorf("want 2 frames, got %d", len(frames))
+	}
+
+	// remove the stop frame (12 bytes) and the end of the last frame
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(filename, info.Size()-15); err != nil {
+		t.Fatal(err)
+	}
+
+	frames = make(chan []byte, 10)
+	if _, err := c.ReadFile(filename, frames); err != io.ErrUnexpectedEOF {
+		t.Errorf("want unexpected eof error, got %v", err)
+	}
+	if len(frames) != 1 {
+		t.Errorf("want 1 frame, got %d", len(frames))
+	}
+}
@@ -0,0 +1,227 @@
+package collectors
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	http2FrameData         = 0x0
+	http2FrameHeaders      = 0x1
+	http2FrameSettings     = 0x4
+	http2FrameContinuation = 0x9
+
+	http2FlagEndStream  = 0x1
+	http2FlagEndHeaders = 0x4
+	http2FlagPadded     = 0x8
+	http2FlagPriority   = 0x20
+
+	// the dns messages are limited to 64k, the streams in progress are limited
+	dohMaxBodySize = 65535
+	dohMaxStreams  = 256
+)
+
+var (
+	errDohInvalidFrame   = errors.New("invalid http/2 frame")
+	errDohTooManyStreams = errors.New("too many http/2 streams")
+)
+
+type dohRequest struct {
+	method      string
+	path        string
+	contentType string
+	body        []byte
+}
+
+// dohParser extracts the dns messages of the http/2 streams of one direction of a doh connection,
+// the queries are sent with the GET or the POST method and the responses in the body,
+// http/1.1 is not supported and the direction is ignored
+type dohParser struct {
+	client       bool
+	started      bool
+	ignored      bool
+	buf          []byte
+	decoder      *hpack.Decoder
+	streams      map[uint32]*dohRequest
+	headerBlock  []byte
+	headerStream uint32
+	headerEnd    bool
+}
+
+func newDohParser(client bool) *dohParser {
+	decoder := hpack.NewDecoder(4096, nil)
+	// the size of the table is set by the peer in its settings
+	decoder.SetAllowedMaxDynamicTableSize(1 << 20)
+	return &dohParser{client: client, decoder: decoder, streams: make(map[uint32]*dohRequest)}
+}
+
+// Feed reads the complete frames, the handler is called with the dns message of each stream ended
+func (p *dohParser) Feed(data []byte, handler func(payload []byte)) error {
+	if p.ignored {
+		return nil
+	}
+	p.buf = append(p.buf, data...)
+
+	// the client starts with the connection preface, the server with a settings frame
+	if !p.started {
+		if p.client {
+			if len(p.buf) < len(http2.ClientPreface) {
+				return nil
+			}
+			if !bytes.HasPrefix(p.buf, []byte(http2.ClientPreface)) {
+				p.ignored, p.buf = true, nil
+				return nil
+			}
+			p.buf = p.buf[len(http2.ClientPreface):]
+		} else {
+			if len(p.buf) < 9 {
+				return nil
+			}
+			if p.buf[3] != http2FrameSettings {
+				p.ignored, p.buf = true, nil
+				return nil
+			}
+		}
+		p.started = true
+	}
+
+	for len(p.buf) >= 9 {
+		length := int(p.buf[0])<<16 | int(p.buf[1])<<8 | int(p.buf[2])
+		if len(p.buf) < 9+length {
+			break
+		}
+		typ, flags := p.buf[3], p.buf[4]
+		stream := binary.BigEndian.Uint32(p.buf[5:9]) & 0x7fffffff
+		payload := p.buf[9 : 9+length]
+		p.buf = p.buf[9+length:]
+
+		if err := p.HandleFrame(typ, flags, stream, payload, handler); err != nil {
+			return err
+		}
+	}
+	if len(p.buf) == 0 {
+		p.buf = nil
+	}
+	return nil
+}
+
+func (p *dohParser) HandleFrame(typ byte, flags byte, stream uint32, payload []byte, handler func(payload []byte)) error {
+	if typ == http2FrameData || typ == http2FrameHeaders {
+		if flags&http2FlagPadded != 0 {
+			if len(payload) < 1 || len(payload) < 1+int(payload[0]) {
+				return errDohInvalidFrame
+			}
+			payload = payload[1 : len(payload)-int(payload[0])]
+		}
+	}
+
+	switch typ {
+	case http2FrameData:
+		req, err := p.Stream(stream)
+		if err != nil {
+			return err
+		}
+		if len(req.body)+len(payload) <= dohMaxBodySize {
+			req.body = append(req.body, payload...)
+		}
+		if flags&http2FlagEndStream != 0 {
+			p.EndStream(stream, handler)
+		}
+
+	case http2FrameHeaders:
+		if flags&http2FlagPriority != 0 {
+			if len(payload) < 5 {
+				return errDohInvalidFrame
+			}
+			payload = payload[5:]
+		}
+		p.headerBlock = append([]byte{}, payload...)
+		p.headerStream = stream
+		p.headerEnd = flags&http2FlagEndStream != 0
+		if flags&http2FlagEndHeaders != 0 {
+			return p.DecodeHeaders(handler)
+		}
+
+	case http2FrameContinuation:
+		p.headerBlock = append(p.headerBlock, payload...)
+		if flags&http2FlagEndHeaders != 0 {
+			return p.DecodeHeaders(handler)
+		}
+	}
+	return nil
+}
+
+func (p *dohParser) Stream(stream uint32) (*dohRequest, error) {
+	req, ok := p.streams[stream]
+	if !ok {
+		if len(p.streams) >= dohMaxStreams {
+			return nil, errDohTooManyStreams
+		}
+		req = &dohRequest{}
+		p.streams[stream] = req
+	}
+	return req, nil
+}
+
+// DecodeHeaders decodes the header block, all the blocks must be decoded to keep
+// the dynamic table of the decoder
+func (p *dohParser) DecodeHeaders(handler func(payload []byte)) error {
+	fields, err := p.decoder.DecodeFull(p.headerBlock)
+	p.headerBlock = nil
+	if err != nil {
+		return err
+	}
+
+	req, err := p.Stream(p.headerStream)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		switch f.Name {
+		case ":method":
+			req.method = f.Value
+		case ":path":
+			req.path = f.Value
+		case "content-type":
+			req.contentType = f.Value
+		}
+	}
+
+	if p.headerEnd {
+		p.EndStream(p.headerStream, handler)
+	}
+	return nil
+}
+
+// EndStream returns the dns message of the stream, from the dns parameter of the GET queries
+// or from the body
+func (p *dohParser) EndStream(stream uint32, handler func(payload []byte)) {
+	req := p.streams[stream]
+	delete(p.streams, stream)
+
+	var payload []byte
+	switch {
+	case req.method == "GET":
+		u, err := url.Parse(req.path)
+		if err != nil {
+			return
+		}
+		payload, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(u.Query().Get("dns"), "="))
+		if err != nil {
+			return
+		}
+	case strings.HasPrefix(req.contentType, "application/dns-message"):
+		payload = req.body
+	}
+
+	if len(payload) > 0 {
+		handler(payload)
+	}
+}
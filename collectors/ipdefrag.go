@@ -0,0 +1,118 @@
+package collectors
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	ipMaxDatagramSize = 65535
+)
+
+var (
+	errTooManyDatagrams = errors.New("too many fragmented datagrams")
+	errInvalidFragment  = errors.New("invalid or overlapping fragment")
+)
+
+type fragmentKey struct {
+	flow  gopacket.Flow
+	proto layers.IPProtocol
+	id    uint32
+}
+
+type fragment struct {
+	offset int
+	data   []byte
+}
+
+type datagram struct {
+	fragments []fragment
+	length    int
+	received  int
+	seen      time.Time
+}
+
+// ipDefragmenter reassembles the fragmented ipv4 and ipv6 datagrams, the number of datagrams
+// waiting for their fragments is limited and the overlapping fragments are rejected
+type ipDefragmenter struct {
+	datagrams    map[fragmentKey]*datagram
+	maxDatagrams int
+}
+
+func newIpDefragmenter(maxDatagrams int) *ipDefragmenter {
+	return &ipDefragmenter{
+		datagrams:    make(map[fragmentKey]*datagram),
+		maxDatagrams: maxDatagrams,
+	}
+}
+
+// Defrag adds the fragment to its datagram, the payload of the datagram is returned once all the
+// fragments are received. The datagram is dropped if the fragment is invalid.
+func (d *ipDefragmenter) Defrag(flow gopacket.Flow, proto layers.IPProtocol, id uint32, offset int, more bool,
+	data []byte, ts time.Time) ([]byte, error) {
+	key := fragmentKey{flow: flow, proto: proto, id: id}
+	dg, ok := d.datagrams[key]
+	if !ok {
+		if len(d.datagrams) >= d.maxDatagrams {
+			return nil, errTooManyDatagrams
+		}
+		dg = &datagram{length: -1, seen: ts}
+		d.datagrams[key] = dg
+	}
+
+	end := offset + len(data)
+	valid := end <= ipMaxDatagramSize && (dg.length < 0 || end <= dg.length)
+	for _, f := range dg.fragments {
+		// the same fragment captured twice
+		if f.offset == offset && len(f.data) == len(data) {
+			return nil, nil
+		}
+		if offset < f.offset+len(f.data) && f.offset < end {
+			valid = false
+		}
+		if !more && f.offset+len(f.data) > end {
+			valid = false
+		}
+	}
+	if !more && dg.length >= 0 {
+		valid = false
+	}
+	if !valid {
+		delete(d.datagrams, key)
+		return nil, errInvalidFragment
+	}
+
+	if !more {
+		dg.length = end
+	}
+	dg.fragments = append(dg.fragments, fragment{offset: offset, data: append([]byte{}, data...)})
+	dg.received += len(data)
+
+	// the fragments don't overlap, the datagram is complete when all the bytes are received
+	if dg.length < 0 || dg.received < dg.length {
+		return nil, nil
+	}
+	delete(d.datagrams, key)
+
+	payload := make([]byte, dg.length)
+	for _, f := range dg.fragments {
+		copy(payload[f.offset:], f.data)
+	}
+	return payload, nil
+}
+
+// DiscardOlderThan drops the datagrams with a first fragment received before the time,
+// the number of datagrams dropped is returned
+func (d *ipDefragmenter) DiscardOlderThan(t time.Time) int {
+	discarded := 0
+	for key, dg := range d.datagrams {
+		if dg.seen.Before(t) {
+			delete(d.datagrams, key)
+			discarded++
+		}
+	}
+	return discarded
+}
@@ -0,0 +1,227 @@
+package collectors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/subprocessors"
+	"github.com/dmachard/go-logger"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+func fakeIpFlow() gopacket.Flow {
+	return gopacket.NewFlow(layers.EndpointIPv4, net.ParseIP("192.168.1.254").To4(), net.ParseIP("192.168.1.1").To4())
+}
+
+func TestIpDefragReassembly(t *testing.T) {
+	data := make([]byte, 3000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	// three fragments received out of order, the first one twice
+	fragments := []struct {
+		offset int
+		more   bool
+	}{
+		{offset: 1480, more: true},
+		{offset: 0, more: true},
+		{offset: 0, more: true},
+		{offset: 2960, more: false},
+	}
+
+	d := newIpDefragmenter(10)
+	ts := time.Now()
+	var payload []byte
+	for i, f := range fragments {
+		end := f.offset + 1480
+		if !f.more {
+			end = len(data)
+		}
+		datagram, err := d.Defrag(fakeIpFlow(), layers.IPProtocolUDP, 1, f.offset, f.more, data[f.offset:end], ts)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if datagram != nil && i != len(fragments)-1 {
+			t.Fatalf("datagram reassembled before the last fragment")
+		}
+		payload = datagram
+	}
+
+	if !bytes.Equal(payload, data) {
+		t.Errorf("invalid datagram reassembled")
+	}
+	if len(d.datagrams) != 0 {
+		t.Errorf("the datagram should be removed once reassembled")
+	}
+}
+
+func TestIpDefragOverlap(t *testing.T) {
+	d := newIpDefragmenter(10)
+	ts := time.Now()
+
+	if _, err := d.Defrag(fakeIpFlow(), layers.IPProtocolUDP, 1, 0, true, make([]byte, 16), ts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := d.Defrag(fakeIpFlow(), layers.IPProtocolUDP, 1, 8, false, make([]byte, 16), ts); err != errInvalidFragment {
+		t.Errorf("want invalid fragment error, got %v", err)
+	}
+	if len(d.datagrams) != 0 {
+		t.Errorf("the datagram should be dropped")
+	}
+}
+
+func TestIpDefragLimits(t *testing.T) {
+	d := newIpDefragmenter(2)
+	ts := time.Now()
+
+	for id := uint32(0); id < 2; id++ {
+		if _, err := d.Defrag(fakeIpFlow(), layers.IPProtocolUDP, id, 0, true, make([]byte, 8), ts); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if _, err := d.Defrag(fakeIpFlow(), layers.IPProtocolUDP, 2, 0, true, make([]byte, 8), ts); err != errTooManyDatagrams {
+		t.Errorf("want too many datagrams error, got %v", err)
+	}
+
+	if n := d.DiscardOlderThan(ts.Add(time.Second)); n != 2 {
+		t.Errorf("want 2 datagrams discarded, got %d", n)
+	}
+	if _, err := d.Defrag(fakeIpFlow(), layers.IPProtocolUDP, 2, 0, true, make([]byte, 8), ts); err != nil {
+		t.Errorf("unexpected error after discard: %s", err)
+	}
+}
+
+func TestBpfFilterFragments(t *testing.T) {
+	filter, err := dnsutils.GetBpfFilter("port 53", dnsutils.LinkTypeEthernet)
+	if err != nil {
+		t.Fatalf("bpf filter error: %s", err)
+	}
+	vm, err := bpf.NewVM(filter)
+	if err != nil {
+		t.Fatalf("invalid bpf filter: %s", err)
+	}
+
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip4 := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP("192.168.1.254"),
+		DstIP:    net.ParseIP("192.168.1.1"),
+	}
+
+	packets := []struct {
+		name       string
+		srcPort    layers.UDPPort
+		fragOffset uint16
+		keep       bool
+	}{
+		{name: "dns packet", srcPort: 53, keep: true},
+		{name: "other packet", srcPort: 80, keep: false},
+		{name: "next fragment", srcPort: 80, fragOffset: 185, keep: true},
+	}
+	for _, p := range packets {
+		ip4.FragOffset = p.fragOffset
+		udp := &layers.UDP{SrcPort: p.srcPort, DstPort: 42000}
+		udp.SetNetworkLayerForChecksum(ip4)
+
+		buf := gopacket.NewSerializeBuffer()
+		opts := gopacket.SerializeOptions{FixLengths: true}
+		if err := gopacket.SerializeLayers(buf, opts, eth, ip4, udp, gopacket.Payload([]byte("dns"))); err != nil {
+			t.Fatalf("packet serialize error: %s", err)
+		}
+
+		n, err := vm.Run(buf.Bytes())
+		if err != nil {
+			t.Fatalf("bpf error: %s", err)
+		}
+		if (n > 0) != p.keep {
+			t.Errorf("%s: want keep=%v", p.name, p.keep)
+		}
+	}
+}
+
+func TestDnsSnifferHandleFragments(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+	config.Collectors.DnsSniffer.BpfFilter = "src port 53"
+	c := NewDnsSniffer([]dnsutils.Worker{}, config, logger.New(false), "dns-sniffer")
+
+	filter, err := dnsutils.GetBpfFilter(c.expression, c.linkType)
+	if err != nil {
+		t.Fatalf("bpf filter error: %s", err)
+	}
+	c.vm, _ = bpf.NewVM(filter)
+	c.processor = make(chan dnsutils.DnsMessage, 10)
+	c.decodeErrors = &dnsutils.TelemetryValue{}
+	c.assembler = c.NewAssembler(c.processor)
+	c.defragmenter = newIpDefragmenter(10)
+
+	// a large dns response in a vlan tagged frame
+	dnsreply, err := subprocessors.GetFakeDns()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+	dnsreply[2] |= 0x80
+	dnsreply = append(dnsreply, make([]byte, 200)...)
+
+	ip4 := &layers.IPv4{Version: 4, TTL: 64, Id: 1234, Protocol: layers.IPProtocolUDP,
+		SrcIP: net.ParseIP("192.168.1.254"), DstIP: net.ParseIP("192.168.1.1")}
+	udp := &layers.UDP{SrcPort: 53, DstPort: 42000}
+	udp.SetNetworkLayerForChecksum(ip4)
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	err = gopacket.SerializeLayers(buf, opts,
+		&layers.Ethernet{SrcMAC: net.HardwareAddr{0, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{0, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeDot1Q},
+		&layers.Dot1Q{VLANIdentifier: 100, Type: layers.EthernetTypeIPv4},
+		ip4, udp, gopacket.Payload(dnsreply))
+	if err != nil {
+		t.Fatalf("packet serialize error: %s", err)
+	}
+
+	// split the ip payload in two fragments, the second one is received first
+	pkt := buf.Bytes()
+	linkHeader, ipHeader, ipPayload := pkt[:18], pkt[18:38], pkt[38:]
+	fragment := func(offset int, end int, more bool) []byte {
+		hdr := append([]byte{}, ipHeader...)
+		binary.BigEndian.PutUint16(hdr[2:4], uint16(len(hdr)+end-offset))
+		flags := uint16(offset / 8)
+		if more {
+			flags |= 0x2000
+		}
+		binary.BigEndian.PutUint16(hdr[6:8], flags)
+		frag := append(append([]byte{}, linkHeader...), hdr...)
+		return append(frag, ipPayload[offset:end]...)
+	}
+
+	ts := time.Now()
+	c.HandlePacket(fragment(104, len(ipPayload), false), ts)
+	if len(c.processor) != 0 {
+		t.Fatalf("no dns message expected before the first fragment")
+	}
+	c.HandlePacket(fragment(0, 104, true), ts)
+
+	if len(c.processor) != 1 {
+		t.Fatalf("want 1 dns message, got %d", len(c.processor))
+	}
+	dm := <-c.processor
+	if !bytes.Equal(dm.DNS.Payload, dnsreply) {
+		t.Errorf("invalid dns payload reassembled")
+	}
+	if dm.NetworkInfo.QueryIp != "192.168.1.254" || dm.NetworkInfo.QueryPort != "53" {
+		t.Errorf("invalid network info: %+v", dm.NetworkInfo)
+	}
+	if c.decodeErrors.Get() != 0 {
+		t.Errorf("unexpected decode errors: %d", c.decodeErrors.Get())
+	}
+}
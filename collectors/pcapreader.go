@@ -0,0 +1,330 @@
+package collectors
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/subprocessors"
+	"github.com/dmachard/go-logger"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+const (
+	compressSuffix = ".gz"
+	pcapngMagic    = 0x0A0D0D0A
+)
+
+type packetSource interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+}
+
+// PcapReader reads the dns packets of pcap and pcapng files, optionally gzip compressed,
+// from a file or a directory which can be watched for new files
+type PcapReader struct {
+	dnsutils.ReadyState
+	done      chan bool
+	exit      chan bool
+	path      string
+	port      int
+	watch     bool
+	interval  time.Duration
+	identity  string
+	processed map[string]bool
+	loggers   []dnsutils.Worker
+	config    *dnsutils.Config
+	logger    *logger.Logger
+	name      string
+}
+
+func NewPcapReader(loggers []dnsutils.Worker, config *dnsutils.Config, logger *logger.Logger, name string) *PcapReader {
+	logger.Info("collector pcap reader - enabled")
+	s := &PcapReader{
+		done:      make(chan bool),
+		exit:      make(chan bool),
+		processed: make(map[string]bool),
+		config:    config,
+		loggers:   loggers,
+		logger:    logger,
+		name:      name,
+	}
+	s.ReadConfig()
+	return s
+}
+
+func (c *PcapReader) ReadConfig() {
+	c.path = c.config.Collectors.PcapReader.Path
+	c.port = c.config.Collectors.PcapReader.Port
+	c.watch = c.config.Collectors.PcapReader.Watch
+	c.interval = time.Duration(c.config.Collectors.PcapReader.WatchInterval) * time.Second
+	c.identity = c.config.Subprocessors.ServerId
+}
+
+func (c *PcapReader) LogInfo(msg string, v ...interface{}) {
+	c.logger.Info("collector pcap reader - "+msg, v...)
+}
+
+func (c *PcapReader) LogError(msg string, v ...interface{}) {
+	c.logger.Error("collector pcap reader - "+msg, v...)
+}
+
+func (c *PcapReader) Loggers() []chan dnsutils.DnsMessage {
+	channels := []chan dnsutils.DnsMessage{}
+	for _, p := range c.loggers {
+		channels = append(channels, p.Channel())
+	}
+	return channels
+}
+
+func (c *PcapReader) Channel() chan dnsutils.DnsMessage {
+	return nil
+}
+
+func (c *PcapReader) Stop() {
+	c.LogInfo("stopping...")
+
+	// exit to close properly, run is already terminated without watch once all
+	// the files are read
+	select {
+	case c.exit <- true:
+	case <-c.done:
+	}
+
+	// block until run is terminated
+	<-c.done
+}
+
+// Done returns a channel closed when run is terminated, without watch it happens once
+// all the files are read
+func (c *PcapReader) Done() <-chan bool {
+	return c.done
+}
+
+func isPcapFile(name string) bool {
+	name = strings.TrimSuffix(name, compressSuffix)
+	return strings.HasSuffix(name, ".pcap") || strings.HasSuffix(name, ".pcapng")
+}
+
+// Files returns the pcap files to read sorted by name, in watch mode the files recently
+// modified are ignored because they can still be written
+func (c *PcapReader) Files() ([]string, error) {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{c.path}, nil
+	}
+
+	entries, err := ioutil.ReadDir(c.path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, f := range entries {
+		if f.IsDir() || !isPcapFile(f.Name()) {
+			continue
+		}
+		if c.watch && time.Since(f.ModTime()) < c.interval {
+			continue
+		}
+		files = append(files, filepath.Join(c.path, f.Name()))
+	}
+	return files, nil
+}
+
+// DecodePacket extracts the dns message of the udp or tcp packet, false is returned if the packet is ignored
+func (c *PcapReader) DecodePacket(data []byte, ci gopacket.CaptureInfo, linkType layers.LinkType) (dnsutils.DnsMessage, bool) {
+	dm := dnsutils.DnsMessage{}
+	dm.Init()
+
+	packet := gopacket.NewPacket(data, linkType, gopacket.NoCopy)
+	switch ip := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		dm.NetworkInfo.Family = "INET"
+		dm.NetworkInfo.QueryIp = ip.SrcIP.String()
+		dm.NetworkInfo.ResponseIp = ip.DstIP.String()
+	case *layers.IPv6:
+		dm.NetworkInfo.Family = "INET6"
+		dm.NetworkInfo.QueryIp = ip.SrcIP.String()
+		dm.NetworkInfo.ResponseIp = ip.DstIP.String()
+	default:
+		return dm, false
+	}
+
+	var srcPort, dstPort int
+	switch transport := packet.TransportLayer().(type) {
+	case *layers.UDP:
+		srcPort, dstPort = int(transport.SrcPort), int(transport.DstPort)
+		dm.NetworkInfo.Protocol = "UDP"
+		dm.DNS.Payload = transport.Payload
+
+	case *layers.TCP:
+		srcPort, dstPort = int(transport.SrcPort), int(transport.DstPort)
+		dm.NetworkInfo.Protocol = "TCP"
+
+		// only the segments with a complete dns message are decoded
+		if len(transport.Payload) < 2 {
+			return dm, false
+		}
+		dnsLengthField := int(binary.BigEndian.Uint16(transport.Payload[0:2]))
+		if len(transport.Payload) < dnsLengthField+2 {
+			return dm, false
+		}
+		dm.DNS.Payload = transport.Payload[2 : dnsLengthField+2]
+
+	default:
+		return dm, false
+	}
+
+	// filter on source and destination port
+	if srcPort != c.port && dstPort != c.port {
+		return dm, false
+	}
+
+	dm.NetworkInfo.QueryPort = strconv.Itoa(srcPort)
+	dm.NetworkInfo.ResponsePort = strconv.Itoa(dstPort)
+	dm.DNS.Length = len(dm.DNS.Payload)
+	dm.DnsTap.Identity = c.identity
+	dm.DnsTap.TimeSec = int(ci.Timestamp.Unix())
+	dm.DnsTap.TimeNsec = int(ci.Timestamp.UnixNano() - ci.Timestamp.Unix()*1e9)
+	return dm, true
+}
+
+// ReadFile sends the dns packets of the file to the dns processor,
+// false is returned if the collector is stopped in the meantime
+func (c *PcapReader) ReadFile(filename string, processor chan dnsutils.DnsMessage) (bool, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return true, err
+	}
+	defer fd.Close()
+
+	var r io.Reader = fd
+	if strings.HasSuffix(filename, compressSuffix) {
+		gz, err := gzip.NewReader(fd)
+		if err != nil {
+			return true, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	// pcap or pcapng format ?
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return true, err
+	}
+
+	var source packetSource
+	var linkType layers.LinkType
+	if binary.BigEndian.Uint32(magic) == pcapngMagic {
+		ng, err := pcapgo.NewNgReader(br, pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			return true, err
+		}
+		source, linkType = ng, ng.LinkType()
+	} else {
+		pcap, err := pcapgo.NewReader(br)
+		if err != nil {
+			return true, err
+		}
+		source, linkType = pcap, pcap.LinkType()
+	}
+
+	decodeErrors := dnsutils.Telemetry.Get(dnsutils.MetricDecodeErrors, c.name)
+	for {
+		select {
+		case <-c.exit:
+			return false, nil
+		default:
+		}
+
+		data, ci, err := source.ReadPacketData()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+
+		dm, ok := c.DecodePacket(data, ci, linkType)
+		if !ok {
+			continue
+		}
+		if dm.DNS.Length < 4 {
+			decodeErrors.Inc()
+			continue
+		}
+		processor <- dm
+	}
+}
+
+// ReadFiles reads the files not yet processed, false is returned if the collector is stopped
+func (c *PcapReader) ReadFiles(processor chan dnsutils.DnsMessage) bool {
+	files, err := c.Files()
+	if err != nil {
+		c.LogError("unable to list the pcap files: %s", err)
+		return true
+	}
+
+	for _, filename := range files {
+		if c.processed[filename] {
+			continue
+		}
+		c.processed[filename] = true
+
+		c.LogInfo("reading %s", filename)
+		running, err := c.ReadFile(filename, processor)
+		if err != nil {
+			c.LogError("%s - read error: %s", filename, err)
+		}
+		if !running {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *PcapReader) Run() {
+	c.LogInfo("starting collector...")
+	c.SetReady(true)
+
+	dns_subprocessor := subprocessors.NewDnsProcessor(c.config, c.logger)
+	dns_subprocessor.SetCollector(c.name)
+	go dns_subprocessor.Run(c.Loggers())
+
+LOOP:
+	for c.ReadFiles(dns_subprocessor.GetChannel()) {
+		if !c.watch {
+			// nothing more to read
+			c.LogInfo("all files read")
+			break LOOP
+		}
+
+		select {
+		case <-c.exit:
+			break LOOP
+		case <-time.After(c.interval):
+		}
+	}
+
+	// stop dns processor
+	dns_subprocessor.Stop()
+
+	c.SetReady(false)
+	c.LogInfo("run terminated")
+	close(c.done)
+}
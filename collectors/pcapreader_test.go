@@ -0,0 +1,136 @@
+package collectors
+
+import (
+	"compress/gzip"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/loggers"
+	"github.com/dmachard/go-dnscollector/subprocessors"
+	"github.com/dmachard/go-logger"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// writeFakePcap writes a pcap file with one dns query over udp
+func writeFakePcap(t *testing.T, filename string, ts time.Time) {
+	fd, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("pcap create error: %s", err)
+	}
+	defer fd.Close()
+
+	var w io.Writer = fd
+	if filepath.Ext(filename) == compressSuffix {
+		gz := gzip.NewWriter(fd)
+		defer gz.Close()
+		w = gz
+	}
+
+	dnsquery, err := subprocessors.GetFakeDns()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip4 := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.ParseIP("192.168.1.1"),
+		DstIP:    net.ParseIP("192.168.1.254"),
+	}
+	udp := &layers.UDP{SrcPort: 42000, DstPort: 53}
+	udp.SetNetworkLayerForChecksum(ip4)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip4, udp, gopacket.Payload(dnsquery)); err != nil {
+		t.Fatalf("packet serialize error: %s", err)
+	}
+
+	pcapw := pcapgo.NewWriter(w)
+	if err := pcapw.WriteFileHeader(65536, layers.LinkTypeEthernet); err != nil {
+		t.Fatalf("pcap header error: %s", err)
+	}
+	ci := gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(buf.Bytes()), Length: len(buf.Bytes())}
+	if err := pcapw.WritePacket(ci, buf.Bytes()); err != nil {
+		t.Fatalf("pcap write error: %s", err)
+	}
+}
+
+func TestPcapReaderRun(t *testing.T) {
+	dir, err := os.MkdirTemp("", "pcapreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ts := time.Date(2021, 8, 27, 7, 18, 35, 0, time.UTC)
+	writeFakePcap(t, filepath.Join(dir, "capture-1.pcap"), ts)
+	writeFakePcap(t, filepath.Join(dir, "capture-2.pcap.gz"), ts)
+
+	config := dnsutils.GetFakeConfig()
+	config.Collectors.PcapReader.Path = dir
+
+	g := loggers.NewFakeLogger()
+	c := NewPcapReader([]dnsutils.Worker{g}, config, logger.New(false), "pcap-reader")
+	go c.Run()
+	defer c.Stop()
+
+	// one query per file, plain and compressed
+	for i := 0; i < 2; i++ {
+		msg := <-g.Channel()
+		if msg.DnsTap.Operation != "CLIENT_QUERY" || msg.DNS.Qname != "dns.collector" {
+			t.Errorf("invalid message: %s %s", msg.DnsTap.Operation, msg.DNS.Qname)
+		}
+		if msg.NetworkInfo.QueryIp != "192.168.1.1" || msg.NetworkInfo.QueryPort != "42000" {
+			t.Errorf("invalid query address: %s:%s", msg.NetworkInfo.QueryIp, msg.NetworkInfo.QueryPort)
+		}
+		if msg.DnsTap.TimeSec != int(ts.Unix()) {
+			t.Errorf("capture timestamp not kept: %d", msg.DnsTap.TimeSec)
+		}
+	}
+}
+
+func TestPcapReaderRunDone(t *testing.T) {
+	dir, err := os.MkdirTemp("", "pcapreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeFakePcap(t, filepath.Join(dir, "capture-1.pcap"), time.Now())
+
+	config := dnsutils.GetFakeConfig()
+	config.Collectors.PcapReader.Path = dir
+
+	g := loggers.NewFakeLogger()
+	c := NewPcapReader([]dnsutils.Worker{g}, config, logger.New(false), "pcap-reader")
+	go c.Run()
+
+	<-g.Channel()
+
+	// without watch, run is terminated once all the files are read
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("run not terminated after the last file")
+	}
+	if c.IsReady() {
+		t.Errorf("collector still ready after the last file")
+	}
+
+	// stop does not block once run is terminated
+	c.Stop()
+}
@@ -15,19 +15,22 @@ import (
 )
 
 type Tail struct {
+	dnsutils.ReadyState
 	done    chan bool
 	tailf   *tail.Tail
 	loggers []dnsutils.Worker
 	config  *dnsutils.Config
 	logger  *logger.Logger
+	name    string
 }
 
-func NewTail(loggers []dnsutils.Worker, config *dnsutils.Config, logger *logger.Logger) *Tail {
+func NewTail(loggers []dnsutils.Worker, config *dnsutils.Config, logger *logger.Logger, name string) *Tail {
 	s := &Tail{
 		done:    make(chan bool),
 		config:  config,
 		loggers: loggers,
 		logger:  logger,
+		name:    name,
 	}
 	s.ReadConfig()
 	return s
@@ -57,6 +60,19 @@ func (c *Tail) Channel() chan dnsutils.DnsMessage {
 	return nil
 }
 
+// Release stops following the file, the lines not read are discarded after a failure of run
+func (c *Tail) Release() {
+	if c.tailf == nil {
+		return
+	}
+	tailf := c.tailf
+	go func() {
+		for range tailf.Lines {
+		}
+	}()
+	tailf.Stop()
+}
+
 func (c *Tail) Stop() {
 	c.LogInfo("stopping...")
 
@@ -84,25 +100,16 @@ func (c *Tail) Run() {
 	c.LogInfo("starting collector...")
 	err := c.Follow()
 	if err != nil {
-		c.logger.Fatal("collector tail - unable to follow file: ", err)
+		panic(fmt.Sprintf("unable to follow file: %v", err))
 	}
+	c.SetReady(true)
 
-	// geoip
-	geoip := subprocessors.NewDnsGeoIpProcessor(c.config, c.logger)
-	if err := geoip.Open(); err != nil {
-		c.LogError("geoip init failed: %v+", err)
-	}
-	if geoip.IsEnabled() {
-		c.LogInfo("geoip is enabled")
-	}
-	defer geoip.Close()
-
-	// filtering
-	filtering := subprocessors.NewFilteringProcessor(c.config, c.logger)
+	// transforms applied on all dns messages
+	transforms := subprocessors.NewTransforms(c.config, c.logger)
+	defer transforms.Reset()
 
-	// user privacy
-	ipPrivacy := subprocessors.NewIpAnonymizerSubprocessor(c.config)
-	qnamePrivacy := subprocessors.NewQnameReducerSubprocessor(c.config)
+	// lines with an invalid timestamp
+	decodeErrors := dnsutils.Telemetry.Get(dnsutils.MetricDecodeErrors, c.name)
 
 	dm := dnsutils.DnsMessage{}
 	dm.Init()
@@ -140,6 +147,7 @@ func (c *Tail) Run() {
 		if timestampIndex != -1 {
 			t, err = time.Parse(c.config.Collectors.Tail.TimeLayout, matches[timestampIndex])
 			if err != nil {
+				decodeErrors.Inc()
 				continue
 			}
 		} else {
@@ -245,34 +253,11 @@ func (c *Tail) Run() {
 		dm.DNS.Payload, _ = dnspkt.Pack()
 		dm.DNS.Length = len(dm.DNS.Payload)
 
-		// qname privacy
-		if qnamePrivacy.IsEnabled() {
-			dm.DNS.Qname = qnamePrivacy.Minimaze(dm.DNS.Qname)
-		}
-
-		// filtering
-		if filtering.CheckIfDrop(&dm) {
+		// apply all transforms, the message can be dropped
+		if transforms.ProcessMessage(&dm) {
 			continue
 		}
 
-		// geoip feature
-		if geoip.IsEnabled() {
-			geoInfo, err := geoip.Lookup(dm.NetworkInfo.QueryIp)
-			if err != nil {
-				c.LogError("geoip loopkup failed: %v+", err)
-			}
-			dm.Geo.Continent = geoInfo.Continent
-			dm.Geo.CountryIsoCode = geoInfo.CountryISOCode
-			dm.Geo.City = geoInfo.City
-			dm.NetworkInfo.AutonomousSystemNumber = geoInfo.ASN
-			dm.NetworkInfo.AutonomousSystemOrg = geoInfo.ASO
-		}
-
-		// ip anonymisation ?
-		if ipPrivacy.IsEnabled() {
-			dm.NetworkInfo.QueryIp = ipPrivacy.Anonymize(dm.NetworkInfo.QueryIp)
-		}
-
 		// send to loggers
 		chanLoggers := c.Loggers()
 		for i := range chanLoggers {
@@ -280,6 +265,13 @@ func (c *Tail) Run() {
 		}
 	}
 
+	// the lines channel is also closed when the file can't be followed anymore,
+	// the collector is then restarted by the supervisor
+	if err := c.tailf.Wait(); err != nil {
+		panic(fmt.Sprintf("unable to follow file: %v", err))
+	}
+
+	c.SetReady(false)
 	c.LogInfo("run terminated")
 	c.done <- true
 }
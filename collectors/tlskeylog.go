@@ -0,0 +1,125 @@
+package collectors
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// the secrets not used are forgotten, the sessions are decrypted soon after the handshake
+	tlsKeyLogRetention = 10 * time.Minute
+)
+
+// tlsSecrets are the secrets of a session by label
+type tlsSecrets struct {
+	labels map[string][]byte
+	added  time.Time
+}
+
+// tlsKeyLog reads the secrets of the tls sessions from a key log file in the NSS format
+// written by the resolver, the new lines are read when a secret is missing
+type tlsKeyLog struct {
+	path    string
+	offset  int64
+	secrets map[string]*tlsSecrets
+	purged  time.Time
+}
+
+func newTlsKeyLog(path string) *tlsKeyLog {
+	return &tlsKeyLog{path: path, secrets: make(map[string]*tlsSecrets), purged: time.Now()}
+}
+
+// Secret returns the secret of the label for the session of the client random
+func (k *tlsKeyLog) Secret(label string, clientRandom []byte) ([]byte, bool) {
+	key := string(clientRandom)
+	if s, ok := k.secrets[key]; ok {
+		if secret, ok := s.labels[label]; ok {
+			return secret, true
+		}
+	}
+
+	if err := k.Reload(); err != nil {
+		return nil, false
+	}
+	s, ok := k.secrets[key]
+	if !ok {
+		return nil, false
+	}
+	secret, ok := s.labels[label]
+	return secret, ok
+}
+
+// Forget removes the secrets of the session when the connection is closed
+func (k *tlsKeyLog) Forget(clientRandom []byte) {
+	delete(k.secrets, string(clientRandom))
+}
+
+// Reload reads the complete lines added since the last read, the file is read again
+// from the start when truncated
+func (k *tlsKeyLog) Reload() error {
+	f, err := os.Open(k.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fileinfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if fileinfo.Size() == k.offset {
+		return nil
+	}
+	if fileinfo.Size() < k.offset {
+		k.offset = 0
+	}
+
+	if _, err := f.Seek(k.offset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	// the last line can be partially written
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil
+	}
+	k.offset += int64(end + 1)
+
+	now := time.Now()
+	if now.Sub(k.purged) > tlsKeyLogRetention {
+		for key, s := range k.secrets {
+			if now.Sub(s.added) > tlsKeyLogRetention {
+				delete(k.secrets, key)
+			}
+		}
+		k.purged = now
+	}
+
+	for _, line := range strings.Split(string(data[:end]), "\n") {
+		// <label> <client random> <secret>, the comments start with #
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		clientRandom, err1 := hex.DecodeString(fields[1])
+		secret, err2 := hex.DecodeString(fields[2])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		s, ok := k.secrets[string(clientRandom)]
+		if !ok {
+			s = &tlsSecrets{labels: make(map[string][]byte), added: now}
+			k.secrets[string(clientRandom)] = s
+		}
+		s.labels[fields[0]] = secret
+	}
+	return nil
+}
@@ -0,0 +1,458 @@
+package collectors
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	tlsRecordChangeCipherSpec = 20
+	tlsRecordHandshake        = 22
+	tlsRecordApplicationData  = 23
+
+	tlsHandshakeClientHello = 1
+	tlsHandshakeServerHello = 2
+	tlsHandshakeFinished    = 20
+	tlsHandshakeKeyUpdate   = 24
+
+	tlsVersion12 = 0x0303
+	tlsVersion13 = 0x0304
+
+	tlsExtensionSupportedVersions = 43
+
+	tlsMaxRecordSize = 16384 + 2048
+
+	// the encrypted records waiting for the keys of the key log are limited
+	tlsMaxPendingRecords = 64
+)
+
+var (
+	errTlsInvalidRecord          = errors.New("invalid tls record")
+	errTlsUnsupportedCipherSuite = errors.New("unsupported tls cipher suite")
+	errTlsUnsupportedVersion     = errors.New("unsupported tls version")
+	errTlsMissingSecret          = errors.New("tls secret not found in the key log")
+
+	// a server hello with this random is a hello retry request of tls 1.3
+	tlsHelloRetryRandom = []byte{
+		0xcf, 0x21, 0xad, 0x74, 0xe5, 0x9a, 0x61, 0x11, 0xbe, 0x1d, 0x8c, 0x02, 0x1e, 0x65, 0xb8, 0x91,
+		0xc2, 0xa2, 0x11, 0x16, 0x7a, 0xbb, 0x8c, 0x5e, 0x07, 0x9e, 0x09, 0xe2, 0xc8, 0xa8, 0x33, 0x9c,
+	}
+)
+
+// tlsCipherSuite describes the aead cipher suites, the other suites can't be decrypted
+type tlsCipherSuite struct {
+	keyLen int
+	// fixed part of the nonce, followed by an explicit nonce in the records with aes-gcm in tls 1.2
+	ivLen int
+	hash  func() hash.Hash
+	aead  func(key []byte) (cipher.AEAD, error)
+}
+
+func tlsAesGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+var tlsCipherSuites = map[uint16]tlsCipherSuite{
+	// tls 1.3
+	0x1301: {keyLen: 16, ivLen: 12, hash: sha256.New, aead: tlsAesGcm},
+	0x1302: {keyLen: 32, ivLen: 12, hash: sha512.New384, aead: tlsAesGcm},
+	0x1303: {keyLen: 32, ivLen: 12, hash: sha256.New, aead: chacha20poly1305.New},
+	// tls 1.2
+	0x009c: {keyLen: 16, ivLen: 4, hash: sha256.New, aead: tlsAesGcm},
+	0x009d: {keyLen: 32, ivLen: 4, hash: sha512.New384, aead: tlsAesGcm},
+	0xc02b: {keyLen: 16, ivLen: 4, hash: sha256.New, aead: tlsAesGcm},
+	0xc02c: {keyLen: 32, ivLen: 4, hash: sha512.New384, aead: tlsAesGcm},
+	0xc02f: {keyLen: 16, ivLen: 4, hash: sha256.New, aead: tlsAesGcm},
+	0xc030: {keyLen: 32, ivLen: 4, hash: sha512.New384, aead: tlsAesGcm},
+	0xcca8: {keyLen: 32, ivLen: 12, hash: sha256.New, aead: chacha20poly1305.New},
+	0xcca9: {keyLen: 32, ivLen: 12, hash: sha256.New, aead: chacha20poly1305.New},
+}
+
+// tlsExpandLabel is the HKDF-Expand-Label function of tls 1.3 with an empty context
+func tlsExpandLabel(h func() hash.Hash, secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+	info := []byte{byte(length >> 8), byte(length), byte(len(label))}
+	info = append(info, label...)
+	info = append(info, 0)
+
+	out := make([]byte, length)
+	io.ReadFull(hkdf.Expand(h, secret, info), out)
+	return out
+}
+
+// tlsPrf12 is the pseudo random function of tls 1.2
+func tlsPrf12(h func() hash.Hash, secret []byte, label string, seed []byte, length int) []byte {
+	seed = append([]byte(label), seed...)
+	mac := hmac.New(h, secret)
+	mac.Write(seed)
+	a := mac.Sum(nil)
+
+	out := make([]byte, 0, length+mac.Size())
+	for len(out) < length {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(seed)
+		out = mac.Sum(out)
+
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+	return out[:length]
+}
+
+// tlsDirection is the state of the records sent by the client or by the server
+type tlsDirection struct {
+	client bool
+	buf    []byte
+	// encrypted records waiting for the handshake or for the keys
+	pending [][]byte
+	seen    []time.Time
+	// tls 1.2 records are encrypted after the change cipher spec
+	encrypted bool
+	// tls 1.3 handshake done, the application traffic secret is used
+	application bool
+	handshake   []byte
+	secret      []byte
+	aead        cipher.AEAD
+	iv          []byte
+	seq         uint64
+	// decrypted application data
+	output func(data []byte, seen time.Time) error
+}
+
+// tlsSession follows the records of both directions of a tls connection and decrypts the
+// application data with the secrets of the key log, only the aead cipher suites are supported
+type tlsSession struct {
+	keylog       *tlsKeyLog
+	clientRandom []byte
+	serverRandom []byte
+	version      uint16
+	suite        *tlsCipherSuite
+	client       tlsDirection
+	server       tlsDirection
+}
+
+func newTlsSession(keylog *tlsKeyLog) *tlsSession {
+	return &tlsSession{keylog: keylog, client: tlsDirection{client: true}}
+}
+
+func (s *tlsSession) Direction(fromClient bool) *tlsDirection {
+	if fromClient {
+		return &s.client
+	}
+	return &s.server
+}
+
+// Feed reads the complete records of the direction, the encrypted records are decrypted
+// as soon as the handshake is known and the secrets are in the key log
+func (s *tlsSession) Feed(fromClient bool, data []byte, seen time.Time) error {
+	d := s.Direction(fromClient)
+	d.buf = append(d.buf, data...)
+
+	for len(d.buf) >= 5 {
+		length := int(binary.BigEndian.Uint16(d.buf[3:5]))
+		if length > tlsMaxRecordSize {
+			return errTlsInvalidRecord
+		}
+		if len(d.buf) < 5+length {
+			break
+		}
+
+		record := make([]byte, 5+length)
+		copy(record, d.buf)
+		d.buf = d.buf[5+length:]
+
+		if err := s.HandleRecord(d, record, seen); err != nil {
+			return err
+		}
+	}
+	if len(d.buf) == 0 {
+		d.buf = nil
+	}
+
+	// the records of the other direction can wait for the server hello
+	if err := s.Decrypt(&s.client); err != nil {
+		return err
+	}
+	return s.Decrypt(&s.server)
+}
+
+func (s *tlsSession) HandleRecord(d *tlsDirection, record []byte, seen time.Time) error {
+	switch {
+	case record[0] == tlsRecordChangeCipherSpec:
+		// the middlebox compatibility records of tls 1.3 are ignored
+		if s.version != tlsVersion13 {
+			d.encrypted = true
+		}
+		return nil
+
+	case record[0] == tlsRecordHandshake && !d.encrypted:
+		return s.HandleHello(record[5:])
+
+	case d.encrypted || record[0] == tlsRecordApplicationData:
+		if len(d.pending) >= tlsMaxPendingRecords {
+			return errTlsMissingSecret
+		}
+		d.pending = append(d.pending, record)
+		d.seen = append(d.seen, seen)
+	}
+	return nil
+}
+
+// HandleHello reads the randoms, the version and the cipher suite of the session
+func (s *tlsSession) HandleHello(data []byte) error {
+	// handshake type, length, legacy version and random
+	if len(data) < 4+2+32 {
+		return nil
+	}
+	body := data[4:]
+	random := body[2:34]
+
+	switch data[0] {
+	case tlsHandshakeClientHello:
+		s.clientRandom = append([]byte{}, random...)
+
+	case tlsHandshakeServerHello:
+		if bytes.Equal(random, tlsHelloRetryRandom) {
+			return nil
+		}
+		s.serverRandom = append([]byte{}, random...)
+		s.version = binary.BigEndian.Uint16(body[0:2])
+
+		// session id, cipher suite, compression method and extensions
+		p := body[34:]
+		if len(p) < 1 || len(p) < 1+int(p[0])+3 {
+			return errTlsInvalidRecord
+		}
+		p = p[1+int(p[0]):]
+		suite, ok := tlsCipherSuites[binary.BigEndian.Uint16(p[0:2])]
+		if !ok {
+			return errTlsUnsupportedCipherSuite
+		}
+		s.suite = &suite
+		p = p[3:]
+
+		if len(p) >= 2 {
+			p = p[2:]
+			for len(p) >= 4 {
+				typ, length := binary.BigEndian.Uint16(p[0:2]), int(binary.BigEndian.Uint16(p[2:4]))
+				if len(p) < 4+length {
+					return errTlsInvalidRecord
+				}
+				if typ == tlsExtensionSupportedVersions && length == 2 {
+					s.version = binary.BigEndian.Uint16(p[4:6])
+				}
+				p = p[4+length:]
+			}
+		}
+		if s.version != tlsVersion12 && s.version != tlsVersion13 {
+			return errTlsUnsupportedVersion
+		}
+	}
+	return nil
+}
+
+// SetupKeys derives the keys of the direction, false is returned while the handshake
+// or the secrets are missing
+func (s *tlsSession) SetupKeys(d *tlsDirection) (bool, error) {
+	if s.suite == nil || s.clientRandom == nil {
+		return false, nil
+	}
+
+	var key []byte
+	switch s.version {
+	case tlsVersion12:
+		master, ok := s.keylog.Secret("CLIENT_RANDOM", s.clientRandom)
+		if !ok {
+			return false, nil
+		}
+		seed := append(append([]byte{}, s.serverRandom...), s.clientRandom...)
+		keyBlock := tlsPrf12(s.suite.hash, master, "key expansion", seed, 2*s.suite.keyLen+2*s.suite.ivLen)
+		if d.client {
+			key = keyBlock[:s.suite.keyLen]
+			d.iv = keyBlock[2*s.suite.keyLen : 2*s.suite.keyLen+s.suite.ivLen]
+		} else {
+			key = keyBlock[s.suite.keyLen : 2*s.suite.keyLen]
+			d.iv = keyBlock[2*s.suite.keyLen+s.suite.ivLen:]
+		}
+
+	case tlsVersion13:
+		if d.secret == nil {
+			label := "SERVER_HANDSHAKE_TRAFFIC_SECRET"
+			switch {
+			case d.client && d.application:
+				label = "CLIENT_TRAFFIC_SECRET_0"
+			case d.client:
+				label = "CLIENT_HANDSHAKE_TRAFFIC_SECRET"
+			case d.application:
+				label = "SERVER_TRAFFIC_SECRET_0"
+			}
+			secret, ok := s.keylog.Secret(label, s.clientRandom)
+			if !ok {
+				return false, nil
+			}
+			d.secret = secret
+		}
+		key = tlsExpandLabel(s.suite.hash, d.secret, "key", s.suite.keyLen)
+		d.iv = tlsExpandLabel(s.suite.hash, d.secret, "iv", s.suite.ivLen)
+	}
+
+	aead, err := s.suite.aead(key)
+	if err != nil {
+		return false, err
+	}
+	d.aead = aead
+	d.seq = 0
+	return true, nil
+}
+
+// Decrypt decrypts the pending records of the direction in order
+func (s *tlsSession) Decrypt(d *tlsDirection) error {
+	for len(d.pending) > 0 {
+		if d.aead == nil {
+			ready, err := s.SetupKeys(d)
+			if err != nil {
+				return err
+			}
+			if !ready {
+				return nil
+			}
+		}
+
+		record, seen := d.pending[0], d.seen[0]
+		d.pending, d.seen = d.pending[1:], d.seen[1:]
+
+		var err error
+		if s.version == tlsVersion13 {
+			err = s.DecryptRecord13(d, record, seen)
+		} else {
+			err = s.DecryptRecord12(d, record, seen)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	d.pending, d.seen = nil, nil
+	return nil
+}
+
+func (s *tlsSession) Nonce(d *tlsDirection) []byte {
+	nonce := append([]byte{}, d.iv...)
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(d.seq >> (8 * i))
+	}
+	return nonce
+}
+
+func (s *tlsSession) DecryptRecord12(d *tlsDirection, record []byte, seen time.Time) error {
+	nonce, ciphertext := []byte{}, record[5:]
+	if s.suite.ivLen == 4 {
+		// explicit nonce of aes-gcm
+		if len(ciphertext) < 8 {
+			return errTlsInvalidRecord
+		}
+		nonce = append(append(nonce, d.iv...), ciphertext[:8]...)
+		ciphertext = ciphertext[8:]
+	} else {
+		nonce = s.Nonce(d)
+	}
+	if len(ciphertext) < d.aead.Overhead() {
+		return errTlsInvalidRecord
+	}
+
+	// sequence number, type, version and length of the plaintext
+	ad := make([]byte, 13)
+	binary.BigEndian.PutUint64(ad, d.seq)
+	copy(ad[8:11], record[:3])
+	binary.BigEndian.PutUint16(ad[11:], uint16(len(ciphertext)-d.aead.Overhead()))
+
+	plaintext, err := d.aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return err
+	}
+	d.seq++
+
+	if record[0] == tlsRecordApplicationData && d.output != nil {
+		return d.output(plaintext, seen)
+	}
+	return nil
+}
+
+func (s *tlsSession) DecryptRecord13(d *tlsDirection, record []byte, seen time.Time) error {
+	plaintext, err := d.aead.Open(nil, s.Nonce(d), record[5:], record[:5])
+	if err != nil {
+		return err
+	}
+	d.seq++
+
+	// the content type follows the content and is followed by the padding
+	end := len(plaintext) - 1
+	for end >= 0 && plaintext[end] == 0 {
+		end--
+	}
+	if end < 0 {
+		return errTlsInvalidRecord
+	}
+
+	switch plaintext[end] {
+	case tlsRecordApplicationData:
+		if d.application && d.output != nil {
+			return d.output(plaintext[:end], seen)
+		}
+	case tlsRecordHandshake:
+		return s.HandleHandshake13(d, plaintext[:end])
+	}
+	return nil
+}
+
+// HandleHandshake13 switches to the application traffic secret after the finished message
+// and to the next secret after a key update
+func (s *tlsSession) HandleHandshake13(d *tlsDirection, data []byte) error {
+	d.handshake = append(d.handshake, data...)
+	for len(d.handshake) >= 4 {
+		length := int(d.handshake[1])<<16 | int(d.handshake[2])<<8 | int(d.handshake[3])
+		if len(d.handshake) < 4+length {
+			break
+		}
+		typ := d.handshake[0]
+		d.handshake = d.handshake[4+length:]
+
+		switch {
+		case typ == tlsHandshakeFinished && !d.application:
+			d.application = true
+			d.secret = nil
+			d.aead = nil
+		case typ == tlsHandshakeKeyUpdate && d.application:
+			d.secret = tlsExpandLabel(s.suite.hash, d.secret, "traffic upd", s.suite.hash().Size())
+			d.aead = nil
+		}
+	}
+	if len(d.handshake) == 0 {
+		d.handshake = nil
+	}
+
+	// the next records are decrypted with the new keys
+	if d.aead == nil {
+		if _, err := s.SetupKeys(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package collectors
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/subprocessors"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// tlsChunk is the data sent in one direction of the connection
+type tlsChunk struct {
+	fromClient bool
+	data       []byte
+}
+
+// recordingConn records the bytes sent and received by the client in order
+type recordingConn struct {
+	net.Conn
+	mu     sync.Mutex
+	chunks []tlsChunk
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.record(false, b[:n])
+	return n, err
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.record(true, b[:n])
+	return n, err
+}
+
+func (c *recordingConn) record(fromClient bool, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	c.mu.Lock()
+	c.chunks = append(c.chunks, tlsChunk{fromClient: fromClient, data: append([]byte{}, data...)})
+	c.mu.Unlock()
+}
+
+func fakeTlsCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("key error: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("certificate error: %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func fakeKeyLog(t *testing.T) *os.File {
+	f, err := os.Create(filepath.Join(t.TempDir(), "keylog.txt"))
+	if err != nil {
+		t.Fatalf("keylog error: %s", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// fakeDotSession sends the queries to a dns over tls server replying with the same messages
+func fakeDotSession(t *testing.T, config *tls.Config, queries [][]byte) []tlsChunk {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{fakeTlsCertificate(t)}})
+	if err != nil {
+		t.Fatalf("listen error: %s", err)
+	}
+	defer listener.Close()
+
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			hdr := make([]byte, 2)
+			if _, err := io.ReadFull(conn, hdr); err != nil {
+				return
+			}
+			msg := make([]byte, binary.BigEndian.Uint16(hdr))
+			if _, err := io.ReadFull(conn, msg); err != nil {
+				return
+			}
+			msg[2] |= 0x80
+			conn.Write(append(hdr, msg...))
+		}
+	}()
+
+	tcpConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial error: %s", err)
+	}
+	recorder := &recordingConn{Conn: tcpConn}
+	conn := tls.Client(recorder, config)
+	for _, query := range queries {
+		msg := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(msg, uint16(len(query)))
+		copy(msg[2:], query)
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatalf("write error: %s", err)
+		}
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			t.Fatalf("read error: %s", err)
+		}
+	}
+	conn.Close()
+	<-done
+
+	return recorder.chunks
+}
+
+// feedTlsSession passes the chunks of the connection to the streams of the factory
+func feedTlsSession(factory *dnsStreamFactory, serverPort uint16, chunks []tlsChunk) {
+	netFlow := gopacket.NewFlow(layers.EndpointIPv4, net.ParseIP("192.168.1.1").To4(), net.ParseIP("192.168.1.254").To4())
+	tcpFlow := gopacket.NewFlow(layers.EndpointTCPPort, []byte{0xa4, 0x10}, []byte{byte(serverPort >> 8), byte(serverPort)})
+
+	client := factory.New(netFlow, tcpFlow)
+	server := factory.New(netFlow.Reverse(), tcpFlow.Reverse())
+	for _, c := range chunks {
+		stream := server
+		if c.fromClient {
+			stream = client
+		}
+		stream.Reassembled([]tcpassembly.Reassembly{{Bytes: c.data, Seen: time.Now()}})
+	}
+	client.ReassemblyComplete()
+	server.ReassemblyComplete()
+}
+
+func fakeTlsFactory(keylog string) (*dnsStreamFactory, *[]dnsutils.DnsMessage) {
+	messages := &[]dnsutils.DnsMessage{}
+	factory := &dnsStreamFactory{
+		handler:      func(dm dnsutils.DnsMessage) { *messages = append(*messages, dm) },
+		decodeErrors: &dnsutils.TelemetryValue{},
+		keylog:       newTlsKeyLog(keylog),
+		dotPort:      853,
+		dohPort:      443,
+		sessions:     make(map[string]*tlsSessionState),
+	}
+	return factory, messages
+}
+
+func TestTlsSessionDot(t *testing.T) {
+	dnsquery, err := subprocessors.GetFakeDns()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+
+	configs := []struct {
+		name    string
+		version uint16
+		suites  []uint16
+	}{
+		{name: "tls 1.3", version: tls.VersionTLS13},
+		{name: "tls 1.2 aes-gcm", version: tls.VersionTLS12, suites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}},
+		{name: "tls 1.2 chacha20-poly1305", version: tls.VersionTLS12, suites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256}},
+	}
+	for _, c := range configs {
+		keylog := fakeKeyLog(t)
+		chunks := fakeDotSession(t, &tls.Config{
+			InsecureSkipVerify: true,
+			MaxVersion:         c.version,
+			CipherSuites:       c.suites,
+			KeyLogWriter:       keylog,
+		}, [][]byte{dnsquery, dnsquery})
+
+		factory, messages := fakeTlsFactory(keylog.Name())
+		feedTlsSession(factory, 853, chunks)
+
+		if len(*messages) != 4 {
+			t.Fatalf("%s: want 4 dns messages, got %d", c.name, len(*messages))
+		}
+		queries := 0
+		for _, dm := range *messages {
+			if dm.NetworkInfo.Protocol != "DOT" {
+				t.Errorf("%s: invalid protocol: %s", c.name, dm.NetworkInfo.Protocol)
+			}
+			if dm.NetworkInfo.QueryPort == "42000" {
+				queries++
+				if !bytes.Equal(dm.DNS.Payload, dnsquery) {
+					t.Errorf("%s: invalid query decrypted", c.name)
+				}
+			}
+		}
+		if queries != 2 {
+			t.Errorf("%s: want 2 queries, got %d", c.name, queries)
+		}
+		if factory.decodeErrors.Get() != 0 {
+			t.Errorf("%s: unexpected decode errors: %d", c.name, factory.decodeErrors.Get())
+		}
+		if len(factory.sessions) != 0 || len(factory.keylog.secrets) != 0 {
+			t.Errorf("%s: the session should be removed once closed", c.name)
+		}
+	}
+}
+
+func TestTlsSessionMissingSecrets(t *testing.T) {
+	dnsquery, err := subprocessors.GetFakeDns()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+
+	// the secrets are written in another key log
+	chunks := fakeDotSession(t, &tls.Config{InsecureSkipVerify: true, KeyLogWriter: io.Discard}, [][]byte{dnsquery})
+
+	factory, messages := fakeTlsFactory(fakeKeyLog(t).Name())
+	feedTlsSession(factory, 853, chunks)
+	if len(*messages) != 0 {
+		t.Errorf("no dns message expected without the secrets, got %d", len(*messages))
+	}
+}
+
+func TestTlsSessionDoh(t *testing.T) {
+	dnsquery, err := subprocessors.GetFakeDns()
+	if err != nil {
+		t.Fatalf("dns question pack error")
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/dns-message")
+		reply := append([]byte{}, dnsquery...)
+		reply[2] |= 0x80
+		w.Write(reply)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	keylog := fakeKeyLog(t)
+	var recorder *recordingConn
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.KeyLogWriter = keylog
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		recorder = &recordingConn{Conn: conn}
+		return recorder, nil
+	}
+	client := &http.Client{Transport: transport}
+
+	// a query with the POST method, then with the GET method
+	resp, err := client.Post(server.URL+"/dns-query", "application/dns-message", bytes.NewReader(dnsquery))
+	if err != nil {
+		t.Fatalf("post error: %s", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("http/2 expected, got %s", resp.Proto)
+	}
+
+	resp, err = client.Get(server.URL + "/dns-query?dns=" + base64.RawURLEncoding.EncodeToString(dnsquery))
+	if err != nil {
+		t.Fatalf("get error: %s", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	transport.CloseIdleConnections()
+
+	factory, messages := fakeTlsFactory(keylog.Name())
+	recorder.mu.Lock()
+	feedTlsSession(factory, 443, recorder.chunks)
+	recorder.mu.Unlock()
+
+	if len(*messages) != 4 {
+		t.Fatalf("want 4 dns messages, got %d", len(*messages))
+	}
+	for _, dm := range *messages {
+		if dm.NetworkInfo.Protocol != "DOH" {
+			t.Errorf("invalid protocol: %s", dm.NetworkInfo.Protocol)
+		}
+		if dm.NetworkInfo.QueryPort == "42000" && !bytes.Equal(dm.DNS.Payload, dnsquery) {
+			t.Errorf("invalid query decrypted")
+		}
+	}
+	if factory.decodeErrors.Get() != 0 {
+		t.Errorf("unexpected decode errors: %d", factory.decodeErrors.Get())
+	}
+}
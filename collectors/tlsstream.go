@@ -0,0 +1,111 @@
+package collectors
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/tcpassembly"
+)
+
+// tlsSessionState is shared by the streams of both directions of a tls connection
+type tlsSessionState struct {
+	session *tlsSession
+	failed  bool
+	streams int
+}
+
+// tlsStream decrypts one direction of a dns over tls or dns over https connection
+type tlsStream struct {
+	key        string
+	fromClient bool
+	state      *tlsSessionState
+	factory    *dnsStreamFactory
+}
+
+// NewTlsStream returns the stream of the direction when the client or the server port is
+// the dns over tls or the dns over https port, nil is returned otherwise
+func (f *dnsStreamFactory) NewTlsStream(netFlow, tcpFlow gopacket.Flow) tcpassembly.Stream {
+	srcPort, dstPort := tcpFlow.Endpoints()
+	src := int(binary.BigEndian.Uint16(srcPort.Raw()))
+	dst := int(binary.BigEndian.Uint16(dstPort.Raw()))
+
+	var fromClient bool
+	var serverPort int
+	switch {
+	case dst == f.dotPort || dst == f.dohPort:
+		fromClient, serverPort = true, dst
+	case src == f.dotPort || src == f.dohPort:
+		fromClient, serverPort = false, src
+	default:
+		return nil
+	}
+
+	// the session is identified by the flows from the client to the server
+	key := netFlow.String() + " " + tcpFlow.String()
+	if !fromClient {
+		key = netFlow.Reverse().String() + " " + tcpFlow.Reverse().String()
+	}
+	state, ok := f.sessions[key]
+	if !ok {
+		state = &tlsSessionState{session: newTlsSession(f.keylog)}
+		f.sessions[key] = state
+	}
+	state.streams++
+
+	d := state.session.Direction(fromClient)
+	if serverPort == f.dotPort {
+		// dns messages prefixed by their length like dns over tcp
+		var buf []byte
+		d.output = func(data []byte, seen time.Time) error {
+			buf = extractDnsMessages(append(buf, data...), func(payload []byte) {
+				f.handler(newStreamMessage(netFlow, tcpFlow, "DOT", payload, seen))
+			})
+			return nil
+		}
+	} else {
+		parser := newDohParser(fromClient)
+		d.output = func(data []byte, seen time.Time) error {
+			return parser.Feed(data, func(payload []byte) {
+				f.handler(newStreamMessage(netFlow, tcpFlow, "DOH", payload, seen))
+			})
+		}
+	}
+
+	return &tlsStream{key: key, fromClient: fromClient, state: state, factory: f}
+}
+
+func (s *tlsStream) Reassembled(reassemblies []tcpassembly.Reassembly) {
+	for _, r := range reassemblies {
+		if s.state.failed {
+			return
+		}
+
+		// the records can't be decrypted when bytes are missing, the start of the connections
+		// established before the capture is always missing
+		if r.Skip != 0 {
+			if r.Skip > 0 {
+				s.factory.decodeErrors.Inc()
+			}
+			s.state.failed = true
+			return
+		}
+
+		if err := s.state.session.Feed(s.fromClient, r.Bytes, r.Seen); err != nil {
+			s.factory.decodeErrors.Inc()
+			s.state.failed = true
+		}
+	}
+}
+
+func (s *tlsStream) ReassemblyComplete() {
+	// the session is removed when both directions are closed
+	s.state.streams--
+	if s.state.streams > 0 {
+		return
+	}
+	delete(s.factory.sessions, s.key)
+	if s.state.session.clientRandom != nil {
+		s.factory.keylog.Forget(s.state.session.clientRandom)
+	}
+}
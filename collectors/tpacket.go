@@ -0,0 +1,92 @@
+package collectors
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// the packets are stored one after the other in the blocks with TPACKET_V3,
+	// the frame size is only used by the kernel to check the ring settings
+	tpacketFrameSize = 2048
+
+	// offset of the block header after the version and the private offset of the block descriptor
+	tpacketBlockHdrOffset = 8
+)
+
+var errRingClosed = errors.New("ring socket closed")
+
+// tpacketRing is a TPACKET_V3 ring buffer shared with the kernel, the kernel fills the blocks
+// with the packets captured and hands them over to the user space without any copy
+type tpacketRing struct {
+	fd        int
+	ring      []byte
+	blockSize int
+	blockNr   int
+	current   int
+}
+
+// newTpacketRing maps the ring buffer of the packet socket, a block is released by the kernel
+// when it's full or when the block timeout in milliseconds expires
+func newTpacketRing(fd int, blockSize int, blockNr int, blockTimeout int) (*tpacketRing, error) {
+	if err := unix.SetsockoptInt(fd, unix.SOL_PACKET, unix.PACKET_VERSION, unix.TPACKET_V3); err != nil {
+		return nil, err
+	}
+
+	req := &unix.TpacketReq3{
+		Block_size:     uint32(blockSize),
+		Block_nr:       uint32(blockNr),
+		Frame_size:     tpacketFrameSize,
+		Frame_nr:       uint32(blockSize / tpacketFrameSize * blockNr),
+		Retire_blk_tov: uint32(blockTimeout),
+	}
+	if err := unix.SetsockoptTpacketReq3(fd, unix.SOL_PACKET, unix.PACKET_RX_RING, req); err != nil {
+		return nil, err
+	}
+
+	ring, err := unix.Mmap(fd, 0, blockSize*blockNr, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tpacketRing{fd: fd, ring: ring, blockSize: blockSize, blockNr: blockNr}, nil
+}
+
+// ReadBlock waits up to the timeout in milliseconds for the next block and passes its packets
+// to the handler, the packet data is only valid until the handler returns because the block
+// is given back to the kernel once all the packets are handled
+func (r *tpacketRing) ReadBlock(timeout int, handler func(data []byte, ts time.Time)) error {
+	block := r.ring[r.current*r.blockSize : (r.current+1)*r.blockSize]
+	hdr := (*unix.TpacketHdrV1)(unsafe.Pointer(&block[tpacketBlockHdrOffset]))
+
+	if atomic.LoadUint32(&hdr.Block_status)&unix.TP_STATUS_USER == 0 {
+		fds := []unix.PollFd{{Fd: int32(r.fd), Events: unix.POLLIN | unix.POLLERR}}
+		if _, err := unix.Poll(fds, timeout); err != nil && err != unix.EINTR {
+			return err
+		}
+		if fds[0].Revents&unix.POLLNVAL != 0 {
+			return errRingClosed
+		}
+		return nil
+	}
+
+	offset := int(hdr.Offset_to_first_pkt)
+	for i := uint32(0); i < hdr.Num_pkts; i++ {
+		pkt := (*unix.Tpacket3Hdr)(unsafe.Pointer(&block[offset]))
+		start := offset + int(pkt.Mac)
+		handler(block[start:start+int(pkt.Snaplen)], time.Unix(int64(pkt.Sec), int64(pkt.Nsec)))
+		offset += int(pkt.Next_offset)
+	}
+
+	atomic.StoreUint32(&hdr.Block_status, unix.TP_STATUS_KERNEL)
+	r.current = (r.current + 1) % r.blockNr
+	return nil
+}
+
+func (r *tpacketRing) Close() error {
+	return unix.Munmap(r.ring)
+}
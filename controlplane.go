@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-logger"
+)
+
+// workerStatus is the state of a collector or a logger reported by the control plane
+type workerStatus struct {
+	State       string `json:"state"`
+	Ready       bool   `json:"ready"`
+	QueueLength int    `json:"queue-length,omitempty"`
+	QueueSize   int    `json:"queue-size,omitempty"`
+}
+
+type processStatus struct {
+	Status  string                  `json:"status"`
+	Workers map[string]workerStatus `json:"workers"`
+}
+
+func newWorkerStatus(name string, ready bool) workerStatus {
+	status := workerStatus{State: dnsutils.WorkerRunning, Ready: ready}
+	if health, ok := dnsutils.Health.Get(name); ok {
+		status.State = health.State
+	}
+	return status
+}
+
+// status returns the state of all the collectors and loggers. The process is alive if no worker has failed,
+// and ready if all the collectors are listening, all the loggers are connected and no queue is saturated.
+func (p *pipeline) status(maxQueueUsage int) (map[string]workerStatus, bool, bool) {
+	workers := map[string]workerStatus{}
+	alive, ready := true, true
+
+	for _, item := range p.collectors {
+		name := "collectors/" + item.name
+		status := newWorkerStatus(name, item.worker != nil && dnsutils.IsWorkerReady(item.worker))
+		workers[name] = status
+		alive = alive && status.State != dnsutils.WorkerFailed
+		ready = ready && status.Ready
+	}
+
+	for _, item := range p.loggers {
+		name := "loggers/" + item.name
+		if item.queue == nil {
+			workers[name] = newWorkerStatus(name, false)
+			ready = false
+			continue
+		}
+		status := newWorkerStatus(name, item.queue.IsReady())
+		status.QueueLength, status.QueueSize = item.queue.Usage()
+		if status.QueueLength*100 >= status.QueueSize*maxQueueUsage {
+			status.Ready = false
+		}
+		workers[name] = status
+		alive = alive && status.State != dnsutils.WorkerFailed
+		ready = ready && status.Ready
+	}
+	return workers, alive, ready
+}
+
+// controlPlane is the http server used by the liveness and readiness probes,
+// it is independent of the loggers
+type controlPlane struct {
+	sync.RWMutex
+	done     chan bool
+	listener net.Listener
+	pipeline *pipeline
+	config   *dnsutils.Config
+	logger   *logger.Logger
+}
+
+func newControlPlane(config *dnsutils.Config, console *logger.Logger) *controlPlane {
+	return &controlPlane{
+		done:   make(chan bool),
+		config: config,
+		logger: console,
+	}
+}
+
+func (c *controlPlane) LogInfo(msg string, v ...interface{}) {
+	c.logger.Info("control plane - "+msg, v...)
+}
+
+func (c *controlPlane) LogError(msg string, v ...interface{}) {
+	c.logger.Error("control plane - "+msg, v...)
+}
+
+// SetPipeline updates the collectors and loggers to report, nil when the process is starting or stopping
+func (c *controlPlane) SetPipeline(p *pipeline) {
+	c.Lock()
+	defer c.Unlock()
+	c.pipeline = p
+}
+
+func (c *controlPlane) writeStatus(w http.ResponseWriter, r *http.Request, readiness bool) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.RLock()
+	p := c.pipeline
+	c.RUnlock()
+
+	ret := processStatus{Status: "ok", Workers: map[string]workerStatus{}}
+	ok := true
+	if p == nil {
+		// not ready while starting or stopping
+		ok = !readiness
+	} else {
+		workers, alive, ready := p.status(c.config.ControlPlane.MaxQueueUsage)
+		ret.Workers = workers
+		ok = alive
+		if readiness {
+			ok = ready
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		ret.Status = "failed"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(ret)
+}
+
+func (c *controlPlane) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	c.writeStatus(w, r, false)
+}
+
+func (c *controlPlane) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	c.writeStatus(w, r, true)
+}
+
+func (c *controlPlane) Listen() error {
+	addrlisten := c.config.ControlPlane.ListenIP + ":" + strconv.Itoa(c.config.ControlPlane.ListenPort)
+	listener, err := net.Listen("tcp", addrlisten)
+	if err != nil {
+		return err
+	}
+	c.listener = listener
+	c.LogInfo("is listening on %s", listener.Addr())
+	return nil
+}
+
+func (c *controlPlane) Run() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", c.healthzHandler)
+	mux.HandleFunc("/readyz", c.readyzHandler)
+
+	http.Serve(c.listener, mux)
+	c.LogInfo("terminated")
+	c.done <- true
+}
+
+func (c *controlPlane) Stop() {
+	c.LogInfo("stopping...")
+	c.listener.Close()
+	<-c.done
+	close(c.done)
+}
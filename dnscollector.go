@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/dmachard/go-dnscollector/collectors"
@@ -21,11 +22,428 @@ func showVersion() {
 	fmt.Println(Version)
 }
 
+var loggerKinds = []string{"webserver", "prometheus", "stdout", "logfile", "dnstap", "tcpclient",
+	"syslog", "fluentd", "pcapfile", "dnstapfile", "influxdb", "lokiclient", "statsd"}
+var collectorKinds = []string{"dnstap", "dns-sniffer", "tail", "dns-proxy", "pcap-reader", "dnstap-reader"}
+
+func isKnownKind(kinds []string, kind string) bool {
+	for _, k := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func newLogger(kind string, name string, config *dnsutils.Config, logger *logger.Logger) (dnsutils.Worker, error) {
+	switch kind {
+	case "webserver":
+		return loggers.NewWebserver(config, logger, Version, name), nil
+	case "prometheus":
+		return loggers.NewPrometheus(config, logger, Version, name), nil
+	case "stdout":
+		return loggers.NewStdOut(config, logger, name), nil
+	case "logfile":
+		return loggers.NewLogFile(config, logger, name), nil
+	case "dnstap":
+		return loggers.NewDnstapSender(config, logger, name), nil
+	case "tcpclient":
+		return loggers.NewTcpClient(config, logger, name), nil
+	case "syslog":
+		return loggers.NewSyslog(config, logger, name), nil
+	case "fluentd":
+		return loggers.NewFluentdClient(config, logger, name), nil
+	case "pcapfile":
+		return loggers.NewPcapFile(config, logger, name), nil
+	case "dnstapfile":
+		return loggers.NewDnstapFile(config, logger, name), nil
+	case "influxdb":
+		return loggers.NewInfluxDBClient(config, logger, name), nil
+	case "lokiclient":
+		return loggers.NewLokiClient(config, logger, name), nil
+	case "statsd":
+		return loggers.NewStatsdClient(config, logger, Version, name), nil
+	}
+	return nil, fmt.Errorf("unknown logger type: %s", kind)
+}
+
+func newCollector(kind string, name string, logwrks []dnsutils.Worker, config *dnsutils.Config, logger *logger.Logger) (dnsutils.Worker, error) {
+	switch kind {
+	case "dnstap":
+		return collectors.NewDnstap(logwrks, config, logger, name), nil
+	case "dns-sniffer":
+		return collectors.NewDnsSniffer(logwrks, config, logger, name), nil
+	case "tail":
+		return collectors.NewTail(logwrks, config, logger, name), nil
+	case "dns-proxy":
+		return collectors.NewDnsProxy(logwrks, config, logger, name), nil
+	case "pcap-reader":
+		return collectors.NewPcapReader(logwrks, config, logger, name), nil
+	case "dnstap-reader":
+		return collectors.NewDnstapReader(logwrks, config, logger, name), nil
+	}
+	return nil, fmt.Errorf("unknown collector type: %s", kind)
+}
+
+// pipelineItem is a collector or a logger described in the configuration
+type pipelineItem struct {
+	name      string
+	kind      string
+	config    *dnsutils.Config
+	subcfg    *dnsutils.Config
+	signature string
+	routes    []string
+	// configurations used to create the running worker, the transforms are reloaded from them
+	initial    *dnsutils.Config
+	initialSub *dnsutils.Config
+	queue      *loggers.LoggerQueue
+	router     *loggers.LoggerRouter
+	worker     dnsutils.Worker
+}
+
+// pipeline holds all the collectors and loggers of a configuration
+type pipeline struct {
+	config     *dnsutils.Config
+	loggers    []*pipelineItem
+	collectors []*pipelineItem
+}
+
+// newPipeline validates the configuration and prepares the collectors and loggers without starting them
+func newPipeline(config *dnsutils.Config) (*pipeline, error) {
+	p := &pipeline{config: config}
+
+	// loggers from the loggers section are named according to the configuration key
+	addLogger := func(name string, kind string, cfg *dnsutils.Config, subcfg *dnsutils.Config) error {
+		if p.getLogger(name) != nil {
+			return fmt.Errorf("logger %s is defined several times", name)
+		}
+		if !isKnownKind(loggerKinds, kind) {
+			return fmt.Errorf("logger %s: unknown logger type: %s", name, kind)
+		}
+		signature, err := dnsutils.GetItemSignature("loggers", kind, cfg)
+		if err != nil {
+			return err
+		}
+		// adding or removing the dedicated transforms restarts the logger
+		signature += fmt.Sprintf("dedicated-subprocessors: %v\n", subcfg != nil)
+
+		p.loggers = append(p.loggers, &pipelineItem{name: name, kind: kind, config: cfg, subcfg: subcfg, signature: signature})
+		return nil
+	}
+
+	for _, kind := range config.GetEnabledLoggers() {
+		if err := addLogger(kind, kind, config, nil); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range config.Multiplexer.Loggers {
+		kind, itemcfg, err := dnsutils.GetItemConfig("loggers", config, item)
+		if err != nil {
+			return nil, err
+		}
+		subcfg, err := dnsutils.GetItemSubprocessors(config, item)
+		if err != nil {
+			return nil, err
+		}
+		if err := addLogger(item.Name, kind, itemcfg, subcfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// prepare collectors in the same way
+	addCollector := func(name string, kind string, cfg *dnsutils.Config) error {
+		if p.getCollector(name) != nil {
+			return fmt.Errorf("collector %s is defined several times", name)
+		}
+		if !isKnownKind(collectorKinds, kind) {
+			return fmt.Errorf("collector %s: unknown collector type: %s", name, kind)
+		}
+		signature, err := dnsutils.GetItemSignature("collectors", kind, cfg)
+		if err != nil {
+			return err
+		}
+		p.collectors = append(p.collectors, &pipelineItem{name: name, kind: kind, config: cfg, signature: signature})
+		return nil
+	}
+
+	for _, kind := range config.GetEnabledCollectors() {
+		if err := addCollector(kind, kind, config); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range config.Multiplexer.Collectors {
+		kind, subcfg, err := dnsutils.GetItemConfig("collectors", config, item)
+		if err != nil {
+			return nil, err
+		}
+		if err := addCollector(item.Name, kind, subcfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// resolve routes between collectors and loggers
+	var collnames, lognames []string
+	for _, item := range p.collectors {
+		collnames = append(collnames, item.name)
+	}
+	for _, item := range p.loggers {
+		lognames = append(lognames, item.name)
+	}
+	routes, err := dnsutils.GetRoutes(config.Routes, collnames, lognames)
+	if err != nil {
+		return nil, fmt.Errorf("routing error: %v", err)
+	}
+	for _, item := range p.collectors {
+		item.routes = routes[item.name]
+	}
+
+	return p, nil
+}
+
+func (p *pipeline) getLogger(name string) *pipelineItem {
+	for _, item := range p.loggers {
+		if item.name == name {
+			return item
+		}
+	}
+	return nil
+}
+
+func (p *pipeline) getCollector(name string) *pipelineItem {
+	for _, item := range p.collectors {
+		if item.name == name {
+			return item
+		}
+	}
+	return nil
+}
+
+// newLoggerWorker creates the logger and its dedicated transforms applied after the fan-out,
+// the logger is supervised and restarted on failure with the same options
+func (p *pipeline) newLoggerWorker(item *pipelineItem, console *logger.Logger) (dnsutils.Worker, error) {
+	factory := func() (dnsutils.Worker, error) {
+		return newLogger(item.kind, item.name, item.config, console)
+	}
+	w, err := factory()
+	if err != nil {
+		return nil, err
+	}
+	w = dnsutils.NewSupervisor("loggers/"+item.name, w, factory, p.config, console)
+
+	if item.subcfg != nil {
+		w = loggers.NewLoggerTransforms(item.name, w, item.subcfg, console)
+	}
+	item.initialSub = item.subcfg
+	return w, nil
+}
+
+// routedLoggers returns the queues of the loggers attached to the collector
+func (p *pipeline) routedLoggers(item *pipelineItem, console *logger.Logger) []dnsutils.Worker {
+	var wrks []dnsutils.Worker
+	for _, dst := range item.routes {
+		console.Info("main - route %s -> %s", item.name, dst)
+		wrks = append(wrks, p.getLogger(dst).queue)
+	}
+	return wrks
+}
+
+func (p *pipeline) startLogger(item *pipelineItem, console *logger.Logger) error {
+	w, err := p.newLoggerWorker(item, console)
+	if err != nil {
+		return fmt.Errorf("logger %s: %v", item.name, err)
+	}
+	// bounded queue between the collectors and the logger
+	item.queue = loggers.NewLoggerQueue(item.name, w, p.config, console)
+	go item.queue.Run()
+	return nil
+}
+
+func (p *pipeline) startCollector(item *pipelineItem, console *logger.Logger) error {
+	// the router is kept when the collector is restarted
+	if item.router == nil {
+		item.router = loggers.NewLoggerRouter(item.name, p.routedLoggers(item, console), console)
+		go item.router.Run()
+	}
+
+	// the collector is supervised and restarted on failure with the same options
+	config := item.config
+	router := item.router
+	factory := func() (dnsutils.Worker, error) {
+		return newCollector(item.kind, item.name, []dnsutils.Worker{router}, config, console)
+	}
+	w, err := factory()
+	if err != nil {
+		return fmt.Errorf("collector %s: %v", item.name, err)
+	}
+	item.worker = dnsutils.NewSupervisor("collectors/"+item.name, w, factory, p.config, console)
+	item.initial = config
+	go item.worker.Run()
+	return nil
+}
+
+// Start runs all the loggers then all the collectors
+func (p *pipeline) Start(console *logger.Logger) error {
+	for _, item := range p.loggers {
+		if err := p.startLogger(item, console); err != nil {
+			return err
+		}
+	}
+	for _, item := range p.collectors {
+		if err := p.startCollector(item, console); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop stops all the collectors then drains and stops all the loggers in parallel, the number
+// of messages lost by the queues on stop and by the loggers and the supervisors since startup
+// is returned
+func (p *pipeline) Stop() int {
+	for _, item := range p.collectors {
+		item.worker.Stop()
+		item.router.Stop()
+	}
+
+	var wg sync.WaitGroup
+	for _, item := range p.loggers {
+		wg.Add(1)
+		go func(item *pipelineItem) {
+			defer wg.Done()
+			item.queue.Stop()
+		}(item)
+	}
+	wg.Wait()
+
+	lost := int(dnsutils.Lost.Total())
+	for _, item := range p.loggers {
+		lost += item.queue.Lost()
+	}
+	return lost
+}
+
+// Reload applies the new pipeline on the running one, only the workers with new options are restarted,
+// the transforms of the other ones are reloaded in place
+func (p *pipeline) Reload(newp *pipeline, console *logger.Logger) {
+	// add new loggers, restart the updated ones, the queues are kept
+	for _, item := range newp.loggers {
+		cur := p.getLogger(item.name)
+		if cur == nil {
+			console.Info("main - reload: logger %s added", item.name)
+			if err := newp.startLogger(item, console); err != nil {
+				console.Error("main - reload: %v", err)
+			}
+			continue
+		}
+
+		item.queue = cur.queue
+		if item.signature != cur.signature {
+			console.Info("main - reload: logger %s restarted", item.name)
+			// the old logger is stopped before creating the new one, they can share the same resources
+			factory := func() (dnsutils.Worker, error) {
+				return newp.newLoggerWorker(item, console)
+			}
+			if err := item.queue.Reload(factory, newp.config); err != nil {
+				console.Error("main - reload: logger %s: %v", item.name, err)
+			}
+			continue
+		}
+
+		item.queue.Reload(nil, newp.config)
+		item.initialSub = cur.initialSub
+		if item.subcfg != nil {
+			cur.initialSub.ReloadTransforms(item.subcfg)
+		}
+	}
+
+	// stop the removed collectors and the updated ones
+	for _, cur := range p.collectors {
+		item := newp.getCollector(cur.name)
+		if item == nil {
+			console.Info("main - reload: collector %s removed", cur.name)
+			cur.worker.Stop()
+			cur.router.Stop()
+			dnsutils.Health.Remove("collectors/" + cur.name)
+			continue
+		}
+
+		item.router = cur.router
+		if item.signature != cur.signature {
+			console.Info("main - reload: collector %s restarted", cur.name)
+			cur.worker.Stop()
+		}
+	}
+
+	// start the new collectors and the updated ones, the routes of the other ones are updated
+	for _, item := range newp.collectors {
+		cur := p.getCollector(item.name)
+		if cur == nil || item.signature != cur.signature {
+			if cur == nil {
+				console.Info("main - reload: collector %s added", item.name)
+			} else {
+				item.router.SetLoggers(newp.routedLoggers(item, console))
+			}
+			if err := newp.startCollector(item, console); err != nil {
+				console.Error("main - reload: %v", err)
+			}
+			continue
+		}
+
+		item.worker = cur.worker
+		item.initial = cur.initial
+		item.router.SetLoggers(newp.routedLoggers(item, console))
+		cur.initial.ReloadTransforms(item.config)
+	}
+
+	// finally stop the removed loggers
+	for _, cur := range p.loggers {
+		if newp.getLogger(cur.name) == nil {
+			console.Info("main - reload: logger %s removed", cur.name)
+			cur.queue.Stop()
+			dnsutils.Health.Remove("loggers/" + cur.name)
+		}
+	}
+}
+
+// setServerId uses the hostname as default server identity
+func setServerId(config *dnsutils.Config, logger *logger.Logger) {
+	if config.Subprocessors.ServerId == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			logger.Error("failed to get hostname: %v\n", err)
+		} else {
+			config.Subprocessors.ServerId = hostname
+		}
+	}
+}
+
+// loadConfig loads and validates the configuration file, all the errors found are returned
+func loadConfig(configPath string, logger *logger.Logger) (*dnsutils.Config, *pipeline, []error) {
+	config, err := dnsutils.LoadConfig(configPath)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	if errs := dnsutils.CheckConfig(config); len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	// get hostname
+	setServerId(config, logger)
+
+	p, err := newPipeline(config)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	return config, p, nil
+}
+
 func main() {
 	var verFlag bool
+	var testFlag bool
 	var configPath string
 
 	flag.BoolVar(&verFlag, "version", false, "Show version")
+	flag.BoolVar(&testFlag, "test-config", false, "Check the config file and exit")
 	flag.StringVar(&configPath, "config", "./config.yml", "path to config file")
 	flag.Parse()
 
@@ -39,10 +457,17 @@ func main() {
 	// create logger
 	logger := logger.New(true)
 
-	// load config
-	config, err := dnsutils.LoadConfig(configPath)
-	if err != nil {
-		panic(fmt.Sprintf("main - config error:  %v", err))
+	// load and validate config
+	config, p, errs := loadConfig(configPath, logger)
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", err)
+	}
+	if len(errs) > 0 {
+		os.Exit(1)
+	}
+	if testFlag {
+		fmt.Printf("config file %s is valid\n", configPath)
+		os.Exit(0)
 	}
 
 	// redirect app logs to file ?
@@ -57,105 +482,78 @@ func main() {
 	// enable the verbose mode ?
 	logger.SetVerbose(config.Trace.Verbose)
 
-	// get hostname
-	if config.Subprocessors.ServerId == "" {
-		hostname, err := os.Hostname()
-		if err != nil {
-			logger.Error("failed to get hostname: %v\n", err)
-		} else {
-			config.Subprocessors.ServerId = hostname
-		}
-	}
-
 	logger.Info("main - version %s", Version)
 	logger.Info("main - config loaded...")
 	logger.Info("main - starting dnslogger...")
 
-	// load loggers
-	var logwrks []dnsutils.Worker
-
-	if config.Loggers.WebServer.Enable {
-		logwrks = append(logwrks, loggers.NewWebserver(config, logger, Version))
-	}
-	if config.Loggers.Prometheus.Enable {
-		logwrks = append(logwrks, loggers.NewPrometheus(config, logger, Version))
-	}
-	if config.Loggers.Stdout.Enable {
-		logwrks = append(logwrks, loggers.NewStdOut(config, logger))
-	}
-	if config.Loggers.LogFile.Enable {
-		logwrks = append(logwrks, loggers.NewLogFile(config, logger))
-	}
-	if config.Loggers.Dnstap.Enable {
-		logwrks = append(logwrks, loggers.NewDnstapSender(config, logger))
-	}
-	if config.Loggers.TcpClient.Enable {
-		logwrks = append(logwrks, loggers.NewTcpClient(config, logger))
-	}
-	if config.Loggers.Syslog.Enable {
-		logwrks = append(logwrks, loggers.NewSyslog(config, logger))
-	}
-	if config.Loggers.Fluentd.Enable {
-		logwrks = append(logwrks, loggers.NewFluentdClient(config, logger))
-	}
-	if config.Loggers.PcapFile.Enable {
-		logwrks = append(logwrks, loggers.NewPcapFile(config, logger))
-	}
-	if config.Loggers.InfluxDB.Enable {
-		logwrks = append(logwrks, loggers.NewInfluxDBClient(config, logger))
-	}
-	if config.Loggers.LokiClient.Enable {
-		logwrks = append(logwrks, loggers.NewLokiClient(config, logger))
-	}
-	if config.Loggers.Statsd.Enable {
-		logwrks = append(logwrks, loggers.NewStatsdClient(config, logger, Version))
+	// the probes are answered during the startup, the process is not ready until the workers are running
+	var cp *controlPlane
+	if config.ControlPlane.Enable {
+		cp = newControlPlane(config, logger)
+		if err := cp.Listen(); err != nil {
+			panic(fmt.Sprintf("main - control plane error: %v", err))
+		}
+		go cp.Run()
 	}
 
-	// load collectors
-	var collwrks []dnsutils.Worker
-
-	if config.Collectors.Dnstap.Enable {
-		collwrks = append(collwrks, collectors.NewDnstap(logwrks, config, logger))
-	}
-	if config.Collectors.DnsSniffer.Enable {
-		collwrks = append(collwrks, collectors.NewDnsSniffer(logwrks, config, logger))
+	// run all workers in background
+	logger.Info("main - running all collectors and loggers...")
+	if err := p.Start(logger); err != nil {
+		panic(fmt.Sprintf("main - config error: %v", err))
 	}
-	if config.Collectors.Tail.Enable {
-		collwrks = append(collwrks, collectors.NewTail(logwrks, config, logger))
+	if cp != nil {
+		cp.SetPipeline(p)
 	}
 
-	// Handle Ctrl-C
+	// Handle Ctrl-C and reload on SIGHUP
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
-		for range c {
+		for sig := range c {
+			if sig == syscall.SIGHUP {
+				logger.Info("main - reloading config...")
+				newconfig, newp, errs := loadConfig(configPath, logger)
+				for _, err := range errs {
+					logger.Error("main - config error: %v", err)
+				}
+				if len(errs) > 0 {
+					logger.Error("main - reload aborted")
+					continue
+				}
+				logger.SetVerbose(newconfig.Trace.Verbose)
+				p.Reload(newp, logger)
+				p = newp
+				if cp != nil {
+					cp.SetPipeline(p)
+				}
+				logger.Info("main - config reloaded")
+				continue
+			}
+
 			logger.Info("main - system interrupt, exiting...")
 
+			// not ready anymore during the shutdown
+			if cp != nil {
+				cp.SetPipeline(nil)
+			}
+
 			// stop all workers
 			logger.Info("main - stopping all collectors and loggers...")
-			for _, p := range collwrks {
-				p.Stop()
+			if lost := p.Stop(); lost > 0 {
+				logger.Error("main - %d messages lost since startup", lost)
+			} else {
+				logger.Info("main - all messages flushed")
 			}
-			for _, p := range logwrks {
-				p.Stop()
+			if cp != nil {
+				cp.Stop()
 			}
 
 			// unblock main function
 			done <- true
-
-			os.Exit(0)
+			return
 		}
 	}()
 
-	// run all workers in background
-	logger.Info("main - running all collectors and loggers...")
-	for _, p := range logwrks {
-		go p.Run()
-	}
-	for _, p := range collwrks {
-		go p.Run()
-	}
-
 	// block main
 	<-done
 
@@ -0,0 +1,499 @@
+package dnsutils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/bpf"
+)
+
+// link types of the packets captured by the sniffer
+const (
+	LinkTypeEthernet = "ethernet"
+	LinkTypeLinuxSLL = "linux-sll"
+	LinkTypeRaw      = "raw"
+)
+
+// scratch memory of the filter, set by the prologue according to the link type
+const (
+	bpfMemL3Offset  = 0
+	bpfMemEtherType = 1
+)
+
+var errBpfFilterTooLong = errors.New("bpf filter too long")
+
+// bpfExpr is a node of the filter expression compiled to jumps to the true and false labels
+type bpfExpr interface {
+	compile(b *bpfBuilder, onTrue int, onFalse int)
+}
+
+type bpfAnd struct {
+	left, right bpfExpr
+}
+
+func (e bpfAnd) compile(b *bpfBuilder, onTrue int, onFalse int) {
+	next := b.label()
+	e.left.compile(b, next, onFalse)
+	b.set(next)
+	e.right.compile(b, onTrue, onFalse)
+}
+
+type bpfOr struct {
+	left, right bpfExpr
+}
+
+func (e bpfOr) compile(b *bpfBuilder, onTrue int, onFalse int) {
+	next := b.label()
+	e.left.compile(b, onTrue, next)
+	b.set(next)
+	e.right.compile(b, onTrue, onFalse)
+}
+
+type bpfNot struct {
+	expr bpfExpr
+}
+
+func (e bpfNot) compile(b *bpfBuilder, onTrue int, onFalse int) {
+	e.expr.compile(b, onFalse, onTrue)
+}
+
+// bpfTest compares a field of the packet, the field is masked before when the mask is set
+type bpfTest struct {
+	load []bpf.Instruction
+	mask uint32
+	cond bpf.JumpTest
+	val  uint32
+}
+
+func (e bpfTest) compile(b *bpfBuilder, onTrue int, onFalse int) {
+	b.emit(e.load...)
+	if e.mask != 0 {
+		b.emit(bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: e.mask})
+	}
+	b.jumpIf(e.cond, e.val, onTrue, onFalse)
+}
+
+type bpfJump struct {
+	index   int
+	onTrue  int
+	onFalse int
+}
+
+// bpfBuilder emits the instructions with forward jumps to labels, the jumps are resolved
+// when all the labels are set
+type bpfBuilder struct {
+	insns  []bpf.Instruction
+	labels []int
+	jumps  []bpfJump
+}
+
+func (b *bpfBuilder) label() int {
+	b.labels = append(b.labels, -1)
+	return len(b.labels) - 1
+}
+
+func (b *bpfBuilder) set(label int) {
+	b.labels[label] = len(b.insns)
+}
+
+func (b *bpfBuilder) emit(insns ...bpf.Instruction) {
+	b.insns = append(b.insns, insns...)
+}
+
+func (b *bpfBuilder) jumpIf(cond bpf.JumpTest, val uint32, onTrue int, onFalse int) {
+	b.jumps = append(b.jumps, bpfJump{index: len(b.insns), onTrue: onTrue, onFalse: onFalse})
+	b.emit(bpf.JumpIf{Cond: cond, Val: val})
+}
+
+func (b *bpfBuilder) jump(to int) {
+	b.jumps = append(b.jumps, bpfJump{index: len(b.insns), onTrue: to, onFalse: -1})
+	b.emit(bpf.Jump{})
+}
+
+func (b *bpfBuilder) resolve() ([]bpf.Instruction, error) {
+	for _, j := range b.jumps {
+		skipTrue := b.labels[j.onTrue] - j.index - 1
+		if j.onFalse < 0 {
+			b.insns[j.index] = bpf.Jump{Skip: uint32(skipTrue)}
+			continue
+		}
+
+		skipFalse := b.labels[j.onFalse] - j.index - 1
+		if skipTrue > 255 || skipFalse > 255 {
+			return nil, errBpfFilterTooLong
+		}
+		ins := b.insns[j.index].(bpf.JumpIf)
+		ins.SkipTrue = uint8(skipTrue)
+		ins.SkipFalse = uint8(skipFalse)
+		b.insns[j.index] = ins
+	}
+	return b.insns, nil
+}
+
+// prologue stores the offset of the ip header and the ether type in the scratch memory,
+// the vlan tags are skipped and the ether type of the raw ip packets comes from the ip version
+func (b *bpfBuilder) prologue(linkType string) {
+	end := b.label()
+
+	if linkType == LinkTypeEthernet {
+		vlan := b.label()
+		b.emit(
+			bpf.LoadAbsolute{Off: 12, Size: 2},
+			bpf.StoreScratch{Src: bpf.RegA, N: bpfMemEtherType},
+			bpf.LoadConstant{Dst: bpf.RegA, Val: 14},
+			bpf.StoreScratch{Src: bpf.RegA, N: bpfMemL3Offset},
+			bpf.LoadScratch{Dst: bpf.RegA, N: bpfMemEtherType},
+		)
+		b.jumpIf(bpf.JumpEqual, 0x8100, vlan, end)
+		b.set(vlan)
+		b.emit(
+			bpf.LoadAbsolute{Off: 16, Size: 2},
+			bpf.StoreScratch{Src: bpf.RegA, N: bpfMemEtherType},
+			bpf.LoadConstant{Dst: bpf.RegA, Val: 18},
+			bpf.StoreScratch{Src: bpf.RegA, N: bpfMemL3Offset},
+		)
+		b.set(end)
+		return
+	}
+
+	// the packet starts with the ip header
+	ipv4, ipv6, version6 := b.label(), b.label(), b.label()
+	b.emit(
+		bpf.LoadConstant{Dst: bpf.RegA, Val: 0},
+		bpf.StoreScratch{Src: bpf.RegA, N: bpfMemL3Offset},
+		bpf.StoreScratch{Src: bpf.RegA, N: bpfMemEtherType},
+		bpf.LoadAbsolute{Off: 0, Size: 1},
+		bpf.ALUOpConstant{Op: bpf.ALUOpShiftRight, Val: 4},
+	)
+	b.jumpIf(bpf.JumpEqual, 4, ipv4, version6)
+	b.set(version6)
+	b.jumpIf(bpf.JumpEqual, 6, ipv6, end)
+	b.set(ipv4)
+	b.emit(
+		bpf.LoadConstant{Dst: bpf.RegA, Val: 0x0800},
+		bpf.StoreScratch{Src: bpf.RegA, N: bpfMemEtherType},
+	)
+	b.jump(end)
+	b.set(ipv6)
+	b.emit(
+		bpf.LoadConstant{Dst: bpf.RegA, Val: 0x86dd},
+		bpf.StoreScratch{Src: bpf.RegA, N: bpfMemEtherType},
+	)
+	b.set(end)
+}
+
+// field loaders relative to the ip header and to the transport header
+func bpfLoadEtherType() []bpf.Instruction {
+	return []bpf.Instruction{bpf.LoadScratch{Dst: bpf.RegA, N: bpfMemEtherType}}
+}
+
+func bpfLoadL3(off uint32, size int) []bpf.Instruction {
+	return []bpf.Instruction{
+		bpf.LoadScratch{Dst: bpf.RegX, N: bpfMemL3Offset},
+		bpf.LoadIndirect{Off: off, Size: size},
+	}
+}
+
+func bpfLoadL4v4(off uint32, size int) []bpf.Instruction {
+	// X = offset of the ip header + ip header length
+	return []bpf.Instruction{
+		bpf.LoadScratch{Dst: bpf.RegX, N: bpfMemL3Offset},
+		bpf.LoadIndirect{Off: 0, Size: 1},
+		bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xf},
+		bpf.ALUOpConstant{Op: bpf.ALUOpShiftLeft, Val: 2},
+		bpf.ALUOpX{Op: bpf.ALUOpAdd},
+		bpf.TAX{},
+		bpf.LoadIndirect{Off: off, Size: size},
+	}
+}
+
+func bpfLoadL4v6(off uint32, size int) []bpf.Instruction {
+	// the extension headers are not supported
+	return bpfLoadL3(40+off, size)
+}
+
+func bpfIPv4() bpfExpr {
+	return bpfTest{load: bpfLoadEtherType(), cond: bpf.JumpEqual, val: 0x0800}
+}
+
+func bpfIPv6() bpfExpr {
+	return bpfTest{load: bpfLoadEtherType(), cond: bpf.JumpEqual, val: 0x86dd}
+}
+
+func bpfProto(proto uint32) bpfExpr {
+	return bpfOr{
+		bpfAnd{bpfIPv4(), bpfTest{load: bpfLoadL3(9, 1), cond: bpf.JumpEqual, val: proto}},
+		bpfAnd{bpfIPv6(), bpfTest{load: bpfLoadL3(6, 1), cond: bpf.JumpEqual, val: proto}},
+	}
+}
+
+// bpfFragment matches the ipv4 fragments without the transport header
+// and all the ipv6 fragments, the fragment header is before the transport header
+func bpfFragment() bpfExpr {
+	return bpfOr{
+		bpfAnd{bpfIPv4(), bpfTest{load: bpfLoadL3(6, 2), cond: bpf.JumpBitsSet, val: 0x1fff}},
+		bpfAnd{bpfIPv6(), bpfTest{load: bpfLoadL3(6, 1), cond: bpf.JumpEqual, val: 44}},
+	}
+}
+
+// bpfDirection combines the tests of the source and the destination
+func bpfDirection(dir string, test func(src bool) bpfExpr) bpfExpr {
+	switch dir {
+	case "src":
+		return test(true)
+	case "dst":
+		return test(false)
+	}
+	return bpfOr{test(true), test(false)}
+}
+
+func bpfPort(dir string, first uint32, last uint32) bpfExpr {
+	portTest := func(load func(uint32, int) []bpf.Instruction) bpfExpr {
+		return bpfDirection(dir, func(src bool) bpfExpr {
+			off := uint32(2)
+			if src {
+				off = 0
+			}
+			if first == last {
+				return bpfTest{load: load(off, 2), cond: bpf.JumpEqual, val: first}
+			}
+			return bpfAnd{
+				bpfTest{load: load(off, 2), cond: bpf.JumpGreaterOrEqual, val: first},
+				bpfTest{load: load(off, 2), cond: bpf.JumpLessOrEqual, val: last},
+			}
+		})
+	}
+	udpOrTcp := func(off uint32) bpfExpr {
+		return bpfOr{
+			bpfTest{load: bpfLoadL3(off, 1), cond: bpf.JumpEqual, val: 17},
+			bpfTest{load: bpfLoadL3(off, 1), cond: bpf.JumpEqual, val: 6},
+		}
+	}
+
+	return bpfOr{
+		bpfAnd{bpfIPv4(), bpfAnd{udpOrTcp(9), bpfAnd{
+			bpfNot{bpfTest{load: bpfLoadL3(6, 2), cond: bpf.JumpBitsSet, val: 0x1fff}},
+			portTest(bpfLoadL4v4),
+		}}},
+		bpfAnd{bpfIPv6(), bpfAnd{udpOrTcp(6), portTest(bpfLoadL4v6)}},
+	}
+}
+
+// bpfNet compares the address of the ip header word by word, the host is a network
+// with all the bits of the address
+func bpfNet(dir string, ipnet *net.IPNet) bpfExpr {
+	family, srcOff, dstOff := bpfIPv4(), uint32(12), uint32(16)
+	if ipnet.IP.To4() == nil {
+		family, srcOff, dstOff = bpfIPv6(), uint32(8), uint32(24)
+	}
+
+	return bpfAnd{family, bpfDirection(dir, func(src bool) bpfExpr {
+		off := dstOff
+		if src {
+			off = srcOff
+		}
+
+		var expr bpfExpr
+		for i := 0; i < len(ipnet.Mask); i += 4 {
+			mask := uint32(ipnet.Mask[i])<<24 | uint32(ipnet.Mask[i+1])<<16 | uint32(ipnet.Mask[i+2])<<8 | uint32(ipnet.Mask[i+3])
+			if mask == 0 {
+				break
+			}
+			val := uint32(ipnet.IP[i])<<24 | uint32(ipnet.IP[i+1])<<16 | uint32(ipnet.IP[i+2])<<8 | uint32(ipnet.IP[i+3])
+
+			test := bpfTest{load: bpfLoadL3(off+uint32(i), 4), cond: bpf.JumpEqual, val: val & mask}
+			if mask != 0xffffffff {
+				test.mask = mask
+			}
+			if expr == nil {
+				expr = test
+			} else {
+				expr = bpfAnd{expr, test}
+			}
+		}
+		if expr == nil {
+			// the network 0.0.0.0/0 or ::/0
+			return bpfTest{load: []bpf.Instruction{bpf.LoadConstant{Dst: bpf.RegA, Val: 0}}, cond: bpf.JumpEqual, val: 0}
+		}
+		return expr
+	})}
+}
+
+// bpfParser reads the filter expressions with the syntax of tcpdump, the primitives host, net,
+// port and portrange with an optional src or dst direction, and ip, ip6, udp, tcp, combined
+// with and, or, not and parentheses
+type bpfParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *bpfParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *bpfParser) next() string {
+	tok := p.peek()
+	if len(tok) > 0 {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *bpfParser) parseOr() (bpfExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" || p.peek() == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = bpfOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *bpfParser) parseAnd() (bpfExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" || p.peek() == "&&" {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = bpfAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *bpfParser) parseNot() (bpfExpr, error) {
+	switch p.peek() {
+	case "not", "!":
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return bpfNot{expr}, nil
+
+	case "(":
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		return expr, nil
+	}
+	return p.parsePrimitive()
+}
+
+func (p *bpfParser) parsePrimitive() (bpfExpr, error) {
+	dir := ""
+	tok := p.next()
+	if tok == "src" || tok == "dst" {
+		dir, tok = tok, p.next()
+	}
+
+	switch tok {
+	case "host":
+		arg := p.next()
+		ip := net.ParseIP(arg)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid host %q", arg)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return bpfNet(dir, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}), nil
+
+	case "net":
+		arg := p.next()
+		_, ipnet, err := net.ParseCIDR(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid net %q", arg)
+		}
+		return bpfNet(dir, ipnet), nil
+
+	case "port":
+		arg := p.next()
+		port, err := strconv.ParseUint(arg, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", arg)
+		}
+		return bpfPort(dir, uint32(port), uint32(port)), nil
+
+	case "portrange":
+		arg := p.next()
+		ports := strings.SplitN(arg, "-", 2)
+		if len(ports) != 2 {
+			return nil, fmt.Errorf("invalid port range %q", arg)
+		}
+		first, err1 := strconv.ParseUint(ports[0], 10, 16)
+		last, err2 := strconv.ParseUint(ports[1], 10, 16)
+		if err1 != nil || err2 != nil || first > last {
+			return nil, fmt.Errorf("invalid port range %q", arg)
+		}
+		return bpfPort(dir, uint32(first), uint32(last)), nil
+	}
+
+	if len(dir) > 0 {
+		return nil, fmt.Errorf("%s must be followed by host, net, port or portrange", dir)
+	}
+	switch tok {
+	case "ip":
+		return bpfIPv4(), nil
+	case "ip6":
+		return bpfIPv6(), nil
+	case "udp":
+		return bpfProto(17), nil
+	case "tcp":
+		return bpfProto(6), nil
+	case "":
+		return nil, errors.New("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unsupported keyword %q", tok)
+}
+
+// GetBpfFilter compiles the filter expression for the link type, the ip fragments are kept
+// whatever the expression to be reassembled, the ports are only in the first fragment
+func GetBpfFilter(expression string, linkType string) ([]bpf.Instruction, error) {
+	expression = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expression)
+	p := &bpfParser{tokens: strings.Fields(expression)}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid bpf filter: %s", err)
+	}
+	if len(p.peek()) > 0 {
+		return nil, fmt.Errorf("invalid bpf filter: unexpected %q", p.peek())
+	}
+
+	b := &bpfBuilder{}
+	b.prologue(linkType)
+
+	keep, ignore := b.label(), b.label()
+	bpfOr{expr, bpfFragment()}.compile(b, keep, ignore)
+
+	// Keep the packet and send up to 65k of the packet to userspace
+	b.set(keep)
+	b.emit(bpf.RetConstant{Val: 0xFFFF})
+	// Ignore packet
+	b.set(ignore)
+	b.emit(bpf.RetConstant{Val: 0})
+
+	return b.resolve()
+}
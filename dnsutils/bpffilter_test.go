@@ -0,0 +1,106 @@
+package dnsutils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/net/bpf"
+)
+
+// fakeUdpPacket returns a udp packet with the link-layer header of the link type
+func fakeUdpPacket(t *testing.T, linkType string, vlan bool, src string, srcPort, dstPort layers.UDPPort) []byte {
+	var ip gopacket.SerializableLayer
+	var network gopacket.NetworkLayer
+	etherType := layers.EthernetTypeIPv4
+	if net.ParseIP(src).To4() != nil {
+		ip4 := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.ParseIP(src), DstIP: net.ParseIP("192.168.1.1")}
+		ip, network = ip4, ip4
+	} else {
+		ip6 := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: net.ParseIP(src), DstIP: net.ParseIP("fe80::1")}
+		ip, network = ip6, ip6
+		etherType = layers.EthernetTypeIPv6
+	}
+	udp := &layers.UDP{SrcPort: srcPort, DstPort: dstPort}
+	udp.SetNetworkLayerForChecksum(network)
+
+	pktLayers := []gopacket.SerializableLayer{ip, udp, gopacket.Payload([]byte("dns"))}
+	if linkType == LinkTypeEthernet {
+		eth := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 1},
+			DstMAC:       net.HardwareAddr{0, 0, 0, 0, 0, 2},
+			EthernetType: etherType,
+		}
+		if vlan {
+			eth.EthernetType = layers.EthernetTypeDot1Q
+			pktLayers = append([]gopacket.SerializableLayer{&layers.Dot1Q{VLANIdentifier: 100, Type: etherType}}, pktLayers...)
+		}
+		pktLayers = append([]gopacket.SerializableLayer{eth}, pktLayers...)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	if err := gopacket.SerializeLayers(buf, opts, pktLayers...); err != nil {
+		t.Fatalf("packet serialize error: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBpfFilterExpression(t *testing.T) {
+	expression := "(port 53 or dst portrange 850-853) and not src host 192.168.1.254 and not src net 2001:db8::/32"
+
+	packets := []struct {
+		name     string
+		linkType string
+		vlan     bool
+		src      string
+		srcPort  layers.UDPPort
+		dstPort  layers.UDPPort
+		keep     bool
+	}{
+		{name: "ethernet dns", linkType: LinkTypeEthernet, src: "10.0.0.1", srcPort: 42000, dstPort: 53, keep: true},
+		{name: "ethernet dot", linkType: LinkTypeEthernet, src: "10.0.0.1", srcPort: 42000, dstPort: 853, keep: true},
+		{name: "ethernet dot reply", linkType: LinkTypeEthernet, src: "10.0.0.1", srcPort: 853, dstPort: 42000, keep: false},
+		{name: "ethernet other", linkType: LinkTypeEthernet, src: "10.0.0.1", srcPort: 42000, dstPort: 80, keep: false},
+		{name: "ethernet excluded host", linkType: LinkTypeEthernet, src: "192.168.1.254", srcPort: 42000, dstPort: 53, keep: false},
+		{name: "vlan dns", linkType: LinkTypeEthernet, vlan: true, src: "10.0.0.1", srcPort: 53, dstPort: 42000, keep: true},
+		{name: "vlan excluded host", linkType: LinkTypeEthernet, vlan: true, src: "192.168.1.254", srcPort: 53, dstPort: 42000, keep: false},
+		{name: "ethernet dns ipv6", linkType: LinkTypeEthernet, src: "fe80::2", srcPort: 42000, dstPort: 53, keep: true},
+		{name: "ethernet excluded net", linkType: LinkTypeEthernet, src: "2001:db8::2", srcPort: 42000, dstPort: 53, keep: false},
+		{name: "raw dns", linkType: LinkTypeRaw, src: "10.0.0.1", srcPort: 42000, dstPort: 53, keep: true},
+		{name: "raw other", linkType: LinkTypeRaw, src: "10.0.0.1", srcPort: 42000, dstPort: 80, keep: false},
+		{name: "cooked dns ipv6", linkType: LinkTypeLinuxSLL, src: "fe80::2", srcPort: 53, dstPort: 42000, keep: true},
+		{name: "cooked excluded net", linkType: LinkTypeLinuxSLL, src: "2001:db8::2", srcPort: 53, dstPort: 42000, keep: false},
+	}
+
+	for _, p := range packets {
+		filter, err := GetBpfFilter(expression, p.linkType)
+		if err != nil {
+			t.Fatalf("bpf filter error: %s", err)
+		}
+		if _, err := bpf.Assemble(filter); err != nil {
+			t.Fatalf("bpf assemble error: %s", err)
+		}
+		vm, err := bpf.NewVM(filter)
+		if err != nil {
+			t.Fatalf("invalid bpf filter: %s", err)
+		}
+
+		n, err := vm.Run(fakeUdpPacket(t, p.linkType, p.vlan, p.src, p.srcPort, p.dstPort))
+		if err != nil {
+			t.Fatalf("bpf error: %s", err)
+		}
+		if (n > 0) != p.keep {
+			t.Errorf("%s: want keep=%v", p.name, p.keep)
+		}
+	}
+}
+
+func TestBpfFilterInvalid(t *testing.T) {
+	for _, expression := range []string{"", "port", "port 70000", "src udp", "(port 53", "port 53 )", "host foo", "portrange 53"} {
+		if _, err := GetBpfFilter(expression, LinkTypeEthernet); err == nil {
+			t.Errorf("%q: error expected", expression)
+		}
+	}
+}
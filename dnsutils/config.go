@@ -1,7 +1,9 @@
 package dnsutils
 
 import (
+	"bytes"
 	"os"
+	"sync/atomic"
 
 	"gopkg.in/yaml.v3"
 )
@@ -16,6 +18,14 @@ func IsValidMode(mode string) bool {
 	return false
 }
 
+// SpoolConfig describes the disk spool of a network logger
+type SpoolConfig struct {
+	Enable  bool   `yaml:"enable"`
+	Path    string `yaml:"path"`
+	MaxSize int    `yaml:"max-size"`
+	MaxAge  int    `yaml:"max-age"`
+}
+
 type Config struct {
 	Trace struct {
 		Verbose      bool   `yaml:"verbose"`
@@ -43,12 +53,48 @@ type Config struct {
 			KeyFile    string `yaml:"key-file"`
 		} `yaml:"dnstap"`
 		DnsSniffer struct {
-			Enable            bool   `yaml:"enable"`
-			Port              int    `yaml:"port"`
-			Device            string `yaml:"device"`
-			CaptureDnsQueries bool   `yaml:"capture-dns-queries"`
-			CaptureDnsReplies bool   `yaml:"capture-dns-replies"`
+			Enable                     bool   `yaml:"enable"`
+			Port                       int    `yaml:"port"`
+			Device                     string `yaml:"device"`
+			LinkType                   string `yaml:"link-type"`
+			BpfFilter                  string `yaml:"bpf-filter"`
+			CaptureDnsQueries          bool   `yaml:"capture-dns-queries"`
+			CaptureDnsReplies          bool   `yaml:"capture-dns-replies"`
+			TcpFlowTimeout             int    `yaml:"tcp-flow-timeout"`
+			TcpMaxBufferedPages        int    `yaml:"tcp-max-buffered-pages"`
+			TcpMaxBufferedPagesPerFlow int    `yaml:"tcp-max-buffered-pages-per-flow"`
+			DefragTimeout              int    `yaml:"defrag-timeout"`
+			DefragMaxDatagrams         int    `yaml:"defrag-max-datagrams"`
+			RingBuffer                 bool   `yaml:"ring-buffer"`
+			RingBlockSize              int    `yaml:"ring-block-size"`
+			RingBlockCount             int    `yaml:"ring-block-count"`
+			RingBlockTimeout           int    `yaml:"ring-block-timeout"`
+			FanoutWorkers              int    `yaml:"fanout-workers"`
+			TlsKeyLogFile              string `yaml:"tls-keylog-file"`
+			DotPort                    int    `yaml:"dot-port"`
+			DohPort                    int    `yaml:"doh-port"`
 		} `yaml:"dns-sniffer"`
+		DnsProxy struct {
+			Enable          bool   `yaml:"enable"`
+			ListenIP        string `yaml:"listen-ip"`
+			ListenPort      int    `yaml:"listen-port"`
+			UpstreamAddress string `yaml:"upstream-address"`
+			UpstreamPort    int    `yaml:"upstream-port"`
+			Timeout         int    `yaml:"timeout"`
+			UdpMaxPending   int    `yaml:"udp-max-pending"`
+		} `yaml:"dns-proxy"`
+		PcapReader struct {
+			Enable        bool   `yaml:"enable"`
+			Path          string `yaml:"path"`
+			Port          int    `yaml:"port"`
+			Watch         bool   `yaml:"watch"`
+			WatchInterval int    `yaml:"watch-interval"`
+		} `yaml:"pcap-reader"`
+		DnstapReader struct {
+			Enable         bool   `yaml:"enable"`
+			Path           string `yaml:"path"`
+			OriginalTiming bool   `yaml:"original-timing"`
+		} `yaml:"dnstap-reader"`
 	} `yaml:"collectors"`
 
 	Subprocessors struct {
@@ -80,21 +126,23 @@ type Config struct {
 			DropQueryIpFile string   `yaml:"drop-queryip-file"`
 			DropRcodes      []string `yaml:"drop-rcodes,flow"`
 			LogQueries      bool     `yaml:"log-queries"`
-			LogReplies      bool     `yaml:"log-replies"!`
+			LogReplies      bool     `yaml:"log-replies"`
 		} `yaml:"filtering"`
 		GeoIP struct {
 			DbCountryFile string `yaml:"mmdb-country-file"`
 			DbCityFile    string `yaml:"mmdb-city-file"`
 			DbAsnFile     string `yaml:"mmdb-asn-file"`
 		} `yaml:"geoip"`
-		TextFormat string `yaml:"text-format"`
+		TextFormat string   `yaml:"text-format"`
+		Transforms []string `yaml:"transforms,flow"`
 	} `yaml:"subprocessors"`
 
 	Loggers struct {
 		Stdout struct {
-			Enable     bool   `yaml:"enable"`
-			Mode       string `yaml:"mode"`
-			TextFormat string `yaml:"text-format"`
+			Enable      bool   `yaml:"enable"`
+			Mode        string `yaml:"mode"`
+			TextFormat  string `yaml:"text-format"`
+			RdataFields bool   `yaml:"rdata-fields"`
 		} `yaml:"stdout"`
 		Prometheus struct {
 			Enable         bool   `yaml:"enable"`
@@ -129,28 +177,32 @@ type Config struct {
 			PostRotateCommand string `yaml:"postrotate-command"`
 			PostRotateDelete  bool   `yaml:"postrotate-delete-success"`
 			TextFormat        string `yaml:"text-format"`
+			RdataFields       bool   `yaml:"rdata-fields"`
 		} `yaml:"logfile"`
 		Dnstap struct {
-			Enable        bool   `yaml:"enable"`
-			RemoteAddress string `yaml:"remote-address"`
-			RemotePort    int    `yaml:"remote-port"`
-			SockPath      string `yaml:"sock-path"`
-			RetryInterval int    `yaml:"retry-interval"`
-			TlsSupport    bool   `yaml:"tls-support"`
-			TlsInsecure   bool   `yaml:"tls-insecure"`
+			Enable        bool        `yaml:"enable"`
+			RemoteAddress string      `yaml:"remote-address"`
+			RemotePort    int         `yaml:"remote-port"`
+			SockPath      string      `yaml:"sock-path"`
+			RetryInterval int         `yaml:"retry-interval"`
+			TlsSupport    bool        `yaml:"tls-support"`
+			TlsInsecure   bool        `yaml:"tls-insecure"`
+			Spool         SpoolConfig `yaml:"spool"`
 		} `yaml:"dnstap"`
 		TcpClient struct {
-			Enable        bool   `yaml:"enable"`
-			RemoteAddress string `yaml:"remote-address"`
-			RemotePort    int    `yaml:"remote-port"`
-			SockPath      string `yaml:"sock-path"`
-			RetryInterval int    `yaml:"retry-interval"`
-			Transport     string `yaml:"transport"`
-			TlsSupport    bool   `yaml:"tls-support"`
-			TlsInsecure   bool   `yaml:"tls-insecure"`
-			Mode          string `yaml:"mode"`
-			TextFormat    string `yaml:"text-format"`
-			Delimiter     string `yaml:"delimiter"`
+			Enable        bool        `yaml:"enable"`
+			RemoteAddress string      `yaml:"remote-address"`
+			RemotePort    int         `yaml:"remote-port"`
+			SockPath      string      `yaml:"sock-path"`
+			RetryInterval int         `yaml:"retry-interval"`
+			Transport     string      `yaml:"transport"`
+			TlsSupport    bool        `yaml:"tls-support"`
+			TlsInsecure   bool        `yaml:"tls-insecure"`
+			Mode          string      `yaml:"mode"`
+			TextFormat    string      `yaml:"text-format"`
+			Delimiter     string      `yaml:"delimiter"`
+			RdataFields   bool        `yaml:"rdata-fields"`
+			Spool         SpoolConfig `yaml:"spool"`
 		} `yaml:"tcpclient"`
 		Syslog struct {
 			Enable        bool   `yaml:"enable"`
@@ -162,17 +214,19 @@ type Config struct {
 			Mode          string `yaml:"mode"`
 			TlsSupport    bool   `yaml:"tls-support"`
 			TlsInsecure   bool   `yaml:"tls-insecure"`
+			RdataFields   bool   `yaml:"rdata-fields"`
 		} `yaml:"syslog"`
 		Fluentd struct {
-			Enable        bool   `yaml:"enable"`
-			RemoteAddress string `yaml:"remote-address"`
-			RemotePort    int    `yaml:"remote-port"`
-			SockPath      string `yaml:"sock-path"`
-			RetryInterval int    `yaml:"retry-interval"`
-			Transport     string `yaml:"transport"`
-			TlsSupport    bool   `yaml:"tls-support"`
-			TlsInsecure   bool   `yaml:"tls-insecure"`
-			Tag           string `yaml:"tag"`
+			Enable        bool        `yaml:"enable"`
+			RemoteAddress string      `yaml:"remote-address"`
+			RemotePort    int         `yaml:"remote-port"`
+			SockPath      string      `yaml:"sock-path"`
+			RetryInterval int         `yaml:"retry-interval"`
+			Transport     string      `yaml:"transport"`
+			TlsSupport    bool        `yaml:"tls-support"`
+			TlsInsecure   bool        `yaml:"tls-insecure"`
+			Tag           string      `yaml:"tag"`
+			Spool         SpoolConfig `yaml:"spool"`
 		} `yaml:"fluentd"`
 		PcapFile struct {
 			Enable            bool   `yaml:"enable"`
@@ -184,6 +238,16 @@ type Config struct {
 			PostRotateCommand string `yaml:"postrotate-command"`
 			PostRotateDelete  bool   `yaml:"postrotate-delete-success"`
 		} `yaml:"pcapfile"`
+		DnstapFile struct {
+			Enable            bool   `yaml:"enable"`
+			FilePath          string `yaml:"file-path"`
+			MaxSize           int    `yaml:"max-size"`
+			MaxFiles          int    `yaml:"max-files"`
+			Compress          bool   `yaml:"compress"`
+			CompressInterval  int    `yaml:"compress-interval"`
+			PostRotateCommand string `yaml:"postrotate-command"`
+			PostRotateDelete  bool   `yaml:"postrotate-delete-success"`
+		} `yaml:"dnstapfile"`
 		InfluxDB struct {
 			Enable       bool   `yaml:"enable"`
 			ServerURL    string `yaml:"server-url"`
@@ -194,18 +258,19 @@ type Config struct {
 			Organization string `yaml:"organization"`
 		} `yaml:"influxdb"`
 		LokiClient struct {
-			Enable         bool   `yaml:"enable"`
-			ServerURL      string `yaml:"server-url"`
-			JobName        string `yaml:"job-name"`
-			FlushInterval  int    `yaml:"flush-interval"`
-			BatchSize      int    `yaml:"batch-size"`
-			RetryInterval  int    `yaml:"retry-interval"`
-			TextFormat     string `yaml:"text-format"`
-			ProxyURL       string `yaml:"proxy-url"`
-			TlsInsecure    bool   `yaml:"tls-insecure"`
-			BasicAuthLogin string `yaml:"basic-auth-login"`
-			BasicAuthPwd   string `yaml:"basic-auth-pwd"`
-			TenantId       string `yaml:"tenant-id"`
+			Enable         bool        `yaml:"enable"`
+			ServerURL      string      `yaml:"server-url"`
+			JobName        string      `yaml:"job-name"`
+			FlushInterval  int         `yaml:"flush-interval"`
+			BatchSize      int         `yaml:"batch-size"`
+			RetryInterval  int         `yaml:"retry-interval"`
+			TextFormat     string      `yaml:"text-format"`
+			ProxyURL       string      `yaml:"proxy-url"`
+			TlsInsecure    bool        `yaml:"tls-insecure"`
+			BasicAuthLogin string      `yaml:"basic-auth-login"`
+			BasicAuthPwd   string      `yaml:"basic-auth-pwd"`
+			TenantId       string      `yaml:"tenant-id"`
+			Spool          SpoolConfig `yaml:"spool"`
 		} `yaml:"lokiclient"`
 		Statsd struct {
 			Enable        bool   `yaml:"enable"`
@@ -218,6 +283,49 @@ type Config struct {
 			TlsInsecure   bool   `yaml:"tls-insecure"`
 		} `yaml:"statsd"`
 	} `yaml:"loggers"`
+
+	Multiplexer struct {
+		Collectors []MultiplexInOut `yaml:"collectors"`
+		Loggers    []MultiplexInOut `yaml:"loggers"`
+	} `yaml:"multiplexer"`
+
+	Routes []Route `yaml:"routes"`
+
+	FanOut struct {
+		QueueSize      int    `yaml:"queue-size"`
+		OverflowPolicy string `yaml:"overflow-policy"`
+		DrainTimeout   int    `yaml:"drain-timeout"`
+	} `yaml:"fanout"`
+
+	Supervisor struct {
+		BackoffMin  int `yaml:"backoff-min"`
+		BackoffMax  int `yaml:"backoff-max"`
+		MaxRestarts int `yaml:"max-restarts"`
+	} `yaml:"supervisor"`
+
+	ControlPlane struct {
+		Enable        bool   `yaml:"enable"`
+		ListenIP      string `yaml:"listen-ip"`
+		ListenPort    int    `yaml:"listen-port"`
+		MaxQueueUsage int    `yaml:"max-queue-usage"`
+	} `yaml:"control-plane"`
+
+	// last configuration of the transforms created with this one, set on reload
+	transforms atomic.Value
+}
+
+// ReloadTransforms makes the transforms created with this configuration use the new one,
+// the running workers keep their configuration and rebuild their chain on the next message
+func (c *Config) ReloadTransforms(config *Config) {
+	c.transforms.Store(config)
+}
+
+// GetTransformsConfig returns the last configuration of the transforms created with this one
+func (c *Config) GetTransformsConfig() *Config {
+	if config, ok := c.transforms.Load().(*Config); ok {
+		return config
+	}
+	return c
 }
 
 func (c *Config) SetDefault() {
@@ -246,8 +354,41 @@ func (c *Config) SetDefault() {
 	c.Collectors.DnsSniffer.Enable = false
 	c.Collectors.DnsSniffer.Port = 53
 	c.Collectors.DnsSniffer.Device = ""
+	c.Collectors.DnsSniffer.LinkType = "ethernet"
+	c.Collectors.DnsSniffer.BpfFilter = ""
 	c.Collectors.DnsSniffer.CaptureDnsQueries = true
 	c.Collectors.DnsSniffer.CaptureDnsReplies = true
+	c.Collectors.DnsSniffer.TcpFlowTimeout = 30
+	c.Collectors.DnsSniffer.TcpMaxBufferedPages = 4096
+	c.Collectors.DnsSniffer.TcpMaxBufferedPagesPerFlow = 64
+	c.Collectors.DnsSniffer.DefragTimeout = 30
+	c.Collectors.DnsSniffer.DefragMaxDatagrams = 256
+	c.Collectors.DnsSniffer.RingBuffer = false
+	c.Collectors.DnsSniffer.RingBlockSize = 1048576
+	c.Collectors.DnsSniffer.RingBlockCount = 64
+	c.Collectors.DnsSniffer.RingBlockTimeout = 100
+	c.Collectors.DnsSniffer.FanoutWorkers = 1
+	c.Collectors.DnsSniffer.TlsKeyLogFile = ""
+	c.Collectors.DnsSniffer.DotPort = 853
+	c.Collectors.DnsSniffer.DohPort = 443
+
+	c.Collectors.DnsProxy.Enable = false
+	c.Collectors.DnsProxy.ListenIP = "0.0.0.0"
+	c.Collectors.DnsProxy.ListenPort = 5300
+	c.Collectors.DnsProxy.UpstreamAddress = "127.0.0.1"
+	c.Collectors.DnsProxy.UpstreamPort = 53
+	c.Collectors.DnsProxy.Timeout = 5
+	c.Collectors.DnsProxy.UdpMaxPending = 1000
+
+	c.Collectors.PcapReader.Enable = false
+	c.Collectors.PcapReader.Path = ""
+	c.Collectors.PcapReader.Port = 53
+	c.Collectors.PcapReader.Watch = false
+	c.Collectors.PcapReader.WatchInterval = 10
+
+	c.Collectors.DnstapReader.Enable = false
+	c.Collectors.DnstapReader.Path = ""
+	c.Collectors.DnstapReader.OriginalTiming = false
 
 	// Subprocessors
 	c.Subprocessors.QuietText.Dnstap = false
@@ -281,11 +422,13 @@ func (c *Config) SetDefault() {
 	c.Subprocessors.GeoIP.DbCityFile = ""
 	c.Subprocessors.GeoIP.DbAsnFile = ""
 	c.Subprocessors.TextFormat = "timestamp identity operation rcode queryip queryport family protocol length qname qtype latency"
+	c.Subprocessors.Transforms = []string{"qname-lowercase", "minimaze-qname", "filtering", "geoip", "anonymize-ip", "quiet-text"}
 
 	// Loggers
 	c.Loggers.Stdout.Enable = false
 	c.Loggers.Stdout.Mode = "text"
 	c.Loggers.Stdout.TextFormat = ""
+	c.Loggers.Stdout.RdataFields = false
 
 	c.Loggers.Dnstap.Enable = false
 	c.Loggers.Dnstap.RemoteAddress = "127.0.0.1"
@@ -294,6 +437,10 @@ func (c *Config) SetDefault() {
 	c.Loggers.Dnstap.SockPath = ""
 	c.Loggers.Dnstap.TlsSupport = false
 	c.Loggers.Dnstap.TlsInsecure = false
+	c.Loggers.Dnstap.Spool.Enable = false
+	c.Loggers.Dnstap.Spool.Path = ""
+	c.Loggers.Dnstap.Spool.MaxSize = 100
+	c.Loggers.Dnstap.Spool.MaxAge = 86400
 
 	c.Loggers.LogFile.Enable = false
 	c.Loggers.LogFile.FilePath = ""
@@ -306,6 +453,7 @@ func (c *Config) SetDefault() {
 	c.Loggers.LogFile.PostRotateCommand = ""
 	c.Loggers.LogFile.PostRotateDelete = false
 	c.Loggers.LogFile.TextFormat = ""
+	c.Loggers.LogFile.RdataFields = false
 
 	c.Loggers.Prometheus.Enable = false
 	c.Loggers.Prometheus.ListenIP = "127.0.0.1"
@@ -337,6 +485,11 @@ func (c *Config) SetDefault() {
 	c.Loggers.TcpClient.Mode = "json"
 	c.Loggers.TcpClient.TextFormat = ""
 	c.Loggers.TcpClient.Delimiter = "\n"
+	c.Loggers.TcpClient.RdataFields = false
+	c.Loggers.TcpClient.Spool.Enable = false
+	c.Loggers.TcpClient.Spool.Path = ""
+	c.Loggers.TcpClient.Spool.MaxSize = 100
+	c.Loggers.TcpClient.Spool.MaxAge = 86400
 
 	c.Loggers.Syslog.Enable = false
 	c.Loggers.Syslog.Severity = "INFO"
@@ -347,6 +500,7 @@ func (c *Config) SetDefault() {
 	c.Loggers.Syslog.Mode = "text"
 	c.Loggers.Syslog.TlsSupport = false
 	c.Loggers.Syslog.TlsInsecure = false
+	c.Loggers.Syslog.RdataFields = false
 
 	c.Loggers.Fluentd.Enable = false
 	c.Loggers.Fluentd.RemoteAddress = "127.0.0.1"
@@ -357,6 +511,10 @@ func (c *Config) SetDefault() {
 	c.Loggers.Fluentd.TlsSupport = false
 	c.Loggers.Fluentd.TlsInsecure = false
 	c.Loggers.Fluentd.Tag = "dns.collector"
+	c.Loggers.Fluentd.Spool.Enable = false
+	c.Loggers.Fluentd.Spool.Path = ""
+	c.Loggers.Fluentd.Spool.MaxSize = 100
+	c.Loggers.Fluentd.Spool.MaxAge = 86400
 
 	c.Loggers.PcapFile.Enable = false
 	c.Loggers.PcapFile.FilePath = ""
@@ -367,6 +525,15 @@ func (c *Config) SetDefault() {
 	c.Loggers.PcapFile.PostRotateCommand = ""
 	c.Loggers.PcapFile.PostRotateDelete = false
 
+	c.Loggers.DnstapFile.Enable = false
+	c.Loggers.DnstapFile.FilePath = ""
+	c.Loggers.DnstapFile.MaxSize = 100
+	c.Loggers.DnstapFile.MaxFiles = 10
+	c.Loggers.DnstapFile.Compress = false
+	c.Loggers.DnstapFile.CompressInterval = 60
+	c.Loggers.DnstapFile.PostRotateCommand = ""
+	c.Loggers.DnstapFile.PostRotateDelete = false
+
 	c.Loggers.InfluxDB.Enable = false
 	c.Loggers.InfluxDB.ServerURL = "http://localhost:8086"
 	c.Loggers.InfluxDB.AuthToken = ""
@@ -387,6 +554,10 @@ func (c *Config) SetDefault() {
 	c.Loggers.LokiClient.BasicAuthLogin = ""
 	c.Loggers.LokiClient.BasicAuthPwd = ""
 	c.Loggers.LokiClient.TenantId = ""
+	c.Loggers.LokiClient.Spool.Enable = false
+	c.Loggers.LokiClient.Spool.Path = ""
+	c.Loggers.LokiClient.Spool.MaxSize = 100
+	c.Loggers.LokiClient.Spool.MaxAge = 86400
 
 	c.Loggers.Statsd.Enable = false
 	c.Loggers.Statsd.Prefix = "dnscollector"
@@ -396,6 +567,96 @@ func (c *Config) SetDefault() {
 	c.Loggers.Statsd.FlushInterval = 10
 	c.Loggers.Statsd.TlsSupport = false
 	c.Loggers.Statsd.TlsInsecure = false
+
+	// Multiplexer
+	c.Multiplexer.Collectors = []MultiplexInOut{}
+	c.Multiplexer.Loggers = []MultiplexInOut{}
+
+	// Routes
+	c.Routes = []Route{}
+
+	// Fan-out to loggers
+	c.FanOut.QueueSize = 4096
+	c.FanOut.OverflowPolicy = PolicyDropNewest
+	c.FanOut.DrainTimeout = 10
+
+	c.Supervisor.BackoffMin = 1
+	c.Supervisor.BackoffMax = 60
+	c.Supervisor.MaxRestarts = 10
+
+	c.ControlPlane.Enable = false
+	c.ControlPlane.ListenIP = "0.0.0.0"
+	c.ControlPlane.ListenPort = 8081
+	c.ControlPlane.MaxQueueUsage = 90
+}
+
+// GetEnabledCollectors returns the type of collectors enabled in the collectors section
+func (c *Config) GetEnabledCollectors() []string {
+	enabled := []string{}
+	if c.Collectors.Dnstap.Enable {
+		enabled = append(enabled, "dnstap")
+	}
+	if c.Collectors.DnsSniffer.Enable {
+		enabled = append(enabled, "dns-sniffer")
+	}
+	if c.Collectors.Tail.Enable {
+		enabled = append(enabled, "tail")
+	}
+	if c.Collectors.DnsProxy.Enable {
+		enabled = append(enabled, "dns-proxy")
+	}
+	if c.Collectors.PcapReader.Enable {
+		enabled = append(enabled, "pcap-reader")
+	}
+	if c.Collectors.DnstapReader.Enable {
+		enabled = append(enabled, "dnstap-reader")
+	}
+	return enabled
+}
+
+// GetEnabledLoggers returns the type of loggers enabled in the loggers section
+func (c *Config) GetEnabledLoggers() []string {
+	enabled := []string{}
+	if c.Loggers.WebServer.Enable {
+		enabled = append(enabled, "webserver")
+	}
+	if c.Loggers.Prometheus.Enable {
+		enabled = append(enabled, "prometheus")
+	}
+	if c.Loggers.Stdout.Enable {
+		enabled = append(enabled, "stdout")
+	}
+	if c.Loggers.LogFile.Enable {
+		enabled = append(enabled, "logfile")
+	}
+	if c.Loggers.Dnstap.Enable {
+		enabled = append(enabled, "dnstap")
+	}
+	if c.Loggers.TcpClient.Enable {
+		enabled = append(enabled, "tcpclient")
+	}
+	if c.Loggers.Syslog.Enable {
+		enabled = append(enabled, "syslog")
+	}
+	if c.Loggers.Fluentd.Enable {
+		enabled = append(enabled, "fluentd")
+	}
+	if c.Loggers.PcapFile.Enable {
+		enabled = append(enabled, "pcapfile")
+	}
+	if c.Loggers.DnstapFile.Enable {
+		enabled = append(enabled, "dnstapfile")
+	}
+	if c.Loggers.InfluxDB.Enable {
+		enabled = append(enabled, "influxdb")
+	}
+	if c.Loggers.LokiClient.Enable {
+		enabled = append(enabled, "lokiclient")
+	}
+	if c.Loggers.Statsd.Enable {
+		enabled = append(enabled, "statsd")
+	}
+	return enabled
 }
 
 func LoadConfig(configPath string) (*Config, error) {
@@ -409,8 +670,9 @@ func LoadConfig(configPath string) (*Config, error) {
 	}
 	defer file.Close()
 
-	// Init new YAML decode
+	// Init new YAML decode, unknown keys are rejected
 	d := yaml.NewDecoder(file)
+	d.KnownFields(true)
 
 	// Start YAML decoding from file
 	if err := d.Decode(&config); err != nil {
@@ -420,6 +682,13 @@ func LoadConfig(configPath string) (*Config, error) {
 	return config, nil
 }
 
+// decodeStrict decodes the yaml document in the config, unknown keys are rejected
+func decodeStrict(b []byte, config *Config) error {
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	return d.Decode(config)
+}
+
 func GetFakeConfig() *Config {
 	config := &Config{}
 	config.SetDefault()
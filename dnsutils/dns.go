@@ -60,7 +60,7 @@ var (
 		49:    "DHCID",
 		50:    "NSEC3",
 		51:    "NSEC3PARAM",
-		52:    "TSLA",
+		52:    "TLSA",
 		53:    "SMIMEA",
 		55:    "HIP",
 		56:    "NINFO",
@@ -217,8 +217,14 @@ func DecodeDns(payload []byte) (DnsHeader, error) {
 	+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 */
 func DecodeQuestion(payload []byte) (string, int, int, error) {
+	return DecodeQuestionAt(DnsLen, payload)
+}
+
+// DecodeQuestionAt decodes the question at the offset, returns the qname, the qtype
+// and the offset of the next question
+func DecodeQuestionAt(offset int, payload []byte) (string, int, int, error) {
 	// Decode QNAME
-	qname, offset, err := ParseLabels(DnsLen, payload)
+	qname, offset, err := ParseLabels(offset, payload)
 	if err != nil {
 		return "", 0, 0, err
 	}
@@ -234,6 +240,22 @@ func DecodeQuestion(payload []byte) (string, int, int, error) {
 	return qname, int(qtype), offset, err
 }
 
+// DecodeQuestions decodes the qdcount questions, returns the questions and the offset
+// of the resource records
+func DecodeQuestions(qdcount int, payload []byte) ([]DnsQuestion, int, error) {
+	questions := []DnsQuestion{}
+	offset := DnsLen
+	for i := 0; i < qdcount; i++ {
+		qname, qtype, offset_next, err := DecodeQuestionAt(offset, payload)
+		if err != nil {
+			return questions, offset, err
+		}
+		questions = append(questions, DnsQuestion{Qname: qname, Qtype: RdatatypeToString(qtype)})
+		offset = offset_next
+	}
+	return questions, offset, nil
+}
+
 /*
     DNS ANSWER
 	                               1  1  1  1  1  1
@@ -302,7 +324,7 @@ func DecodeAnswer(ancount int, start_offset int, payload []byte) ([]DnsAnswer, i
 		}
 		// parse rdata
 		rdatatype := RdatatypeToString(int(t))
-		parsed, err := ParseRdata(rdatatype, rdata, payload, offset_next+10)
+		parsed, fields, err := ParseRdata(rdatatype, rdata, payload, offset_next+10)
 		if err != nil {
 			return answers, offset, err
 		}
@@ -314,6 +336,7 @@ func DecodeAnswer(ancount int, start_offset int, payload []byte) ([]DnsAnswer, i
 			Class:     int(class),
 			Ttl:       int(ttl),
 			Rdata:     parsed,
+			fields:    fields,
 		}
 		answers = append(answers, a)
 
@@ -342,6 +365,9 @@ func _ParseLabels(offset int, payload []byte, pointers map[uint16]int) (string,
 		}
 		// label pointer support ?
 		if length>>6 == 3 {
+			if offset+2 > len(payload) {
+				return "", 0, ErrDecodeDnsLabelTooShort
+			}
 			ptr := binary.BigEndian.Uint16(payload[offset:offset+2]) & 16383
 			_, exist := pointers[ptr]
 			if exist {
@@ -370,33 +396,60 @@ func _ParseLabels(offset int, payload []byte, pointers map[uint16]int) (string,
 	return strings.Join(labels[:], "."), offset, nil
 }
 
-func ParseRdata(rdatatype string, rdata []byte, payload []byte, rdata_offset int) (string, error) {
-	var ret string
-	var err error
+// ParseRdata decodes the rdata in the presentation format and in structured fields,
+// no fields are returned for the types not decoded
+func ParseRdata(rdatatype string, rdata []byte, payload []byte, rdata_offset int) (string, map[string]interface{}, error) {
 	switch rdatatype {
 	case "A":
-		ret, err = ParseA(rdata)
+		return ParseA(rdata)
 	case "AAAA":
-		ret, err = ParseAAAA(rdata)
+		return ParseAAAA(rdata)
 	case "CNAME":
-		ret, err = ParseCNAME(rdata_offset, payload)
+		return ParseCNAME(rdata_offset, payload)
 	case "MX":
-		ret, err = ParseMX(rdata_offset, payload)
+		return ParseMX(rdata_offset, payload)
 	case "SRV":
-		ret, err = ParseSRV(rdata_offset, payload)
+		return ParseSRV(rdata_offset, payload)
 	case "NS":
-		ret, err = ParseNS(rdata_offset, payload)
+		return ParseNS(rdata_offset, payload)
 	case "TXT":
-		ret, err = ParseTXT(rdata)
+		return ParseTXT(rdata)
 	case "PTR":
-		ret, err = ParsePTR(rdata_offset, payload)
+		return ParsePTR(rdata_offset, payload)
 	case "SOA":
-		ret, err = ParseSOA(rdata_offset, payload)
-	default:
-		ret = "-"
-		err = nil
+		return ParseSOA(rdata_offset, payload)
+	case "DS", "CDS":
+		return ParseDS(rdata)
+	case "DNSKEY", "CDNSKEY":
+		return ParseDNSKEY(rdata)
+	case "RRSIG":
+		return ParseRRSIG(rdata, rdata_offset, payload)
+	case "NSEC":
+		return ParseNSEC(rdata, rdata_offset, payload)
+	case "NSEC3":
+		return ParseNSEC3(rdata)
+	case "NSEC3PARAM":
+		return ParseNSEC3PARAM(rdata)
+	case "SVCB", "HTTPS":
+		return ParseSVCB(rdata, rdata_offset, payload)
+	case "CAA":
+		return ParseCAA(rdata)
+	case "NAPTR":
+		return ParseNAPTR(rdata, rdata_offset, payload)
+	case "SSHFP":
+		return ParseSSHFP(rdata)
+	case "TLSA":
+		return ParseTLSA(rdata)
+	case "DNAME":
+		return ParseDNAME(rdata_offset, payload)
+	case "HINFO":
+		return ParseHINFO(rdata)
+	case "LOC":
+		return ParseLOC(rdata)
+	case "URI":
+		return ParseURI(rdata)
 	}
-	return ret, err
+	return "-", nil, nil
 }
 
 /*
@@ -425,17 +478,17 @@ SOA
 |                                               |
 +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 */
-func ParseSOA(rdata_offset int, payload []byte) (string, error) {
+func ParseSOA(rdata_offset int, payload []byte) (string, map[string]interface{}, error) {
 	var offset int
 
 	primaryNS, offset, err := ParseLabels(rdata_offset, payload)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	respMailbox, offset, err := ParseLabels(offset, payload)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	rdata := payload[offset:]
 
@@ -446,7 +499,9 @@ func ParseSOA(rdata_offset int, payload []byte) (string, error) {
 	minimum := binary.BigEndian.Uint32(rdata[16:20])
 
 	soa := fmt.Sprintf("%s %s %d %d %d %d %d", primaryNS, respMailbox, serial, refresh, retry, expire, minimum)
-	return soa, nil
+	fields := map[string]interface{}{"mname": primaryNS, "rname": respMailbox, "serial": int(serial), "refresh": int(refresh),
+		"retry": int(retry), "expire": int(expire), "minimum": int(minimum)}
+	return soa, fields, nil
 }
 
 /*
@@ -458,13 +513,13 @@ IPv4
 |                                               |
 +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 */
-func ParseA(r []byte) (string, error) {
+func ParseA(r []byte) (string, map[string]interface{}, error) {
 	var ip []string
 	for i := 0; i < len(r); i++ {
 		ip = append(ip, strconv.Itoa(int(r[i])))
 	}
 	a := strings.Join(ip, ".")
-	return a, nil
+	return a, map[string]interface{}{"address": a}, nil
 }
 
 /*
@@ -482,13 +537,13 @@ IPv6
 |                                               |
 +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 */
-func ParseAAAA(rdata []byte) (string, error) {
+func ParseAAAA(rdata []byte) (string, map[string]interface{}, error) {
 	var ip []string
 	for i := 0; i < len(rdata); i += 2 {
 		ip = append(ip, fmt.Sprintf("%x", binary.BigEndian.Uint16(rdata[i:i+2])))
 	}
 	aaaa := strings.Join(ip, ":")
-	return aaaa, nil
+	return aaaa, map[string]interface{}{"address": aaaa}, nil
 }
 
 /*
@@ -500,12 +555,12 @@ CNAME
 /                                               /
 +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 */
-func ParseCNAME(rdata_offset int, payload []byte) (string, error) {
+func ParseCNAME(rdata_offset int, payload []byte) (string, map[string]interface{}, error) {
 	cname, _, err := ParseLabels(rdata_offset, payload)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return cname, err
+	return cname, map[string]interface{}{"target": cname}, nil
 }
 
 /*
@@ -519,14 +574,14 @@ MX
 /                                               /
 +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 */
-func ParseMX(rdata_offset int, payload []byte) (string, error) {
+func ParseMX(rdata_offset int, payload []byte) (string, map[string]interface{}, error) {
 	pref := binary.BigEndian.Uint16(payload[rdata_offset : rdata_offset+2])
 	host, _, err := ParseLabels(rdata_offset+2, payload)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	mx := fmt.Sprintf("%d %s", pref, host)
-	return mx, err
+	return mx, map[string]interface{}{"preference": int(pref), "exchange": host}, nil
 }
 
 /*
@@ -543,16 +598,16 @@ SRV
 |                    TARGET                     |
 +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 */
-func ParseSRV(rdata_offset int, payload []byte) (string, error) {
+func ParseSRV(rdata_offset int, payload []byte) (string, map[string]interface{}, error) {
 	priority := binary.BigEndian.Uint16(payload[rdata_offset : rdata_offset+2])
 	weight := binary.BigEndian.Uint16(payload[rdata_offset+2 : rdata_offset+4])
 	port := binary.BigEndian.Uint16(payload[rdata_offset+4 : rdata_offset+6])
 	target, _, err := ParseLabels(rdata_offset+6, payload)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	srv := fmt.Sprintf("%d %d %d %s", priority, weight, port, target)
-	return srv, err
+	return srv, map[string]interface{}{"priority": int(priority), "weight": int(weight), "port": int(port), "target": target}, nil
 }
 
 /*
@@ -564,12 +619,12 @@ NS
 /                                               /
 +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 */
-func ParseNS(rdata_offset int, payload []byte) (string, error) {
+func ParseNS(rdata_offset int, payload []byte) (string, map[string]interface{}, error) {
 	ns, _, err := ParseLabels(rdata_offset, payload)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return ns, err
+	return ns, map[string]interface{}{"target": ns}, nil
 }
 
 /*
@@ -582,10 +637,10 @@ TXT
 /                   TXT-DATA                    /
 +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 */
-func ParseTXT(rdata []byte) (string, error) {
+func ParseTXT(rdata []byte) (string, map[string]interface{}, error) {
 	length := int(rdata[0])
 	txt := string(rdata[1 : length+1])
-	return txt, nil
+	return txt, map[string]interface{}{"text": txt}, nil
 }
 
 /*
@@ -596,10 +651,10 @@ PTR
 	/                   PTRDNAME                    /
 	+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
 */
-func ParsePTR(rdata_offset int, payload []byte) (string, error) {
+func ParsePTR(rdata_offset int, payload []byte) (string, map[string]interface{}, error) {
 	ptr, _, err := ParseLabels(rdata_offset, payload)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
-	return ptr, err
+	return ptr, map[string]interface{}{"target": ptr}, nil
 }
@@ -3,6 +3,7 @@ package dnsutils
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/miekg/dns"
@@ -67,6 +68,38 @@ func TestDecodeQuestion(t *testing.T) {
 	}
 }
 
+func TestDecodeQuestions(t *testing.T) {
+	dm := new(dns.Msg)
+	dm.SetQuestion("dnstapcollector.test.", dns.TypeA)
+	dm.Question = append(dm.Question, dns.Question{Name: "www.dnstapcollector.test.", Qtype: dns.TypeAAAA, Qclass: dns.ClassINET})
+	payload, _ := dm.Pack()
+
+	dh, err := DecodeDns(payload)
+	if err != nil {
+		t.Fatalf("decode dns error: %s", err)
+	}
+	if dh.Qdcount != 2 {
+		t.Fatalf("invalid qdcount: %d", dh.Qdcount)
+	}
+
+	questions, offset_rr, err := DecodeQuestions(dh.Qdcount, payload)
+	if err != nil {
+		t.Fatalf("decode questions error: %s", err)
+	}
+	want := []DnsQuestion{{Qname: "dnstapcollector.test", Qtype: "A"}, {Qname: "www.dnstapcollector.test", Qtype: "AAAA"}}
+	if !reflect.DeepEqual(questions, want) {
+		t.Errorf("invalid questions, want %v, got: %v", want, questions)
+	}
+	if offset_rr != len(payload) {
+		t.Errorf("invalid offset: %d, payload len: %d", offset_rr, len(payload))
+	}
+
+	// the second question is truncated
+	if _, _, err := DecodeQuestions(dh.Qdcount, payload[:len(payload)-2]); !errors.Is(err, ErrDecodeQuestionQtypeTooShort) {
+		t.Errorf("bad error returned: %v", err)
+	}
+}
+
 func TestDecodeAnswer_Ns(t *testing.T) {
 	fqdn := "dnstapcollector.test."
 
@@ -396,6 +429,14 @@ func TestDecodeDnsAnswer_InvalidPtr(t *testing.T) {
 	}
 }
 
+func TestDecodeDnsAnswer_InvalidPtr_Truncated(t *testing.T) {
+	// the pointer is cut after the first byte
+	_, _, err := ParseLabels(0, []byte{5, 104, 101, 108, 108, 111, 192})
+	if !errors.Is(err, ErrDecodeDnsLabelTooShort) {
+		t.Errorf("bad error returned: %v", err)
+	}
+}
+
 func TestDecodeDnsAnswer_InvalidPtr_Loop1(t *testing.T) {
 	// loop qname on himself
 	payload := []byte{128, 177, 129, 160, 0, 1, 0, 1, 0, 0, 0, 1, 5, 104, 101, 108, 108, 111, 4,
@@ -422,3 +463,132 @@ func TestDecodeDnsAnswer_InvalidPtr_Loop2(t *testing.T) {
 		t.Errorf("bad error returned: %v", err)
 	}
 }
+
+func TestDecodeRdataRecords(t *testing.T) {
+	fqdn := "dnstapcollector.test."
+
+	testcases := []struct {
+		rrtype string
+		rdata  string
+		want   string
+	}{
+		{
+			rrtype: "DS",
+			rdata:  "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+			want:   "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+		},
+		{
+			rrtype: "DNSKEY",
+			rdata:  "257 3 8 AwEAAagAIKlVZrpC6Ia7gEzahOR+9W29euxhJhVVLOyQbSEW0O8gcCjF",
+			want:   "257 3 8 AwEAAagAIKlVZrpC6Ia7gEzahOR+9W29euxhJhVVLOyQbSEW0O8gcCjF",
+		},
+		{
+			rrtype: "RRSIG",
+			rdata:  "A 8 2 3600 20220101000000 20211201000000 12345 collector.test. c2lnbmF0dXJl",
+			want:   "A 8 2 3600 20220101000000 20211201000000 12345 collector.test c2lnbmF0dXJl",
+		},
+		{
+			rrtype: "NSEC",
+			rdata:  "next.collector.test. A NS SOA RRSIG NSEC DNSKEY CAA",
+			want:   "next.collector.test A NS SOA RRSIG NSEC DNSKEY CAA",
+		},
+		{
+			rrtype: "NSEC3",
+			rdata:  "1 1 12 AABBCCDD 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR A RRSIG",
+			want:   "1 1 12 AABBCCDD 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR A RRSIG",
+		},
+		{
+			rrtype: "NSEC3PARAM",
+			rdata:  "1 0 0 -",
+			want:   "1 0 0 -",
+		},
+		{
+			rrtype: "HTTPS",
+			rdata:  "1 . alpn=h2,h3 port=8443 ipv4hint=192.0.2.1,192.0.2.2 ipv6hint=2001:db8::1",
+			want:   "1 . alpn=h2,h3 port=8443 ipv4hint=192.0.2.1,192.0.2.2 ipv6hint=2001:db8::1",
+		},
+		{
+			rrtype: "SVCB",
+			rdata:  "0 svc.collector.test.",
+			want:   "0 svc.collector.test",
+		},
+		{
+			rrtype: "CAA",
+			rdata:  "0 issue \"letsencrypt.org\"",
+			want:   "0 issue \"letsencrypt.org\"",
+		},
+		{
+			rrtype: "NAPTR",
+			rdata:  "100 10 \"S\" \"SIP+D2U\" \"\" _sip._udp.collector.test.",
+			want:   "100 10 \"S\" \"SIP+D2U\" \"\" _sip._udp.collector.test",
+		},
+		{
+			rrtype: "SSHFP",
+			rdata:  "4 2 123456789ABCDEF67890123456789ABCDEF67890123456789ABCDEF123456789",
+			want:   "4 2 123456789ABCDEF67890123456789ABCDEF67890123456789ABCDEF123456789",
+		},
+		{
+			rrtype: "TLSA",
+			rdata:  "3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6",
+			want:   "3 1 1 0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6",
+		},
+		{
+			rrtype: "DNAME",
+			rdata:  "collector.example.",
+			want:   "collector.example",
+		},
+		{
+			rrtype: "HINFO",
+			rdata:  "\"ARMv8\" \"Linux\"",
+			want:   "\"ARMv8\" \"Linux\"",
+		},
+		{
+			rrtype: "LOC",
+			rdata:  "52 22 23.000 N 4 53 32.000 E -2.00m 1m 10000m 10m",
+			want:   "52 22 23.000 N 4 53 32.000 E -2.00m 1m 10000m 10m",
+		},
+		{
+			rrtype: "URI",
+			rdata:  "10 1 \"ftp://ftp1.example.com/public\"",
+			want:   "10 1 \"ftp://ftp1.example.com/public\"",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.rrtype, func(t *testing.T) {
+			dm := new(dns.Msg)
+			dm.SetQuestion(fqdn, dns.TypeA)
+
+			rr, err := dns.NewRR(fmt.Sprintf("%s %s %s", fqdn, tc.rrtype, tc.rdata))
+			if err != nil {
+				t.Fatalf("invalid rr: %s", err)
+			}
+			dm.Answer = append(dm.Answer, rr)
+			payload, _ := dm.Pack()
+
+			_, _, offset_rr, _ := DecodeQuestion(payload)
+			answer, _, err := DecodeAnswer(len(dm.Answer), offset_rr, payload)
+			if err != nil {
+				t.Fatalf("decode answer error: %s", err)
+			}
+			if answer[0].Rdatatype != tc.rrtype {
+				t.Errorf("invalid rdatatype, want %s, got: %s", tc.rrtype, answer[0].Rdatatype)
+			}
+			if answer[0].Rdata != tc.want {
+				t.Errorf("invalid decode for rdata %s, want %s, got: %s", tc.rrtype, tc.want, answer[0].Rdata)
+			}
+		})
+	}
+}
+
+func TestDecodeRdataNSEC3_Malformed(t *testing.T) {
+	// nsec3 with a salt length greater than the rdata
+	payload := []byte{46, 172, 129, 128, 0, 1, 0, 1, 0, 0, 0, 0, 4, 116, 101, 115, 116, 0, 0, 50, 0, 1,
+		192, 12, 0, 50, 0, 1, 0, 0, 14, 16, 0, 6, 1, 0, 0, 12, 8, 170}
+
+	_, _, offset_rr, _ := DecodeQuestion(payload)
+	_, _, err := DecodeAnswer(1, offset_rr, payload)
+	if !errors.Is(err, ErrDecodeDnsAnswerRdataInvalid) {
+		t.Errorf("bad error returned: %v", err)
+	}
+}
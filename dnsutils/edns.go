@@ -2,25 +2,35 @@ package dnsutils
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 )
 
 var ErrDecodeEdnsBadRootDomain = errors.New("edns, name MUST be 0 (root domain)")
 var ErrDecodeEdnsDataTooShort = errors.New("edns, not enough data to decode rdata answer")
 var ErrDecodeEdnsOptionTooShort = errors.New("edns, not enough data to decode option answer")
 var ErrDecodeEdnsOptionCsubnetBadFamily = errors.New("edns, csubnet option bad family")
+var ErrDecodeEdnsOptionInvalid = errors.New("edns, invalid option data")
 
 var (
 	OptCodes = map[int]string{
 		3:  "NSID",
+		5:  "DAU",
+		6:  "DHU",
+		7:  "N3U",
 		8:  "CSUBNET",
 		9:  "EXPIRE",
 		10: "COOKIE",
 		11: "KEEPALIVE",
 		12: "PADDING",
+		13: "CHAIN",
+		14: "KEY-TAG",
 		15: "ERRORS",
+		19: "ZONEVERSION",
 	}
 	ErrorCodeToString = map[int]string{
 		0:  "Other",
@@ -122,7 +132,7 @@ func DecodeEDNS(arcount int, start_offset int, payload []byte) (DnsExtended, int
 					break
 				}
 
-				if len(payload) < 4 {
+				if len(payload[offset_next:]) < 4 {
 					return edns, offset, ErrDecodeEdnsOptionTooShort
 				}
 
@@ -164,6 +174,24 @@ func ParseOption(optName string, optData []byte) (string, error) {
 		ret, err = ParseErrors(optData)
 	case "CSUBNET":
 		ret, err = ParseCsubnet(optData)
+	case "NSID":
+		ret, err = ParseNsid(optData)
+	case "COOKIE":
+		ret, err = ParseCookie(optData)
+	case "EXPIRE":
+		ret, err = ParseExpire(optData)
+	case "KEEPALIVE":
+		ret, err = ParseKeepalive(optData)
+	case "PADDING":
+		ret, err = ParsePadding(optData)
+	case "CHAIN":
+		ret, err = ParseChain(optData)
+	case "KEY-TAG":
+		ret, err = ParseKeyTag(optData)
+	case "DAU", "DHU", "N3U":
+		ret, err = ParseAlgorithms(optData)
+	case "ZONEVERSION":
+		ret, err = ParseZoneVersion(optData)
 	default:
 		ret = "-"
 		err = nil
@@ -184,6 +212,9 @@ func ParseOption(optName string, optData []byte) (string, error) {
    +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
 */
 func ParseErrors(d []byte) (string, error) {
+	if len(d) < 2 {
+		return "-", ErrDecodeEdnsOptionTooShort
+	}
 	code := int(binary.BigEndian.Uint16(d[:2]))
 	infoCode := ""
 	if s, ok := ErrorCodeToString[code]; ok {
@@ -216,6 +247,9 @@ func ParseErrors(d []byte) (string, error) {
    +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
 */
 func ParseCsubnet(d []byte) (string, error) {
+	if len(d) < 4 {
+		return "-", ErrDecodeEdnsOptionTooShort
+	}
 	family := int(binary.BigEndian.Uint16(d[:2]))
 	srcMask := d[2]
 	switch family {
@@ -233,3 +267,224 @@ func ParseCsubnet(d []byte) (string, error) {
 		return "-", ErrDecodeEdnsOptionCsubnetBadFamily
 	}
 }
+
+/*
+ https://datatracker.ietf.org/doc/html/rfc5001
+
+ NSID EDNS0 option format, empty in the queries
+
+ The identifier is returned in hexadecimal followed by the printable form
+*/
+func ParseNsid(d []byte) (string, error) {
+	if len(d) == 0 {
+		return "-", nil
+	}
+	printable := make([]byte, len(d))
+	for i, b := range d {
+		if b < ' ' || b > '~' {
+			b = '.'
+		}
+		printable[i] = b
+	}
+	nsid := fmt.Sprintf("%s %s", strings.ToUpper(hex.EncodeToString(d)), QuoteString(printable))
+	return nsid, nil
+}
+
+/*
+ https://datatracker.ietf.org/doc/html/rfc7873
+
+ COOKIE EDNS0 option format
+                                             1   1   1   1   1   1
+     0   1   2   3   4   5   6   7   8   9   0   1   2   3   4   5
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+4: |                                                               |
+   /                  CLIENT COOKIE (8 bytes)                      /
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+12:/                  SERVER COOKIE (8 to 32 bytes)                /
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+
+ The client and the server cookies are returned in hexadecimal, - without server cookie,
+ the cookies with an invalid length are kept as sent, the server replies with FORMERR
+*/
+func ParseCookie(d []byte) (string, error) {
+	if len(d) == 0 {
+		return "-", ErrDecodeEdnsOptionInvalid
+	}
+	if len(d) <= 8 {
+		return fmt.Sprintf("%s -", strings.ToUpper(hex.EncodeToString(d))), nil
+	}
+	cookie := fmt.Sprintf("%s %s", strings.ToUpper(hex.EncodeToString(d[:8])), strings.ToUpper(hex.EncodeToString(d[8:])))
+	return cookie, nil
+}
+
+/*
+ https://datatracker.ietf.org/doc/html/rfc7314
+
+ EXPIRE EDNS0 option format, empty in the queries
+                                             1   1   1   1   1   1
+     0   1   2   3   4   5   6   7   8   9   0   1   2   3   4   5
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+4: |                            EXPIRE                             |
+   |                                                               |
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+
+ The expire timer is returned in seconds
+*/
+func ParseExpire(d []byte) (string, error) {
+	switch len(d) {
+	case 0:
+		return "-", nil
+	case 4:
+		return strconv.Itoa(int(binary.BigEndian.Uint32(d))), nil
+	default:
+		return "-", ErrDecodeEdnsOptionInvalid
+	}
+}
+
+/*
+ https://datatracker.ietf.org/doc/html/rfc7828
+
+ edns-tcp-keepalive EDNS0 option format, empty in the queries
+                                             1   1   1   1   1   1
+     0   1   2   3   4   5   6   7   8   9   0   1   2   3   4   5
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+4: |                           TIMEOUT                             |
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+
+ The timeout in units of 100 milliseconds is returned in seconds
+*/
+func ParseKeepalive(d []byte) (string, error) {
+	switch len(d) {
+	case 0:
+		return "-", nil
+	case 2:
+		timeout := float64(binary.BigEndian.Uint16(d)) / 10
+		return strconv.FormatFloat(timeout, 'f', 1, 64), nil
+	default:
+		return "-", ErrDecodeEdnsOptionInvalid
+	}
+}
+
+/*
+ https://datatracker.ietf.org/doc/html/rfc7830
+
+ Padding EDNS0 option format, the padding octets are returned as a length
+*/
+func ParsePadding(d []byte) (string, error) {
+	return strconv.Itoa(len(d)), nil
+}
+
+/*
+ https://datatracker.ietf.org/doc/html/rfc7901
+
+ CHAIN EDNS0 option format
+                                             1   1   1   1   1   1
+     0   1   2   3   4   5   6   7   8   9   0   1   2   3   4   5
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+4: /                 CLOSEST TRUST POINT (uncompressed)            /
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+
+ The name is in the option only, the compression pointers are rejected
+*/
+func ParseChain(d []byte) (string, error) {
+	labels := []string{}
+	offset := 0
+	for {
+		if offset >= len(d) {
+			return "-", ErrDecodeEdnsOptionTooShort
+		}
+		length := int(d[offset])
+		if length == 0 {
+			offset++
+			break
+		}
+		if length > 63 {
+			return "-", ErrDecodeEdnsOptionInvalid
+		}
+		if offset+1+length > len(d) {
+			return "-", ErrDecodeEdnsOptionTooShort
+		}
+		labels = append(labels, string(d[offset+1:offset+1+length]))
+		offset += 1 + length
+	}
+	if offset != len(d) || offset > 255 {
+		return "-", ErrDecodeEdnsOptionInvalid
+	}
+	if len(labels) == 0 {
+		return ".", nil
+	}
+	return strings.Join(labels, "."), nil
+}
+
+/*
+ https://datatracker.ietf.org/doc/html/rfc8145
+
+ edns-key-tag EDNS0 option format
+                                             1   1   1   1   1   1
+     0   1   2   3   4   5   6   7   8   9   0   1   2   3   4   5
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+4: |                           KEY-TAG                             |
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+6: /                           KEY-TAG ...                         /
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+*/
+func ParseKeyTag(d []byte) (string, error) {
+	if len(d) == 0 || len(d)%2 != 0 {
+		return "-", ErrDecodeEdnsOptionInvalid
+	}
+	tags := []string{}
+	for i := 0; i < len(d); i += 2 {
+		tags = append(tags, strconv.Itoa(int(binary.BigEndian.Uint16(d[i:i+2]))))
+	}
+	return strings.Join(tags, " "), nil
+}
+
+/*
+ https://datatracker.ietf.org/doc/html/rfc6975
+
+ DAU, DHU and N3U EDNS0 options format, one algorithm number per octet
+*/
+func ParseAlgorithms(d []byte) (string, error) {
+	if len(d) == 0 {
+		return "-", nil
+	}
+	algs := []string{}
+	for _, alg := range d {
+		algs = append(algs, strconv.Itoa(int(alg)))
+	}
+	return strings.Join(algs, " "), nil
+}
+
+/*
+ https://datatracker.ietf.org/doc/html/rfc9660
+
+ ZONEVERSION EDNS0 option format, empty in the queries
+                                             1   1   1   1   1   1
+     0   1   2   3   4   5   6   7   8   9   0   1   2   3   4   5
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+4: |          LABELCOUNT           |            TYPE               |
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+6: /                           VERSION                             /
+   +---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+---+
+
+ The version is the serial of the SOA for the type 0, in hexadecimal otherwise
+*/
+func ParseZoneVersion(d []byte) (string, error) {
+	if len(d) == 0 {
+		return "-", nil
+	}
+	if len(d) < 2 {
+		return "-", ErrDecodeEdnsOptionInvalid
+	}
+	if d[1] == 0 {
+		if len(d) != 6 {
+			return "-", ErrDecodeEdnsOptionInvalid
+		}
+		return fmt.Sprintf("%d SOA-SERIAL %d", d[0], binary.BigEndian.Uint32(d[2:])), nil
+	}
+	version := "-"
+	if len(d) > 2 {
+		version = strings.ToUpper(hex.EncodeToString(d[2:]))
+	}
+	return fmt.Sprintf("%d %d %s", d[0], d[1], version), nil
+}
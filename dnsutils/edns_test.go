@@ -69,3 +69,81 @@ func TestDecodeReply_EDNS(t *testing.T) {
 		t.Errorf("edns error returned: %v", err)
 	}
 }
+
+func TestDecodeEDNS_Options(t *testing.T) {
+	testcases := []struct {
+		name string
+		code uint16
+		data []byte
+		want string
+	}{
+		{name: "NSID", code: 3, data: []byte("ns1\x00"), want: "6E733100 \"ns1.\""},
+		{name: "NSID", code: 3, data: []byte{}, want: "-"},
+		{name: "COOKIE", code: 10, data: []byte{1, 2, 3, 4, 5, 6, 7, 8}, want: "0102030405060708 -"},
+		{name: "COOKIE", code: 10, data: []byte{1, 2, 3, 4, 5, 6, 7, 8, 0xa, 0xb, 0xc, 0xd, 0xe, 0xf, 0x10, 0x11},
+			want: "0102030405060708 0A0B0C0D0E0F1011"},
+		{name: "COOKIE", code: 10, data: []byte{0xaa, 0xaa}, want: "AAAA -"},
+		{name: "EXPIRE", code: 9, data: []byte{0, 0, 0x0e, 0x10}, want: "3600"},
+		{name: "KEEPALIVE", code: 11, data: []byte{0, 125}, want: "12.5"},
+		{name: "PADDING", code: 12, data: make([]byte, 42), want: "42"},
+		{name: "CHAIN", code: 13, data: []byte{4, 't', 'e', 's', 't', 0}, want: "test"},
+		{name: "CHAIN", code: 13, data: []byte{0}, want: "."},
+		{name: "KEY-TAG", code: 14, data: []byte{0x4f, 0x66, 0x9f, 0x3e}, want: "20326 40766"},
+		{name: "DAU", code: 5, data: []byte{8, 13, 15}, want: "8 13 15"},
+		{name: "ZONEVERSION", code: 19, data: []byte{2, 0, 0x78, 0x83, 0x7b, 0xe5}, want: "2 SOA-SERIAL 2021882853"},
+		{name: "ZONEVERSION", code: 19, data: []byte{2, 1, 0xca, 0xfe}, want: "2 1 CAFE"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			dm := new(dns.Msg)
+			dm.SetQuestion("dnstapcollector.test.", dns.TypeA)
+
+			e := &dns.OPT{}
+			e.Hdr.Name = "."
+			e.Hdr.Rrtype = dns.TypeOPT
+			e.Option = append(e.Option, &dns.EDNS0_LOCAL{Code: tc.code, Data: tc.data})
+			dm.Extra = append(dm.Extra, e)
+
+			payload, _ := dm.Pack()
+			_, _, offset_rr, _ := DecodeQuestion(payload)
+			edns, _, err := DecodeEDNS(len(dm.Extra), offset_rr, payload)
+			if err != nil {
+				t.Fatalf("edns error returned: %v", err)
+			}
+			if len(edns.Options) != 1 {
+				t.Fatalf("one option expected, got %d", len(edns.Options))
+			}
+			if edns.Options[0].Name != tc.name || edns.Options[0].Data != tc.want {
+				t.Errorf("invalid option, want %s %s, got: %s %s", tc.name, tc.want, edns.Options[0].Name, edns.Options[0].Data)
+			}
+		})
+	}
+}
+
+func TestDecodeEDNS_OptionsInvalid(t *testing.T) {
+	testcases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "COOKIE", data: []byte{}},
+		{name: "EXPIRE", data: []byte{0, 1}},
+		{name: "KEEPALIVE", data: []byte{1}},
+		{name: "KEY-TAG", data: []byte{1, 2, 3}},
+		{name: "ZONEVERSION", data: []byte{2, 0, 1}},
+		{name: "CHAIN", data: []byte{}},
+		{name: "CHAIN", data: []byte{0xc5}},
+		{name: "CHAIN", data: []byte{0xc0, 0x00}},
+		{name: "CHAIN", data: []byte{4, 't', 'e', 's'}},
+		{name: "CHAIN", data: []byte{4, 't', 'e', 's', 't'}},
+		{name: "CHAIN", data: []byte{4, 't', 'e', 's', 't', 0, 0}},
+		{name: "ERRORS", data: []byte{1}},
+		{name: "CSUBNET", data: []byte{0, 1}},
+	}
+
+	for _, tc := range testcases {
+		if _, err := ParseOption(tc.name, tc.data); err == nil {
+			t.Errorf("%s: error expected with the data %v", tc.name, tc.data)
+		}
+	}
+}
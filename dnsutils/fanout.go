@@ -0,0 +1,93 @@
+package dnsutils
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	PolicyDropNewest = "drop-newest"
+	PolicyDropOldest = "drop-oldest"
+	PolicyBlock      = "block"
+)
+
+func IsValidPolicy(policy string) bool {
+	switch policy {
+	case
+		PolicyDropNewest,
+		PolicyDropOldest,
+		PolicyBlock:
+		return true
+	}
+	return false
+}
+
+// DropCounters counts the dns messages dropped or lost by each logger
+type DropCounters struct {
+	sync.RWMutex
+	counters map[string]uint64
+}
+
+func NewDropCounters() *DropCounters {
+	return &DropCounters{counters: make(map[string]uint64)}
+}
+
+// Register initializes the counter of the logger to zero
+func (c *DropCounters) Register(name string) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.counters[name]; !ok {
+		c.counters[name] = 0
+	}
+}
+
+func (c *DropCounters) Inc(name string) {
+	c.Lock()
+	defer c.Unlock()
+	c.counters[name]++
+}
+
+func (c *DropCounters) Add(name string, n uint64) {
+	c.Lock()
+	defer c.Unlock()
+	c.counters[name] += n
+}
+
+func (c *DropCounters) Get(name string) uint64 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.counters[name]
+}
+
+// Total returns the sum of the counters
+func (c *DropCounters) Total() uint64 {
+	c.RLock()
+	defer c.RUnlock()
+
+	var total uint64
+	for _, v := range c.counters {
+		total += v
+	}
+	return total
+}
+
+// Names returns the sorted list of registered loggers
+func (c *DropCounters) Names() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	ret := []string{}
+	for k := range c.counters {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Dropped is shared by all loggers queues and read by the metrics loggers
+var Dropped = NewDropCounters()
+
+// Lost is shared by the loggers and the supervisors, it counts the messages not sent and not spooled
+// on error and the messages not transferred to a restarted worker. It is added to the queues losses
+// in the shutdown report.
+var Lost = NewDropCounters()
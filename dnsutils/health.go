@@ -0,0 +1,65 @@
+package dnsutils
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	WorkerRunning    = "running"
+	WorkerRestarting = "restarting"
+	WorkerFailed     = "failed"
+)
+
+// WorkerHealth is the state of a supervised collector or logger
+type WorkerHealth struct {
+	State     string `json:"state"`
+	Restarts  int    `json:"restarts"`
+	LastError string `json:"last-error,omitempty"`
+}
+
+// HealthStates keeps the state of all the supervised workers
+type HealthStates struct {
+	sync.RWMutex
+	states map[string]WorkerHealth
+}
+
+func NewHealthStates() *HealthStates {
+	return &HealthStates{states: make(map[string]WorkerHealth)}
+}
+
+func (h *HealthStates) Set(name string, health WorkerHealth) {
+	h.Lock()
+	defer h.Unlock()
+	h.states[name] = health
+}
+
+func (h *HealthStates) Get(name string) (WorkerHealth, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	health, ok := h.states[name]
+	return health, ok
+}
+
+// Remove forgets the worker, used when it is removed from the configuration
+func (h *HealthStates) Remove(name string) {
+	h.Lock()
+	defer h.Unlock()
+	delete(h.states, name)
+}
+
+// Names returns the sorted list of supervised workers
+func (h *HealthStates) Names() []string {
+	h.RLock()
+	defer h.RUnlock()
+
+	ret := []string{}
+	for k := range h.states {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Health is updated by the supervisors of the workers and read by the REST API
+var Health = NewHealthStates()
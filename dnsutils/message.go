@@ -3,7 +3,6 @@ package dnsutils
 import (
 	"bytes"
 	"fmt"
-	"log"
 	"strconv"
 	"time"
 )
@@ -19,6 +18,10 @@ type DnsAnswer struct {
 	Class     int    `json:"-" msgpack:"-"`
 	Ttl       int    `json:"ttl" msgpack:"ttl"`
 	Rdata     string `json:"rdata" msgpack:"rdata"`
+	// structured rdata, only set for the loggers with the rdata fields enabled
+	RdataFields map[string]interface{} `json:"rdata-fields,omitempty" msgpack:"-"`
+	// fields decoded from the rdata on the wire
+	fields map[string]interface{}
 }
 
 type DnsFlags struct {
@@ -27,6 +30,20 @@ type DnsFlags struct {
 	AA bool `json:"aa" msgpack:"aa"`
 	RA bool `json:"ra" msgpack:"ra"`
 	AD bool `json:"ad" msgpack:"ad"`
+	RD bool `json:"rd" msgpack:"rd"`
+	CD bool `json:"cd" msgpack:"cd"`
+}
+
+type DnsCounts struct {
+	Qdcount int `json:"qdcount" msgpack:"qdcount"`
+	Ancount int `json:"ancount" msgpack:"ancount"`
+	Nscount int `json:"nscount" msgpack:"nscount"`
+	Arcount int `json:"arcount" msgpack:"arcount"`
+}
+
+type DnsQuestion struct {
+	Qname string `json:"qname" msgpack:"qname"`
+	Qtype string `json:"qtype" msgpack:"qtype"`
 }
 
 type DnsGeo struct {
@@ -53,17 +70,19 @@ type DnsRRs struct {
 }
 
 type Dns struct {
-	Type            string   `json:"-" msgpack:"-"`
-	Payload         []byte   `json:"-" msgpack:"-"`
-	Length          int      `json:"length" msgpack:"-"`
-	Id              int      `json:"-" msgpack:"-"`
-	Opcode          int      `json:"opcode" msgpack:"opcode"`
-	Rcode           string   `json:"rcode" msgpack:"rcode"`
-	Qname           string   `json:"qname" msgpack:"qname"`
-	Qtype           string   `json:"qtype" msgpack:"qtype"`
-	Flags           DnsFlags `json:"flags" msgpack:"flags"`
-	DnsRRs          DnsRRs   `json:"resource-records" msgpack:"resource-records"`
-	MalformedPacket int      `json:"malformed-packet" msgpack:"malformed-packet"`
+	Type            string        `json:"-" msgpack:"-"`
+	Payload         []byte        `json:"-" msgpack:"-"`
+	Length          int           `json:"length" msgpack:"-"`
+	Id              int           `json:"id" msgpack:"id"`
+	Opcode          int           `json:"opcode" msgpack:"opcode"`
+	Rcode           string        `json:"rcode" msgpack:"rcode"`
+	Qname           string        `json:"qname" msgpack:"qname"`
+	Qtype           string        `json:"qtype" msgpack:"qtype"`
+	Questions       []DnsQuestion `json:"questions" msgpack:"questions"`
+	Flags           DnsFlags      `json:"flags" msgpack:"flags"`
+	Counts          DnsCounts     `json:"counts" msgpack:"counts"`
+	DnsRRs          DnsRRs        `json:"resource-records" msgpack:"resource-records"`
+	MalformedPacket int           `json:"malformed-packet" msgpack:"malformed-packet"`
 }
 
 type DnsOption struct {
@@ -126,6 +145,7 @@ func (dm *DnsMessage) Init() {
 		Rcode:           "-",
 		Qtype:           "-",
 		Qname:           "-",
+		Questions:       []DnsQuestion{},
 		DnsRRs:          DnsRRs{Answers: []DnsAnswer{}, Nameservers: []DnsAnswer{}, Records: []DnsAnswer{}},
 	}
 
@@ -162,16 +182,25 @@ func (dm *DnsMessage) Bytes(format []string, delimiter string) []byte {
 				s.WriteString("-")
 			}
 		case "edns-csubnet":
-			if len(dm.EDNS.Options) > 0 {
-				for _, opt := range dm.EDNS.Options {
-					if opt.Name == "CSUBNET" {
-						s.WriteString(opt.Data)
-						break
-					}
-				}
-			} else {
-				s.WriteString("-")
-			}
+			s.WriteString(dm.EdnsOption("CSUBNET"))
+		case "edns-errors":
+			s.WriteString(dm.EdnsOption("ERRORS"))
+		case "edns-nsid":
+			s.WriteString(dm.EdnsOption("NSID"))
+		case "edns-cookie":
+			s.WriteString(dm.EdnsOption("COOKIE"))
+		case "edns-expire":
+			s.WriteString(dm.EdnsOption("EXPIRE"))
+		case "edns-keepalive":
+			s.WriteString(dm.EdnsOption("KEEPALIVE"))
+		case "edns-padding":
+			s.WriteString(dm.EdnsOption("PADDING"))
+		case "edns-chain":
+			s.WriteString(dm.EdnsOption("CHAIN"))
+		case "edns-keytag":
+			s.WriteString(dm.EdnsOption("KEY-TAG"))
+		case "edns-zoneversion":
+			s.WriteString(dm.EdnsOption("ZONEVERSION"))
 		case "answercount":
 			s.WriteString(strconv.Itoa(len(dm.DNS.DnsRRs.Answers)))
 		case "id":
@@ -255,8 +284,29 @@ func (dm *DnsMessage) Bytes(format []string, delimiter string) []byte {
 			} else {
 				s.WriteString("-")
 			}
+		case "rd":
+			if dm.DNS.Flags.RD {
+				s.WriteString("RD")
+			} else {
+				s.WriteString("-")
+			}
+		case "cd":
+			if dm.DNS.Flags.CD {
+				s.WriteString("CD")
+			} else {
+				s.WriteString("-")
+			}
+		case "qdcount":
+			s.WriteString(strconv.Itoa(dm.DNS.Counts.Qdcount))
+		case "ancount":
+			s.WriteString(strconv.Itoa(dm.DNS.Counts.Ancount))
+		case "nscount":
+			s.WriteString(strconv.Itoa(dm.DNS.Counts.Nscount))
+		case "arcount":
+			s.WriteString(strconv.Itoa(dm.DNS.Counts.Arcount))
 		default:
-			log.Fatalf("unsupport directive for text format: %s", word)
+			// unknown directives are rejected when the configuration is loaded
+			s.WriteString("-")
 		}
 
 		if i < len(format)-1 {
@@ -269,6 +319,16 @@ func (dm *DnsMessage) Bytes(format []string, delimiter string) []byte {
 	return s.Bytes()
 }
 
+// EdnsOption returns the data of the first edns option with this name, - if not present
+func (dm *DnsMessage) EdnsOption(name string) string {
+	for _, opt := range dm.EDNS.Options {
+		if opt.Name == name {
+			return opt.Data
+		}
+	}
+	return "-"
+}
+
 func (dm *DnsMessage) String(format []string) string {
 	delimiter := "\n"
 	return string(dm.Bytes(format, delimiter))
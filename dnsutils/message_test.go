@@ -1,8 +1,12 @@
 package dnsutils
 
 import (
+	"encoding/json"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/miekg/dns"
 )
 
 func TestDnsMessageToText(t *testing.T) {
@@ -17,3 +21,95 @@ func TestDnsMessageToText(t *testing.T) {
 		t.Errorf("text dns message invalid; %s", line)
 	}
 }
+
+func TestDnsMessageRdataFields(t *testing.T) {
+	// the fields are decoded from the wire data, the character strings can contain spaces
+	m := new(dns.Msg)
+	m.SetQuestion("dnscollector.test.", dns.TypeA)
+	for _, rr := range []string{
+		"MX 10 mail.dnscollector.test.",
+		"SOA ns1.dnscollector.test. admin.dnscollector.test. 2022010101 900 900 1800 60",
+		"HTTPS 1 . alpn=h2,h3 port=8443 no-default-alpn",
+		"CAA 0 issue \"ca.test; \\\"policy\\\"\"",
+		"LOC 52 30 0.000 N 4 15 0.000 W -2.00m 1m 10000m 10m",
+		"HINFO \"Intel x86\" \"Linux 5.10\"",
+		"TYPE65280 \\# 2 ABCD",
+	} {
+		r, err := dns.NewRR("dnscollector.test. 300 IN " + rr)
+		if err != nil {
+			t.Fatalf("invalid rr %s: %s", rr, err)
+		}
+		m.Answer = append(m.Answer, r)
+	}
+	payload, _ := m.Pack()
+	_, _, offset_rr, _ := DecodeQuestion(payload)
+	answers, _, err := DecodeAnswer(len(m.Answer), offset_rr, payload)
+	if err != nil {
+		t.Fatalf("decode answer error: %s", err)
+	}
+
+	dm := DnsMessage{}
+	dm.Init()
+	dm.DNS.DnsRRs.Answers = answers
+
+	rdm := dm.WithRdataFields()
+	want := []map[string]interface{}{
+		{"preference": 10, "exchange": "mail.dnscollector.test"},
+		{"mname": "ns1.dnscollector.test", "rname": "admin.dnscollector.test", "serial": 2022010101,
+			"refresh": 900, "retry": 900, "expire": 1800, "minimum": 60},
+		{"priority": 1, "target": ".", "params": map[string]interface{}{
+			"alpn": []string{"h2", "h3"}, "port": 8443, "no-default-alpn": true}},
+		{"flags": 0, "tag": "issue", "value": "ca.test; \"policy\""},
+		{"latitude": 52.5, "longitude": -4.25, "altitude": -2.0, "size": 1.0,
+			"horizontal-precision": 10000.0, "vertical-precision": 10.0},
+		{"cpu": "Intel x86", "os": "Linux 5.10"},
+		nil,
+	}
+	if len(rdm.DNS.DnsRRs.Answers) != len(want) {
+		t.Fatalf("want %d answers, got %d", len(want), len(rdm.DNS.DnsRRs.Answers))
+	}
+	for i, rr := range rdm.DNS.DnsRRs.Answers {
+		if !reflect.DeepEqual(rr.RdataFields, want[i]) {
+			t.Errorf("invalid rdata fields for %s, want %v, got: %v", rr.Rdatatype, want[i], rr.RdataFields)
+		}
+	}
+
+	// the original message is not modified and encoded without the fields
+	if dm.DNS.DnsRRs.Answers[0].RdataFields != nil {
+		t.Errorf("the original message should not be modified")
+	}
+	encoded, _ := json.Marshal(dm)
+	if strings.Contains(string(encoded), "rdata-fields") {
+		t.Errorf("no rdata fields expected in json: %s", encoded)
+	}
+	encoded, _ = json.Marshal(rdm)
+	if !strings.Contains(string(encoded), `"rdata-fields":{"exchange":"mail.dnscollector.test","preference":10}`) {
+		t.Errorf("rdata fields expected in json: %s", encoded)
+	}
+}
+
+func TestDnsMessageEdnsDirectives(t *testing.T) {
+	dm := DnsMessage{}
+	dm.Init()
+	dm.EDNS.Options = []DnsOption{
+		{Code: 10, Name: "COOKIE", Data: "0102030405060708 -"},
+		{Code: 11, Name: "KEEPALIVE", Data: "12.5"},
+	}
+
+	line := dm.String([]string{"edns-keepalive", "edns-nsid", "edns-cookie"})
+	if line != "12.5 - 0102030405060708 -\n" {
+		t.Errorf("text dns message invalid; %s", line)
+	}
+}
+
+func TestDnsMessageHeaderDirectives(t *testing.T) {
+	dm := DnsMessage{}
+	dm.Init()
+	dm.DNS.Flags.RD = true
+	dm.DNS.Counts = DnsCounts{Qdcount: 1, Ancount: 2, Nscount: 0, Arcount: 1}
+
+	line := dm.String([]string{"rd", "cd", "qdcount", "ancount", "nscount", "arcount"})
+	if line != "RD - 1 2 0 1\n" {
+		t.Errorf("text dns message invalid; %s", line)
+	}
+}
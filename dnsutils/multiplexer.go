@@ -0,0 +1,117 @@
+package dnsutils
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+type MultiplexInOut struct {
+	Name          string                 `yaml:"name"`
+	Subprocessors map[string]interface{} `yaml:"subprocessors"`
+	Params        map[string]interface{} `yaml:",inline"`
+}
+
+// GetItemConfig returns the type of the collector or logger described by the item and a copy
+// of the configuration where the collectors and loggers sections are reset to default values
+// and updated with the options of the item. The other sections are shared.
+func GetItemConfig(section string, config *Config, item MultiplexInOut) (string, *Config, error) {
+	if len(item.Name) == 0 {
+		return "", nil, fmt.Errorf("%s - name is missing", section)
+	}
+	if len(item.Params) != 1 {
+		return "", nil, fmt.Errorf("%s %s - one and only one type expected", section, item.Name)
+	}
+
+	var kind string
+	for k := range item.Params {
+		kind = k
+	}
+
+	defaults := &Config{}
+	defaults.SetDefault()
+
+	subcfg := *config
+	subcfg.Collectors = defaults.Collectors
+	subcfg.Loggers = defaults.Loggers
+
+	// encode options of the item and decode-it in the right section
+	b, err := yaml.Marshal(map[string]interface{}{section: item.Params})
+	if err != nil {
+		return "", nil, err
+	}
+	if err := decodeStrict(b, &subcfg); err != nil {
+		return "", nil, fmt.Errorf("%s %s - %v", section, item.Name, err)
+	}
+
+	return kind, &subcfg, nil
+}
+
+// GetItemSubprocessors returns nil if the item has no dedicated subprocessors, otherwise a copy of the
+// configuration where the subprocessors section is reset to default values and updated with the options
+// of the item. The list of transforms is empty by default, the transforms already applied by the
+// collectors are not run again.
+func GetItemSubprocessors(config *Config, item MultiplexInOut) (*Config, error) {
+	if item.Subprocessors == nil {
+		return nil, nil
+	}
+
+	defaults := &Config{}
+	defaults.SetDefault()
+	defaults.Subprocessors.Transforms = []string{}
+
+	subcfg := *config
+	subcfg.Subprocessors = defaults.Subprocessors
+	subcfg.transforms = atomic.Value{}
+
+	b, err := yaml.Marshal(map[string]interface{}{"subprocessors": item.Subprocessors})
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeStrict(b, &subcfg); err != nil {
+		return nil, fmt.Errorf("%s - subprocessors: %v", item.Name, err)
+	}
+
+	return &subcfg, nil
+}
+
+// GetItemSignature returns a text representation of all the options used by a collector
+// or a logger of the given type, two workers with the same signature behave identically.
+// The transforms are excluded, they are reloaded in place without restarting the workers.
+func GetItemSignature(section string, kind string, config *Config) (string, error) {
+	b, err := yaml.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	var sections struct {
+		Collectors map[string]interface{} `yaml:"collectors"`
+		Loggers    map[string]interface{} `yaml:"loggers"`
+	}
+	if err := yaml.Unmarshal(b, &sections); err != nil {
+		return "", err
+	}
+
+	signature := map[string]interface{}{
+		"kind":          kind,
+		"server-id":     config.Subprocessors.ServerId,
+		"log-malformed": config.Trace.LogMalformed,
+	}
+	switch section {
+	case "collectors":
+		signature["options"] = sections.Collectors[kind]
+		signature["cache"] = config.Subprocessors.Cache
+	case "loggers":
+		signature["options"] = sections.Loggers[kind]
+		signature["text-format"] = config.Subprocessors.TextFormat
+		signature["statistics"] = config.Subprocessors.Statistics
+	default:
+		return "", fmt.Errorf("unknown section %s", section)
+	}
+
+	b, err = yaml.Marshal(signature)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
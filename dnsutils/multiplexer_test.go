@@ -0,0 +1,161 @@
+package dnsutils
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMultiplexerDecode(t *testing.T) {
+	text := `
+multiplexer:
+  loggers:
+    - name: siem-1
+      tcpclient:
+        remote-address: 10.0.0.1
+    - name: siem-2
+      tcpclient:
+        remote-address: 10.0.0.2
+`
+	config := GetFakeConfig()
+	if err := yaml.Unmarshal([]byte(text), config); err != nil {
+		t.Fatalf("unable to decode config: %s", err)
+	}
+
+	if len(config.Multiplexer.Loggers) != 2 {
+		t.Fatalf("want 2 loggers, got %d", len(config.Multiplexer.Loggers))
+	}
+	for i, want := range []string{"10.0.0.1", "10.0.0.2"} {
+		kind, subcfg, err := GetItemConfig("loggers", config, config.Multiplexer.Loggers[i])
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if kind != "tcpclient" {
+			t.Errorf("want tcpclient, got %s", kind)
+		}
+		if subcfg.Loggers.TcpClient.RemoteAddress != want {
+			t.Errorf("want %s, got %s", want, subcfg.Loggers.TcpClient.RemoteAddress)
+		}
+		// default values must be kept
+		if subcfg.Loggers.TcpClient.RemotePort != 9999 {
+			t.Errorf("want default port 9999, got %d", subcfg.Loggers.TcpClient.RemotePort)
+		}
+	}
+}
+
+func TestMultiplexerItemConfig(t *testing.T) {
+	config := GetFakeConfig()
+	item := MultiplexInOut{
+		Name: "tap-unix",
+		Params: map[string]interface{}{
+			"dnstap": map[string]interface{}{"sock-path": "/tmp/dnstap.sock"},
+		},
+	}
+
+	kind, subcfg, err := GetItemConfig("collectors", config, item)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if kind != "dnstap" {
+		t.Errorf("want dnstap, got %s", kind)
+	}
+	if subcfg.Collectors.Dnstap.SockPath != "/tmp/dnstap.sock" {
+		t.Errorf("invalid sock path: %s", subcfg.Collectors.Dnstap.SockPath)
+	}
+	if config.Collectors.Dnstap.SockPath != "" {
+		t.Errorf("global config should not be updated")
+	}
+}
+
+func TestMultiplexerItemInvalid(t *testing.T) {
+	config := GetFakeConfig()
+
+	item := MultiplexInOut{Name: "empty", Params: map[string]interface{}{}}
+	if _, _, err := GetItemConfig("loggers", config, item); err == nil {
+		t.Errorf("item without type should be rejected")
+	}
+
+	item = MultiplexInOut{Params: map[string]interface{}{"stdout": nil}}
+	if _, _, err := GetItemConfig("loggers", config, item); err == nil {
+		t.Errorf("item without name should be rejected")
+	}
+}
+
+func TestMultiplexerItemSubprocessors(t *testing.T) {
+	text := `
+multiplexer:
+  loggers:
+    - name: local
+      logfile:
+        file-path: /tmp/dnscollector.log
+    - name: loki
+      lokiclient:
+        server-url: http://127.0.0.1:3100/loki/api/v1/push
+      subprocessors:
+        user-privacy:
+          anonymize-ip: true
+        transforms: [ anonymize-ip ]
+`
+	config := GetFakeConfig()
+	if err := yaml.Unmarshal([]byte(text), config); err != nil {
+		t.Fatalf("unable to decode config: %s", err)
+	}
+
+	// no dedicated subprocessors
+	subcfg, err := GetItemSubprocessors(config, config.Multiplexer.Loggers[0])
+	if err != nil || subcfg != nil {
+		t.Errorf("no subprocessors expected for the first logger")
+	}
+
+	// the subprocessors key must not be considered as a logger type
+	kind, _, err := GetItemConfig("loggers", config, config.Multiplexer.Loggers[1])
+	if err != nil || kind != "lokiclient" {
+		t.Fatalf("want lokiclient, got %s (%v)", kind, err)
+	}
+
+	subcfg, err = GetItemSubprocessors(config, config.Multiplexer.Loggers[1])
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !subcfg.Subprocessors.UserPrivacy.AnonymizeIP {
+		t.Errorf("anonymize-ip should be enabled")
+	}
+	if len(subcfg.Subprocessors.Transforms) != 1 {
+		t.Errorf("invalid transforms: %v", subcfg.Subprocessors.Transforms)
+	}
+
+	// without transforms, none is applied
+	item := MultiplexInOut{Name: "raw", Subprocessors: map[string]interface{}{"qname-lowercase": true}}
+	subcfg, err = GetItemSubprocessors(config, item)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(subcfg.Subprocessors.Transforms) != 0 {
+		t.Errorf("no transforms expected: %v", subcfg.Subprocessors.Transforms)
+	}
+	if config.Subprocessors.UserPrivacy.AnonymizeIP {
+		t.Errorf("global config should not be updated")
+	}
+}
+
+func TestMultiplexerItemSignature(t *testing.T) {
+	config := GetFakeConfig()
+	before, err := GetItemSignature("loggers", "tcpclient", config)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// options of other loggers and transforms must be ignored
+	config.Loggers.Stdout.Mode = "json"
+	config.Subprocessors.Filtering.DropRcodes = []string{"NOERROR"}
+	after, _ := GetItemSignature("loggers", "tcpclient", config)
+	if before != after {
+		t.Errorf("signature must not change")
+	}
+
+	config.Loggers.TcpClient.RemotePort = 8888
+	after, _ = GetItemSignature("loggers", "tcpclient", config)
+	if before == after {
+		t.Errorf("signature must change")
+	}
+}
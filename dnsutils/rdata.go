@@ -0,0 +1,648 @@
+package dnsutils
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrDecodeDnsAnswerRdataInvalid = errors.New("malformed pkt, invalid rdata answer")
+
+var (
+	SvcParamKeys = map[int]string{
+		0: "mandatory",
+		1: "alpn",
+		2: "no-default-alpn",
+		3: "port",
+		4: "ipv4hint",
+		5: "ech",
+		6: "ipv6hint",
+	}
+)
+
+// the next hashed owner names of NSEC3 are encoded in base32 with the extended hex alphabet
+var base32HexNoPadding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// RdatatypeToPresentation returns the name of the type, TYPE<number> for the unknown types
+func RdatatypeToPresentation(rrtype int) string {
+	if value, ok := Rdatatypes[rrtype]; ok {
+		return value
+	}
+	return fmt.Sprintf("TYPE%d", rrtype)
+}
+
+func SvcParamKeyToString(key int) string {
+	if value, ok := SvcParamKeys[key]; ok {
+		return value
+	}
+	return fmt.Sprintf("key%d", key)
+}
+
+// ParseRdataName decodes the domain name in the rdata, the root is returned as "."
+// and the name must end before the end of the rdata
+func ParseRdataName(offset int, rdata_end int, payload []byte) (string, int, error) {
+	name, offset, err := ParseLabels(offset, payload)
+	if err != nil {
+		return "", 0, err
+	}
+	if offset > rdata_end {
+		return "", 0, ErrDecodeDnsAnswerRdataInvalid
+	}
+	if len(name) == 0 {
+		name = "."
+	}
+	return name, offset, nil
+}
+
+// ParseCharacterString decodes the character string at the offset of the rdata, the bytes
+// of the string are returned without the length
+func ParseCharacterString(offset int, rdata []byte) ([]byte, int, error) {
+	if offset >= len(rdata) {
+		return nil, 0, ErrDecodeDnsAnswerRdataInvalid
+	}
+	length := int(rdata[offset])
+	if offset+1+length > len(rdata) {
+		return nil, 0, ErrDecodeDnsAnswerRdataInvalid
+	}
+	return rdata[offset+1 : offset+1+length], offset + 1 + length, nil
+}
+
+// QuoteString returns the bytes in a quoted string, the quotes and the backslashes are escaped
+// and the non printable characters are written as \DDD
+func QuoteString(data []byte) string {
+	var s strings.Builder
+	s.WriteByte('"')
+	for _, b := range data {
+		switch {
+		case b == '"' || b == '\\':
+			s.WriteByte('\\')
+			s.WriteByte(b)
+		case b < ' ' || b > '~':
+			s.WriteString(fmt.Sprintf("\\%03d", b))
+		default:
+			s.WriteByte(b)
+		}
+	}
+	s.WriteByte('"')
+	return s.String()
+}
+
+// ParseTypeBitmap decodes the windows of the types bitmap of NSEC and NSEC3
+func ParseTypeBitmap(bitmap []byte) ([]string, error) {
+	types := []string{}
+	for len(bitmap) > 0 {
+		if len(bitmap) < 2 {
+			return nil, ErrDecodeDnsAnswerRdataInvalid
+		}
+		window, length := int(bitmap[0]), int(bitmap[1])
+		if length == 0 || length > 32 || len(bitmap) < 2+length {
+			return nil, ErrDecodeDnsAnswerRdataInvalid
+		}
+		for i, b := range bitmap[2 : 2+length] {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					types = append(types, RdatatypeToPresentation(window*256+i*8+bit))
+				}
+			}
+		}
+		bitmap = bitmap[2+length:]
+	}
+	return types, nil
+}
+
+/*
+DS, CDS
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                    KEY TAG                    |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|       ALGORITHM       |      DIGEST TYPE      |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                    DIGEST                     /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseDS(rdata []byte) (string, map[string]interface{}, error) {
+	if len(rdata) < 4 {
+		return "", nil, ErrDecodeDnsAnswerRdataInvalid
+	}
+	keytag := binary.BigEndian.Uint16(rdata[0:2])
+	digest := strings.ToUpper(hex.EncodeToString(rdata[4:]))
+	ds := fmt.Sprintf("%d %d %d %s", keytag, rdata[2], rdata[3], digest)
+	fields := map[string]interface{}{"key-tag": int(keytag), "algorithm": int(rdata[2]), "digest-type": int(rdata[3]), "digest": digest}
+	return ds, fields, nil
+}
+
+/*
+DNSKEY, CDNSKEY
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                     FLAGS                     |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|        PROTOCOL       |       ALGORITHM       |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                  PUBLIC KEY                   /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseDNSKEY(rdata []byte) (string, map[string]interface{}, error) {
+	if len(rdata) < 4 {
+		return "", nil, ErrDecodeDnsAnswerRdataInvalid
+	}
+	flags := binary.BigEndian.Uint16(rdata[0:2])
+	key := base64.StdEncoding.EncodeToString(rdata[4:])
+	dnskey := fmt.Sprintf("%d %d %d %s", flags, rdata[2], rdata[3], key)
+	fields := map[string]interface{}{"flags": int(flags), "protocol": int(rdata[2]), "algorithm": int(rdata[3]), "public-key": key}
+	return dnskey, fields, nil
+}
+
+/*
+RRSIG
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                 TYPE COVERED                  |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|       ALGORITHM       |        LABELS         |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                 ORIGINAL TTL                  |
+|                                               |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|             SIGNATURE EXPIRATION              |
+|                                               |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|              SIGNATURE INCEPTION              |
+|                                               |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                    KEY TAG                    |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                 SIGNER'S NAME                 /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                   SIGNATURE                   /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseRRSIG(rdata []byte, rdata_offset int, payload []byte) (string, map[string]interface{}, error) {
+	if len(rdata) < 18 {
+		return "", nil, ErrDecodeDnsAnswerRdataInvalid
+	}
+	rdata_end := rdata_offset + len(rdata)
+	signer, offset, err := ParseRdataName(rdata_offset+18, rdata_end, payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	covered := RdatatypeToPresentation(int(binary.BigEndian.Uint16(rdata[0:2])))
+	ttl := binary.BigEndian.Uint32(rdata[4:8])
+	expiration := time.Unix(int64(binary.BigEndian.Uint32(rdata[8:12])), 0).UTC().Format("20060102150405")
+	inception := time.Unix(int64(binary.BigEndian.Uint32(rdata[12:16])), 0).UTC().Format("20060102150405")
+	keytag := binary.BigEndian.Uint16(rdata[16:18])
+	signature := base64.StdEncoding.EncodeToString(payload[offset:rdata_end])
+
+	rrsig := fmt.Sprintf("%s %d %d %d %s %s %d %s %s", covered, rdata[2], rdata[3], ttl,
+		expiration, inception, keytag, signer, signature)
+	fields := map[string]interface{}{"type-covered": covered, "algorithm": int(rdata[2]), "labels": int(rdata[3]),
+		"original-ttl": int(ttl), "expiration": expiration, "inception": inception, "key-tag": int(keytag),
+		"signer": signer, "signature": signature}
+	return rrsig, fields, nil
+}
+
+/*
+NSEC
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/               NEXT DOMAIN NAME                /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                TYPE BIT MAPS                  /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseNSEC(rdata []byte, rdata_offset int, payload []byte) (string, map[string]interface{}, error) {
+	rdata_end := rdata_offset + len(rdata)
+	next, offset, err := ParseRdataName(rdata_offset, rdata_end, payload)
+	if err != nil {
+		return "", nil, err
+	}
+	types, err := ParseTypeBitmap(payload[offset:rdata_end])
+	if err != nil {
+		return "", nil, err
+	}
+	nsec := strings.Join(append([]string{next}, types...), " ")
+	return nsec, map[string]interface{}{"next": next, "types": types}, nil
+}
+
+/*
+NSEC3
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|    HASH ALGORITHM     |         FLAGS         |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                  ITERATIONS                   |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|      SALT LENGTH      |         SALT          /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|      HASH LENGTH      |  NEXT HASHED OWNER    /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                TYPE BIT MAPS                  /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseNSEC3(rdata []byte) (string, map[string]interface{}, error) {
+	params, fields, offset, err := ParseNSEC3Params(rdata)
+	if err != nil {
+		return "", nil, err
+	}
+	if offset >= len(rdata) || offset+1+int(rdata[offset]) > len(rdata) {
+		return "", nil, ErrDecodeDnsAnswerRdataInvalid
+	}
+	length := int(rdata[offset])
+	next := base32HexNoPadding.EncodeToString(rdata[offset+1 : offset+1+length])
+
+	types, err := ParseTypeBitmap(rdata[offset+1+length:])
+	if err != nil {
+		return "", nil, err
+	}
+	fields["next-hashed"] = next
+	fields["types"] = types
+	return strings.Join(append([]string{params, next}, types...), " "), fields, nil
+}
+
+/*
+NSEC3PARAM
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|    HASH ALGORITHM     |         FLAGS         |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                  ITERATIONS                   |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|      SALT LENGTH      |         SALT          /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseNSEC3PARAM(rdata []byte) (string, map[string]interface{}, error) {
+	params, fields, _, err := ParseNSEC3Params(rdata)
+	return params, fields, err
+}
+
+// ParseNSEC3Params decodes the parameters shared by NSEC3 and NSEC3PARAM, the empty salt is "-"
+func ParseNSEC3Params(rdata []byte) (string, map[string]interface{}, int, error) {
+	if len(rdata) < 5 || len(rdata) < 5+int(rdata[4]) {
+		return "", nil, 0, ErrDecodeDnsAnswerRdataInvalid
+	}
+	iterations := binary.BigEndian.Uint16(rdata[2:4])
+	salt := "-"
+	if rdata[4] > 0 {
+		salt = strings.ToUpper(hex.EncodeToString(rdata[5 : 5+int(rdata[4])]))
+	}
+	params := fmt.Sprintf("%d %d %d %s", rdata[0], rdata[1], iterations, salt)
+	fields := map[string]interface{}{"hash-algorithm": int(rdata[0]), "flags": int(rdata[1]), "iterations": int(iterations), "salt": salt}
+	return params, fields, 5 + int(rdata[4]), nil
+}
+
+/*
+SVCB, HTTPS
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                   PRIORITY                    |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                  TARGET NAME                  /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                   PARAM KEY                   |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                  PARAM LENGTH                 |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                  PARAM VALUE                  /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseSVCB(rdata []byte, rdata_offset int, payload []byte) (string, map[string]interface{}, error) {
+	if len(rdata) < 3 {
+		return "", nil, ErrDecodeDnsAnswerRdataInvalid
+	}
+	rdata_end := rdata_offset + len(rdata)
+	priority := binary.BigEndian.Uint16(rdata[0:2])
+	target, offset, err := ParseRdataName(rdata_offset+2, rdata_end, payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	svcb := []string{strconv.Itoa(int(priority)), target}
+	values := make(map[string]interface{})
+	params := payload[offset:rdata_end]
+	for len(params) > 0 {
+		if len(params) < 4 {
+			return "", nil, ErrDecodeDnsAnswerRdataInvalid
+		}
+		key := int(binary.BigEndian.Uint16(params[0:2]))
+		length := int(binary.BigEndian.Uint16(params[2:4]))
+		if len(params) < 4+length {
+			return "", nil, ErrDecodeDnsAnswerRdataInvalid
+		}
+		value, field, err := ParseSvcParam(key, params[4:4+length])
+		if err != nil {
+			return "", nil, err
+		}
+		if len(value) > 0 {
+			svcb = append(svcb, SvcParamKeyToString(key)+"="+value)
+		} else {
+			svcb = append(svcb, SvcParamKeyToString(key))
+		}
+		values[SvcParamKeyToString(key)] = field
+		params = params[4+length:]
+	}
+	fields := map[string]interface{}{"priority": int(priority), "target": target, "params": values}
+	return strings.Join(svcb, " "), fields, nil
+}
+
+// ParseSvcParam decodes the value of the service parameter, the unknown keys are quoted.
+// The field is a list for mandatory, alpn and the hints, a number for the port
+// and true for the keys without value
+func ParseSvcParam(key int, value []byte) (string, interface{}, error) {
+	values := []string{}
+	switch key {
+	case 0:
+		if len(value)%2 != 0 {
+			return "", nil, ErrDecodeDnsAnswerRdataInvalid
+		}
+		for i := 0; i < len(value); i += 2 {
+			values = append(values, SvcParamKeyToString(int(binary.BigEndian.Uint16(value[i:i+2]))))
+		}
+	case 1:
+		for len(value) > 0 {
+			if len(value) < 1+int(value[0]) {
+				return "", nil, ErrDecodeDnsAnswerRdataInvalid
+			}
+			values = append(values, string(value[1:1+int(value[0])]))
+			value = value[1+int(value[0]):]
+		}
+	case 2:
+		return "", true, nil
+	case 3:
+		if len(value) != 2 {
+			return "", nil, ErrDecodeDnsAnswerRdataInvalid
+		}
+		port := int(binary.BigEndian.Uint16(value))
+		return strconv.Itoa(port), port, nil
+	case 4, 6:
+		size := net.IPv4len
+		if key == 6 {
+			size = net.IPv6len
+		}
+		if len(value)%size != 0 {
+			return "", nil, ErrDecodeDnsAnswerRdataInvalid
+		}
+		for i := 0; i < len(value); i += size {
+			values = append(values, net.IP(value[i:i+size]).String())
+		}
+	case 5:
+		ech := base64.StdEncoding.EncodeToString(value)
+		return ech, ech, nil
+	default:
+		return QuoteString(value), string(value), nil
+	}
+	return strings.Join(values, ","), values, nil
+}
+
+/*
+CAA
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|         FLAGS         |      TAG LENGTH       |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                      TAG                      /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                     VALUE                     /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseCAA(rdata []byte) (string, map[string]interface{}, error) {
+	if len(rdata) < 2 || len(rdata) < 2+int(rdata[1]) {
+		return "", nil, ErrDecodeDnsAnswerRdataInvalid
+	}
+	tag := string(rdata[2 : 2+int(rdata[1])])
+	value := rdata[2+int(rdata[1]):]
+	caa := fmt.Sprintf("%d %s %s", rdata[0], tag, QuoteString(value))
+	return caa, map[string]interface{}{"flags": int(rdata[0]), "tag": tag, "value": string(value)}, nil
+}
+
+/*
+NAPTR
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                     ORDER                     |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                   PREFERENCE                  |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                     FLAGS                     /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                   SERVICES                    /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                    REGEXP                     /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                  REPLACEMENT                  /
+/                                               /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseNAPTR(rdata []byte, rdata_offset int, payload []byte) (string, map[string]interface{}, error) {
+	if len(rdata) < 4 {
+		return "", nil, ErrDecodeDnsAnswerRdataInvalid
+	}
+	order := binary.BigEndian.Uint16(rdata[0:2])
+	pref := binary.BigEndian.Uint16(rdata[2:4])
+	fields := map[string]interface{}{"order": int(order), "preference": int(pref)}
+
+	// flags, services and regexp
+	strs := []string{}
+	offset := 4
+	for _, name := range []string{"flags", "services", "regexp"} {
+		str, next, err := ParseCharacterString(offset, rdata)
+		if err != nil {
+			return "", nil, err
+		}
+		strs = append(strs, QuoteString(str))
+		fields[name] = string(str)
+		offset = next
+	}
+
+	replacement, _, err := ParseRdataName(rdata_offset+offset, rdata_offset+len(rdata), payload)
+	if err != nil {
+		return "", nil, err
+	}
+	fields["replacement"] = replacement
+	naptr := fmt.Sprintf("%d %d %s %s", order, pref, strings.Join(strs, " "), replacement)
+	return naptr, fields, nil
+}
+
+/*
+SSHFP
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|       ALGORITHM       |        FP TYPE        |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                  FINGERPRINT                  /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseSSHFP(rdata []byte) (string, map[string]interface{}, error) {
+	if len(rdata) < 2 {
+		return "", nil, ErrDecodeDnsAnswerRdataInvalid
+	}
+	fingerprint := strings.ToUpper(hex.EncodeToString(rdata[2:]))
+	sshfp := fmt.Sprintf("%d %d %s", rdata[0], rdata[1], fingerprint)
+	return sshfp, map[string]interface{}{"algorithm": int(rdata[0]), "fingerprint-type": int(rdata[1]), "fingerprint": fingerprint}, nil
+}
+
+/*
+TLSA
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|      CERT USAGE       |       SELECTOR        |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|     MATCHING TYPE     |                       /
++--+--+--+--+--+--+--+--+                       /
+/       CERTIFICATE ASSOCIATION DATA            /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseTLSA(rdata []byte) (string, map[string]interface{}, error) {
+	if len(rdata) < 3 {
+		return "", nil, ErrDecodeDnsAnswerRdataInvalid
+	}
+	data := strings.ToUpper(hex.EncodeToString(rdata[3:]))
+	tlsa := fmt.Sprintf("%d %d %d %s", rdata[0], rdata[1], rdata[2], data)
+	fields := map[string]interface{}{"usage": int(rdata[0]), "selector": int(rdata[1]), "matching-type": int(rdata[2]), "data": data}
+	return tlsa, fields, nil
+}
+
+/*
+DNAME
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                    TARGET                     /
+/                                               /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseDNAME(rdata_offset int, payload []byte) (string, map[string]interface{}, error) {
+	dname, _, err := ParseLabels(rdata_offset, payload)
+	if err != nil {
+		return "", nil, err
+	}
+	return dname, map[string]interface{}{"target": dname}, nil
+}
+
+/*
+HINFO
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                      CPU                      /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                       OS                      /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseHINFO(rdata []byte) (string, map[string]interface{}, error) {
+	cpu, offset, err := ParseCharacterString(0, rdata)
+	if err != nil {
+		return "", nil, err
+	}
+	os, _, err := ParseCharacterString(offset, rdata)
+	if err != nil {
+		return "", nil, err
+	}
+	return QuoteString(cpu) + " " + QuoteString(os), map[string]interface{}{"cpu": string(cpu), "os": string(os)}, nil
+}
+
+/*
+LOC
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|        VERSION        |         SIZE          |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|       HORIZ PRE       |       VERT PRE        |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                   LATITUDE                    |
+|                                               |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                   LONGITUDE                   |
+|                                               |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                   ALTITUDE                    |
+|                                               |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseLOC(rdata []byte) (string, map[string]interface{}, error) {
+	if len(rdata) != 16 || rdata[0] != 0 {
+		return "", nil, ErrDecodeDnsAnswerRdataInvalid
+	}
+	latitude, latitudeDeg := ParseLocCoordinate(binary.BigEndian.Uint32(rdata[4:8]), "N", "S")
+	longitude, longitudeDeg := ParseLocCoordinate(binary.BigEndian.Uint32(rdata[8:12]), "E", "W")
+	// the altitude is in centimeters from a base of 100000m below the reference spheroid
+	altitude := float64(int64(binary.BigEndian.Uint32(rdata[12:16]))-10000000) / 100
+	size, horizontal, vertical := ParseLocPrecision(rdata[1]), ParseLocPrecision(rdata[2]), ParseLocPrecision(rdata[3])
+
+	loc := fmt.Sprintf("%s %s %.2fm %sm %sm %sm", latitude, longitude, altitude,
+		strconv.FormatFloat(size, 'f', -1, 64), strconv.FormatFloat(horizontal, 'f', -1, 64),
+		strconv.FormatFloat(vertical, 'f', -1, 64))
+	fields := map[string]interface{}{"latitude": latitudeDeg, "longitude": longitudeDeg, "altitude": altitude,
+		"size": size, "horizontal-precision": horizontal, "vertical-precision": vertical}
+	return loc, fields, nil
+}
+
+// ParseLocCoordinate returns the degrees, minutes and seconds of the coordinate in thousandths
+// of a second of arc, the equator or the prime meridian is 2^31. The coordinate is also returned
+// in decimal degrees, negative in the south or in the west.
+func ParseLocCoordinate(value uint32, positive string, negative string) (string, float64) {
+	hemisphere := positive
+	arc := int64(value) - (1 << 31)
+	decimal := float64(arc) / 3600000
+	if arc < 0 {
+		hemisphere = negative
+		arc = -arc
+	}
+	degrees := arc / 3600000
+	minutes := (arc % 3600000) / 60000
+	seconds := float64(arc%60000) / 1000
+	return fmt.Sprintf("%d %d %.3f %s", degrees, minutes, seconds, hemisphere), decimal
+}
+
+// ParseLocPrecision returns in meters the size or the precision encoded in centimeters
+// as a base and a power of ten
+func ParseLocPrecision(value byte) float64 {
+	base, exponent := int64(value>>4), int(value&0x0f)
+	cm := base
+	for i := 0; i < exponent; i++ {
+		cm *= 10
+	}
+	return float64(cm) / 100
+}
+
+/*
+URI
+								1  1  1  1  1  1
+  0  1  2  3  4  5  6  7  8  9  0  1  2  3  4  5
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                   PRIORITY                    |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+|                    WEIGHT                     |
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+/                    TARGET                     /
++--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+*/
+func ParseURI(rdata []byte) (string, map[string]interface{}, error) {
+	if len(rdata) < 4 {
+		return "", nil, ErrDecodeDnsAnswerRdataInvalid
+	}
+	priority := binary.BigEndian.Uint16(rdata[0:2])
+	weight := binary.BigEndian.Uint16(rdata[2:4])
+	uri := fmt.Sprintf("%d %d %s", priority, weight, QuoteString(rdata[4:]))
+	return uri, map[string]interface{}{"priority": int(priority), "weight": int(weight), "target": string(rdata[4:])}, nil
+}
@@ -0,0 +1,26 @@
+package dnsutils
+
+// WithRdataFields returns a copy of the message with the structured fields of the rdata
+// in the resource records, the message is shared between the loggers and not modified.
+// The fields are decoded from the wire data with the rdata, the records of the collectors
+// without dns payload have no fields.
+func (dm DnsMessage) WithRdataFields() DnsMessage {
+	dm.DNS.DnsRRs = DnsRRs{
+		Answers:     rdataFieldsOf(dm.DNS.DnsRRs.Answers),
+		Nameservers: rdataFieldsOf(dm.DNS.DnsRRs.Nameservers),
+		Records:     rdataFieldsOf(dm.DNS.DnsRRs.Records),
+	}
+	return dm
+}
+
+func rdataFieldsOf(rrs []DnsAnswer) []DnsAnswer {
+	if rrs == nil {
+		return nil
+	}
+	copied := make([]DnsAnswer, len(rrs))
+	for i, rr := range rrs {
+		rr.RdataFields = rr.fields
+		copied[i] = rr
+	}
+	return copied
+}
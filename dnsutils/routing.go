@@ -0,0 +1,53 @@
+package dnsutils
+
+import (
+	"fmt"
+)
+
+type Route struct {
+	From []string `yaml:"from,flow"`
+	To   []string `yaml:"to,flow"`
+}
+
+func contains(list []string, name string) bool {
+	for _, v := range list {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRoutes resolves the routing table and returns for each collector the name of the loggers
+// to use. Without any route, all loggers are attached to all collectors.
+func GetRoutes(routes []Route, collectors []string, loggers []string) (map[string][]string, error) {
+	table := make(map[string][]string)
+
+	// no routes, keep the default behaviour
+	if len(routes) == 0 {
+		for _, src := range collectors {
+			table[src] = loggers
+		}
+		return table, nil
+	}
+
+	for i, r := range routes {
+		if len(r.From) == 0 || len(r.To) == 0 {
+			return nil, fmt.Errorf("route #%d - from and to must be defined", i+1)
+		}
+		for _, src := range r.From {
+			if !contains(collectors, src) {
+				return nil, fmt.Errorf("route #%d - unknown or disabled collector: %s", i+1, src)
+			}
+			for _, dst := range r.To {
+				if !contains(loggers, dst) {
+					return nil, fmt.Errorf("route #%d - unknown or disabled logger: %s", i+1, dst)
+				}
+				if !contains(table[src], dst) {
+					table[src] = append(table[src], dst)
+				}
+			}
+		}
+	}
+	return table, nil
+}
@@ -0,0 +1,60 @@
+package dnsutils
+
+import (
+	"testing"
+)
+
+func TestRoutingDefault(t *testing.T) {
+	table, err := GetRoutes([]Route{}, []string{"dnstap", "dns-sniffer"}, []string{"stdout", "logfile"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for _, src := range []string{"dnstap", "dns-sniffer"} {
+		if len(table[src]) != 2 {
+			t.Errorf("collector %s should be attached to all loggers, got %v", src, table[src])
+		}
+	}
+}
+
+func TestRoutingNamed(t *testing.T) {
+	routes := []Route{
+		{From: []string{"dnstap"}, To: []string{"logfile", "lokiclient"}},
+		{From: []string{"dns-sniffer"}, To: []string{"prometheus"}},
+		{From: []string{"dnstap"}, To: []string{"logfile"}},
+	}
+	collectors := []string{"dnstap", "dns-sniffer"}
+	loggers := []string{"logfile", "lokiclient", "prometheus"}
+
+	table, err := GetRoutes(routes, collectors, loggers)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(table["dnstap"]) != 2 || table["dnstap"][0] != "logfile" || table["dnstap"][1] != "lokiclient" {
+		t.Errorf("invalid loggers for dnstap: %v", table["dnstap"])
+	}
+	if len(table["dns-sniffer"]) != 1 || table["dns-sniffer"][0] != "prometheus" {
+		t.Errorf("invalid loggers for dns-sniffer: %v", table["dns-sniffer"])
+	}
+}
+
+func TestRoutingUnknownName(t *testing.T) {
+	collectors := []string{"dnstap"}
+	loggers := []string{"stdout"}
+
+	routes := []Route{{From: []string{"tail"}, To: []string{"stdout"}}}
+	if _, err := GetRoutes(routes, collectors, loggers); err == nil {
+		t.Errorf("unknown collector should be rejected")
+	}
+
+	routes = []Route{{From: []string{"dnstap"}, To: []string{"syslog"}}}
+	if _, err := GetRoutes(routes, collectors, loggers); err == nil {
+		t.Errorf("unknown logger should be rejected")
+	}
+
+	routes = []Route{{From: []string{"dnstap"}}}
+	if _, err := GetRoutes(routes, collectors, loggers); err == nil {
+		t.Errorf("route without destination should be rejected")
+	}
+}
@@ -0,0 +1,256 @@
+package dnsutils
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dmachard/go-logger"
+)
+
+// Supervisor runs a collector or a logger and isolates its panics, the failed worker is replaced
+// by a new one created with the factory after an exponential backoff. The state of the worker is
+// published in the health states.
+type Supervisor struct {
+	sync.Mutex
+	done        chan bool
+	exit        chan bool
+	worker      Worker
+	factory     func() (Worker, error)
+	name        string
+	state       string
+	stopped     bool
+	restarts    int
+	backoffMin  time.Duration
+	backoffMax  time.Duration
+	maxRestarts int
+	health      *HealthStates
+	config      *Config
+	logger      *logger.Logger
+}
+
+func NewSupervisor(name string, worker Worker, factory func() (Worker, error),
+	config *Config, console *logger.Logger) *Supervisor {
+	o := &Supervisor{
+		done:    make(chan bool),
+		exit:    make(chan bool),
+		worker:  worker,
+		factory: factory,
+		name:    name,
+		health:  Health,
+		config:  config,
+		logger:  console,
+	}
+	o.ReadConfig()
+	o.setState(WorkerRunning, nil)
+	return o
+}
+
+func (o *Supervisor) ReadConfig() {
+	o.backoffMin = time.Duration(o.config.Supervisor.BackoffMin) * time.Second
+	o.backoffMax = time.Duration(o.config.Supervisor.BackoffMax) * time.Second
+	if o.backoffMax < o.backoffMin {
+		o.backoffMax = o.backoffMin
+	}
+	o.maxRestarts = o.config.Supervisor.MaxRestarts
+}
+
+func (o *Supervisor) LogInfo(msg string, v ...interface{}) {
+	o.logger.Info("supervisor "+o.name+" - "+msg, v...)
+}
+
+func (o *Supervisor) LogError(msg string, v ...interface{}) {
+	o.logger.Error("supervisor "+o.name+" - "+msg, v...)
+}
+
+// Channel returns the channel of the current worker
+func (o *Supervisor) Channel() chan DnsMessage {
+	o.Lock()
+	defer o.Unlock()
+	return o.worker.Channel()
+}
+
+// State returns the state of the worker: running, restarting or failed
+func (o *Supervisor) State() string {
+	o.Lock()
+	defer o.Unlock()
+	return o.state
+}
+
+// IsReady returns true if the worker is running and ready
+func (o *Supervisor) IsReady() bool {
+	o.Lock()
+	defer o.Unlock()
+	return o.state == WorkerRunning && IsWorkerReady(o.worker)
+}
+
+func (o *Supervisor) setState(state string, err error) {
+	o.state = state
+	health := WorkerHealth{State: state, Restarts: o.restarts}
+	if err != nil {
+		health.LastError = err.Error()
+	} else if last, ok := o.health.Get(o.name); ok {
+		health.LastError = last.LastError
+	}
+	o.health.Set(o.name, health)
+}
+
+func (o *Supervisor) Stop() {
+	o.LogInfo("stopping...")
+
+	// the worker is stopped only if it is running, otherwise the backoff is interrupted
+	o.Lock()
+	o.stopped = true
+	worker := o.worker
+	running := o.state == WorkerRunning
+	o.Unlock()
+	if running {
+		worker.Stop()
+	}
+	close(o.exit)
+
+	// read done channel and block until run is terminated
+	<-o.done
+	close(o.done)
+}
+
+// runWorker runs the worker until it is stopped, a panic is returned as an error
+func (o *Supervisor) runWorker(worker Worker) error {
+	return RecoverError(func() error {
+		worker.Run()
+		return nil
+	})
+}
+
+// newWorker creates a new worker with the factory, a panic is returned as an error
+func (o *Supervisor) newWorker() (worker Worker, err error) {
+	err = RecoverError(func() error {
+		worker, err = o.factory()
+		return err
+	})
+	return worker, err
+}
+
+// backoff returns the delay before the next restart, doubled on each consecutive failure
+func (o *Supervisor) backoff(failures int) time.Duration {
+	delay := o.backoffMin
+	for i := 1; i < failures && delay < o.backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > o.backoffMax {
+		delay = o.backoffMax
+	}
+	return delay
+}
+
+func (o *Supervisor) Run() {
+	o.LogInfo("running in background...")
+
+	failures := 0
+	worker := o.worker
+	for worker != nil {
+		started := time.Now()
+		err := o.runWorker(worker)
+		if err == nil {
+			// the worker is stopped
+			break
+		}
+		o.LogError("worker failure: %v", err)
+
+		// the sockets and the files of the failed worker are released before to create the new one
+		if err := ReleaseWorker(worker); err != nil {
+			o.LogError("release failure: %v", err)
+		}
+
+		// the worker was running for a long time, this is a new series of failures
+		if time.Since(started) > o.backoffMax {
+			failures = 0
+		}
+		worker = o.restart(&failures, err)
+	}
+
+	o.LogInfo("run terminated")
+	o.done <- true
+}
+
+// restart waits for the backoff delay and replaces the failed worker by a new one, nil is returned
+// if the supervisor is stopped or if the worker failed too many times
+func (o *Supervisor) restart(failures *int, err error) Worker {
+	for {
+		*failures++
+
+		o.Lock()
+		if o.stopped {
+			o.Unlock()
+			return nil
+		}
+		if o.maxRestarts > 0 && *failures > o.maxRestarts {
+			o.setState(WorkerFailed, err)
+			o.Unlock()
+			o.LogError("too many failures, worker not restarted")
+			<-o.exit
+			return nil
+		}
+		o.setState(WorkerRestarting, err)
+		o.Unlock()
+
+		delay := o.backoff(*failures)
+		o.LogInfo("restarting worker in %v", delay)
+		select {
+		case <-time.After(delay):
+		case <-o.exit:
+			return nil
+		}
+
+		var worker Worker
+		worker, err = o.newWorker()
+		if err == nil && worker == nil {
+			err = errors.New("no worker created")
+		}
+		if err != nil {
+			o.LogError("unable to create the worker: %v", err)
+			continue
+		}
+
+		// replace the worker, the dns messages not yet read by the failed worker are moved to the new one
+		o.Lock()
+		if o.stopped {
+			o.Unlock()
+			return nil
+		}
+		old := o.worker.Channel()
+		o.worker = worker
+		o.restarts++
+		o.setState(WorkerRunning, nil)
+		o.Unlock()
+
+		if lost := o.transfer(old, worker.Channel()); lost > 0 {
+			Lost.Add(o.name, uint64(lost))
+			o.LogError("%d messages lost", lost)
+		}
+		o.LogInfo("worker restarted")
+		return worker
+	}
+}
+
+func (o *Supervisor) transfer(from chan DnsMessage, to chan DnsMessage) int {
+	if from == nil || to == nil {
+		return 0
+	}
+	lost := 0
+	for {
+		select {
+		case dm, opened := <-from:
+			if !opened {
+				return lost
+			}
+			select {
+			case to <- dm:
+			default:
+				lost++
+			}
+		default:
+			return lost
+		}
+	}
+}
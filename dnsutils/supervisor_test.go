@@ -0,0 +1,177 @@
+package dnsutils
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-logger"
+)
+
+// panicLogger panics on the first message received
+type panicLogger struct {
+	channel chan DnsMessage
+	done    chan bool
+}
+
+func newPanicLogger() *panicLogger {
+	return &panicLogger{channel: make(chan DnsMessage, 8), done: make(chan bool)}
+}
+
+func (o *panicLogger) Stop() {
+	close(o.channel)
+	<-o.done
+}
+
+func (o *panicLogger) Run() {
+	for dm := range o.channel {
+		if dm.DNS.Qname == "panic" {
+			panic("unexpected message")
+		}
+	}
+	o.done <- true
+}
+
+func (o *panicLogger) Channel() chan DnsMessage { return o.channel }
+
+func waitState(t *testing.T, name string, state string) WorkerHealth {
+	for i := 0; i < 300; i++ {
+		if health, _ := Health.Get(name); health.State == state {
+			return health
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	health, _ := Health.Get(name)
+	t.Fatalf("want state %s, got %s", state, health.State)
+	return health
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	config := GetFakeConfig()
+
+	created := 0
+	factory := func() (Worker, error) {
+		created++
+		return newPanicLogger(), nil
+	}
+	w, _ := factory()
+	o := NewSupervisor("supervisor-restart", w, factory, config, logger.New(false))
+	go o.Run()
+
+	// the logger panics, it is replaced after the backoff
+	dm := GetFakeDnsMessage()
+	dm.DNS.Qname = "panic"
+	o.Channel() <- dm
+	waitState(t, "supervisor-restart", WorkerRestarting)
+	health := waitState(t, "supervisor-restart", WorkerRunning)
+
+	if created != 2 {
+		t.Errorf("want 2 workers created, got %d", created)
+	}
+	if health.Restarts != 1 || health.LastError != "unexpected message" {
+		t.Errorf("invalid health: %+v", health)
+	}
+	o.Stop()
+}
+
+func TestSupervisorFailed(t *testing.T) {
+	config := GetFakeConfig()
+	config.Supervisor.MaxRestarts = 1
+
+	factory := func() (Worker, error) {
+		w := newPanicLogger()
+		dm := GetFakeDnsMessage()
+		dm.DNS.Qname = "panic"
+		w.Channel() <- dm
+		return w, nil
+	}
+	w, _ := factory()
+	o := NewSupervisor("supervisor-failed", w, factory, config, logger.New(false))
+	go o.Run()
+
+	// the new logger fails again, the supervisor gives up
+	waitState(t, "supervisor-failed", WorkerFailed)
+	o.Stop()
+}
+
+// listeningWorker listens on the address, the first one panics without closing its listener
+type listeningWorker struct {
+	address string
+	fail    bool
+	listen  net.Listener
+	done    chan bool
+	sync.Mutex
+}
+
+func (w *listeningWorker) Stop() {
+	w.Release()
+	<-w.done
+}
+
+func (w *listeningWorker) Release() {
+	w.Lock()
+	defer w.Unlock()
+	if w.listen != nil {
+		w.listen.Close()
+	}
+}
+
+func (w *listeningWorker) Run() {
+	l, err := net.Listen("tcp", w.address)
+	if err != nil {
+		panic(err)
+	}
+	w.Lock()
+	w.listen = l
+	w.Unlock()
+	if w.fail {
+		panic("unexpected error")
+	}
+	for {
+		if _, err := l.Accept(); err != nil {
+			break
+		}
+	}
+	w.done <- true
+}
+
+func (w *listeningWorker) Channel() chan DnsMessage { return nil }
+
+func TestSupervisorRelease(t *testing.T) {
+	config := GetFakeConfig()
+	config.Supervisor.MaxRestarts = 1
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	factory := func() (Worker, error) {
+		return &listeningWorker{address: address, done: make(chan bool)}, nil
+	}
+	w := &listeningWorker{address: address, fail: true, done: make(chan bool)}
+	o := NewSupervisor("supervisor-release", w, factory, config, logger.New(false))
+	go o.Run()
+
+	// the listener of the failed worker is closed, the new one listens on the same port
+	waitState(t, "supervisor-release", WorkerRestarting)
+	health := waitState(t, "supervisor-release", WorkerRunning)
+	if health.Restarts != 1 {
+		t.Errorf("invalid health: %+v", health)
+	}
+	for i := 0; i < 50; i++ {
+		var conn net.Conn
+		if conn, err = net.Dial("tcp", address); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err != nil {
+		t.Errorf("new worker not listening: %s", err)
+	}
+	o.Stop()
+}
@@ -0,0 +1,150 @@
+package dnsutils
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// TelemetryMetric describes an internal metric of the collector, the value is identified by its labels
+type TelemetryMetric struct {
+	Name   string
+	Help   string
+	Labels []string
+	Gauge  bool
+}
+
+var (
+	MetricFramesReceived = &TelemetryMetric{
+		Name:   "dnstap_frames_received_total",
+		Help:   "The total number of dnstap frames received per connection",
+		Labels: []string{"collector", "connection"},
+	}
+	MetricDecodeErrors = &TelemetryMetric{
+		Name:   "decode_errors_total",
+		Help:   "The total number of frames or packets not decoded",
+		Labels: []string{"collector"},
+	}
+	MetricMalformedPackets = &TelemetryMetric{
+		Name:   "malformed_packets_total",
+		Help:   "The total number of malformed dns packets",
+		Labels: []string{"collector"},
+	}
+	MetricChannelLength = &TelemetryMetric{
+		Name:   "channel_length",
+		Help:   "The number of messages waiting in the channel of the worker",
+		Labels: []string{"worker"},
+		Gauge:  true,
+	}
+	MetricSendErrors = &TelemetryMetric{
+		Name:   "send_errors_total",
+		Help:   "The total number of errors when sending messages to the remote destination",
+		Labels: []string{"logger"},
+	}
+	MetricReconnects = &TelemetryMetric{
+		Name:   "reconnects_total",
+		Help:   "The total number of reconnection attempts to the remote destination",
+		Labels: []string{"logger"},
+	}
+
+	// TelemetryMetrics is the list of metrics exported
+	TelemetryMetrics = []*TelemetryMetric{
+		MetricFramesReceived,
+		MetricDecodeErrors,
+		MetricMalformedPackets,
+		MetricChannelLength,
+		MetricSendErrors,
+		MetricReconnects,
+	}
+)
+
+// TelemetryValue is a counter or a gauge, thread safe and updated without lock
+type TelemetryValue struct {
+	value  int64
+	labels []string
+}
+
+func (v *TelemetryValue) Inc() {
+	atomic.AddInt64(&v.value, 1)
+}
+
+func (v *TelemetryValue) Add(n int64) {
+	atomic.AddInt64(&v.value, n)
+}
+
+func (v *TelemetryValue) Set(n int64) {
+	atomic.StoreInt64(&v.value, n)
+}
+
+func (v *TelemetryValue) Get() int64 {
+	return atomic.LoadInt64(&v.value)
+}
+
+// Labels returns the values of the labels
+func (v *TelemetryValue) Labels() []string {
+	return v.labels
+}
+
+// TelemetryRegistry keeps the values of all the internal metrics
+type TelemetryRegistry struct {
+	sync.RWMutex
+	values map[*TelemetryMetric]map[string]*TelemetryValue
+}
+
+func NewTelemetryRegistry() *TelemetryRegistry {
+	return &TelemetryRegistry{values: make(map[*TelemetryMetric]map[string]*TelemetryValue)}
+}
+
+// Get returns the value of the metric for the given labels, created on the first call.
+// The workers keep the value and update it directly.
+func (r *TelemetryRegistry) Get(metric *TelemetryMetric, labels ...string) *TelemetryValue {
+	key := strings.Join(labels, "\x00")
+
+	r.RLock()
+	v, ok := r.values[metric][key]
+	r.RUnlock()
+	if ok {
+		return v
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.values[metric]; !ok {
+		r.values[metric] = make(map[string]*TelemetryValue)
+	}
+	if v, ok := r.values[metric][key]; ok {
+		return v
+	}
+	v = &TelemetryValue{labels: labels}
+	r.values[metric][key] = v
+	return v
+}
+
+// Remove forgets the value, used when a connection is closed
+func (r *TelemetryRegistry) Remove(metric *TelemetryMetric, labels ...string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.values[metric], strings.Join(labels, "\x00"))
+}
+
+// Values returns all the values of the metric sorted by labels
+func (r *TelemetryRegistry) Values(metric *TelemetryMetric) []*TelemetryValue {
+	r.RLock()
+	defer r.RUnlock()
+
+	keys := []string{}
+	for k := range r.values[metric] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	ret := []*TelemetryValue{}
+	for _, k := range keys {
+		ret = append(ret, r.values[metric][k])
+	}
+	return ret
+}
+
+// Telemetry is updated by the collectors, subprocessors and loggers and read by the metrics loggers
+var Telemetry = NewTelemetryRegistry()
@@ -0,0 +1,37 @@
+package dnsutils
+
+import "testing"
+
+func TestTelemetryRegistry(t *testing.T) {
+	r := NewTelemetryRegistry()
+
+	// the same value is returned for the same labels
+	r.Get(MetricFramesReceived, "dnstap", "10.0.0.1:40000").Inc()
+	r.Get(MetricFramesReceived, "dnstap", "10.0.0.1:40000").Add(2)
+	r.Get(MetricFramesReceived, "dnstap", "10.0.0.2:40000").Inc()
+
+	values := r.Values(MetricFramesReceived)
+	if len(values) != 2 {
+		t.Fatalf("want 2 values, got %d", len(values))
+	}
+	if values[0].Get() != 3 || values[0].Labels()[1] != "10.0.0.1:40000" {
+		t.Errorf("invalid value: %d %v", values[0].Get(), values[0].Labels())
+	}
+
+	// the value of a closed connection is removed
+	r.Remove(MetricFramesReceived, "dnstap", "10.0.0.2:40000")
+	if values := r.Values(MetricFramesReceived); len(values) != 1 {
+		t.Errorf("want 1 value, got %d", len(values))
+	}
+
+	// gauges are set
+	r.Get(MetricChannelLength, "loggers/stdout").Set(42)
+	if v := r.Get(MetricChannelLength, "loggers/stdout").Get(); v != 42 {
+		t.Errorf("want 42, got %d", v)
+	}
+
+	// other metrics are not affected
+	if len(r.Values(MetricSendErrors)) != 0 {
+		t.Errorf("no send errors expected")
+	}
+}
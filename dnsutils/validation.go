@@ -0,0 +1,356 @@
+package dnsutils
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var textDirectives = []string{"ttl", "answer", "edns-csubnet", "edns-errors", "edns-nsid", "edns-cookie",
+	"edns-expire", "edns-keepalive", "edns-padding", "edns-chain", "edns-keytag", "edns-zoneversion",
+	"answercount", "id", "timestamp", "timestamp-rfc3339ns", "timestamp-unixms", "timestamp-unixus",
+	"timestamp-unixns", "localtime", "identity", "operation", "rcode", "queryip", "queryport", "responseip",
+	"responseport", "family", "protocol", "length", "qname", "qtype", "latency", "continent", "country", "city",
+	"as-number", "as-owner", "malformed", "qr", "opcode", "tc", "aa", "ra", "ad", "rd", "cd", "qdcount",
+	"ancount", "nscount", "arcount"}
+
+var transformNames = []string{"qname-lowercase", "minimaze-qname", "filtering", "geoip", "anonymize-ip", "quiet-text"}
+
+var syslogPriorities = []string{"WARNING", "NOTICE", "INFO", "DEBUG", "DAEMON",
+	"LOCAL0", "LOCAL1", "LOCAL2", "LOCAL3", "LOCAL4", "LOCAL5", "LOCAL6", "LOCAL7"}
+
+// CheckTextFormat returns an error if the text format contains an unknown directive
+func CheckTextFormat(format string) error {
+	unknown := []string{}
+	for _, word := range strings.Fields(format) {
+		if !contains(textDirectives, word) {
+			unknown = append(unknown, word)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unsupported directive for text format: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// checker collects all the errors found in the configuration
+type checker struct {
+	prefix string
+	errors []error
+}
+
+func (c *checker) add(msg string, v ...interface{}) {
+	c.errors = append(c.errors, fmt.Errorf(c.prefix+msg, v...))
+}
+
+func (c *checker) oneOf(key string, value string, values []string) {
+	if !contains(values, value) {
+		c.add("%s: invalid value %q, expected one of %s", key, value, strings.Join(values, ", "))
+	}
+}
+
+func (c *checker) port(key string, port int) {
+	if port < 1 || port > 65535 {
+		c.add("%s: invalid port %d", key, port)
+	}
+}
+
+func (c *checker) positive(key string, value int) {
+	if value <= 0 {
+		c.add("%s: must be greater than zero, got %d", key, value)
+	}
+}
+
+func (c *checker) file(key string, path string) {
+	if len(path) == 0 {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		c.add("%s: %v", key, err)
+	}
+}
+
+func (c *checker) textFormat(key string, format string) {
+	if err := CheckTextFormat(format); err != nil {
+		c.add("%s: %v", key, err)
+	}
+}
+
+func (c *checker) mode(key string, mode string) {
+	if !IsValidMode(mode) {
+		c.add("%s: invalid mode %q, text or json expected", key, mode)
+	}
+}
+
+func (c *checker) tls(section string, enabled bool, certFile string, keyFile string) {
+	if !enabled {
+		return
+	}
+	if len(certFile) == 0 || len(keyFile) == 0 {
+		c.add("%s: cert-file and key-file are required with tls-support", section)
+		return
+	}
+	c.file(section+".cert-file", certFile)
+	c.file(section+".key-file", keyFile)
+}
+
+func (c *checker) spool(section string, spool SpoolConfig) {
+	if !spool.Enable {
+		return
+	}
+	if len(spool.Path) == 0 {
+		c.add("%s.spool.path: is required", section)
+	}
+	c.positive(section+".spool.max-size", spool.MaxSize)
+	if spool.MaxAge < 0 {
+		c.add("%s.spool.max-age: must be positive, got %d", section, spool.MaxAge)
+	}
+}
+
+func (c *checker) checkSubprocessors(config *Config) {
+	s := config.Subprocessors
+	c.textFormat("subprocessors.text-format", s.TextFormat)
+	for _, name := range s.Transforms {
+		c.oneOf("subprocessors.transforms", name, transformNames)
+	}
+	c.positive("subprocessors.statistics.top-max-items", s.Statistics.TopMaxItems)
+	c.positive("subprocessors.cache.query-timeout", s.Cache.QueryTimeout)
+
+	c.file("subprocessors.filtering.drop-fqdn-file", s.Filtering.DropFqdnFile)
+	c.file("subprocessors.filtering.drop-queryip-file", s.Filtering.DropQueryIpFile)
+	c.file("subprocessors.filtering.drop-domain-file", s.Filtering.DropDomainFile)
+	if len(s.Filtering.DropDomainFile) > 0 {
+		if b, err := os.ReadFile(s.Filtering.DropDomainFile); err == nil {
+			for _, line := range strings.Split(string(b), "\n") {
+				if _, err := regexp.Compile(strings.ToLower(line)); err != nil {
+					c.add("subprocessors.filtering.drop-domain-file: %v", err)
+				}
+			}
+		}
+	}
+
+	c.file("subprocessors.geoip.mmdb-country-file", s.GeoIP.DbCountryFile)
+	c.file("subprocessors.geoip.mmdb-city-file", s.GeoIP.DbCityFile)
+	c.file("subprocessors.geoip.mmdb-asn-file", s.GeoIP.DbAsnFile)
+}
+
+func (c *checker) checkCollector(kind string, config *Config) {
+	switch kind {
+	case "dnstap":
+		d := config.Collectors.Dnstap
+		if len(d.SockPath) == 0 {
+			c.port("dnstap.listen-port", d.ListenPort)
+		}
+		c.tls("dnstap", d.TlsSupport, d.CertFile, d.KeyFile)
+	case "dns-sniffer":
+		s := config.Collectors.DnsSniffer
+		c.port("dns-sniffer.port", s.Port)
+		c.oneOf("dns-sniffer.link-type", s.LinkType, []string{LinkTypeEthernet, LinkTypeLinuxSLL, LinkTypeRaw})
+		if _, err := GetBpfFilter(s.BpfFilter, s.LinkType); err != nil {
+			c.add("dns-sniffer.bpf-filter: %v", err)
+		}
+		c.positive("dns-sniffer.tcp-flow-timeout", s.TcpFlowTimeout)
+		c.positive("dns-sniffer.defrag-timeout", s.DefragTimeout)
+		c.positive("dns-sniffer.defrag-max-datagrams", s.DefragMaxDatagrams)
+		c.positive("dns-sniffer.fanout-workers", s.FanoutWorkers)
+		if s.RingBuffer {
+			c.positive("dns-sniffer.ring-block-size", s.RingBlockSize)
+			if s.RingBlockSize%os.Getpagesize() != 0 {
+				c.add("dns-sniffer.ring-block-size: must be a multiple of the page size %d, got %d", os.Getpagesize(), s.RingBlockSize)
+			}
+			c.positive("dns-sniffer.ring-block-count", s.RingBlockCount)
+			c.positive("dns-sniffer.ring-block-timeout", s.RingBlockTimeout)
+		}
+		// the key log file can be created later by the resolver
+		if len(s.TlsKeyLogFile) > 0 {
+			c.port("dns-sniffer.dot-port", s.DotPort)
+			c.port("dns-sniffer.doh-port", s.DohPort)
+		}
+	case "dns-proxy":
+		p := config.Collectors.DnsProxy
+		c.port("dns-proxy.listen-port", p.ListenPort)
+		if len(p.UpstreamAddress) == 0 {
+			c.add("dns-proxy.upstream-address: is required")
+		}
+		c.port("dns-proxy.upstream-port", p.UpstreamPort)
+		c.positive("dns-proxy.timeout", p.Timeout)
+		c.positive("dns-proxy.udp-max-pending", p.UdpMaxPending)
+	case "pcap-reader":
+		p := config.Collectors.PcapReader
+		if len(p.Path) == 0 {
+			c.add("pcap-reader.path: is required")
+		}
+		c.file("pcap-reader.path", p.Path)
+		c.port("pcap-reader.port", p.Port)
+		if p.Watch {
+			c.positive("pcap-reader.watch-interval", p.WatchInterval)
+		}
+	case "dnstap-reader":
+		p := config.Collectors.DnstapReader.Path
+		if len(p) == 0 {
+			c.add("dnstap-reader.path: is required")
+		}
+		c.file("dnstap-reader.path", p)
+	case "tail":
+		t := config.Collectors.Tail
+		if len(t.FilePath) == 0 {
+			c.add("tail.file-path: is required")
+		}
+		c.file("tail.file-path", t.FilePath)
+		for key, pattern := range map[string]string{"tail.pattern-query": t.PatternQuery, "tail.pattern-reply": t.PatternReply} {
+			if _, err := regexp.Compile(pattern); err != nil {
+				c.add("%s: %v", key, err)
+			}
+		}
+	}
+}
+
+func (c *checker) checkLogger(kind string, config *Config) {
+	l := config.Loggers
+	switch kind {
+	case "stdout":
+		c.mode("stdout.mode", l.Stdout.Mode)
+		c.textFormat("stdout.text-format", l.Stdout.TextFormat)
+	case "webserver":
+		c.port("webserver.listen-port", l.WebServer.ListenPort)
+		c.tls("webserver", l.WebServer.TlsSupport, l.WebServer.CertFile, l.WebServer.KeyFile)
+	case "prometheus":
+		c.port("prometheus.listen-port", l.Prometheus.ListenPort)
+		c.tls("prometheus", l.Prometheus.TlsSupport, l.Prometheus.CertFile, l.Prometheus.KeyFile)
+	case "logfile":
+		if len(l.LogFile.FilePath) == 0 {
+			c.add("logfile.file-path: is required")
+		}
+		c.mode("logfile.mode", l.LogFile.Mode)
+		c.textFormat("logfile.text-format", l.LogFile.TextFormat)
+		c.positive("logfile.max-size", l.LogFile.MaxSize)
+		c.positive("logfile.flush-interval", l.LogFile.FlushInterval)
+		c.positive("logfile.compress-interval", l.LogFile.CompressInterval)
+	case "dnstap":
+		if len(l.Dnstap.SockPath) == 0 {
+			c.port("dnstap.remote-port", l.Dnstap.RemotePort)
+		}
+		c.positive("dnstap.retry-interval", l.Dnstap.RetryInterval)
+		c.spool("dnstap", l.Dnstap.Spool)
+	case "tcpclient":
+		if len(l.TcpClient.SockPath) == 0 {
+			c.port("tcpclient.remote-port", l.TcpClient.RemotePort)
+		}
+		c.oneOf("tcpclient.transport", l.TcpClient.Transport, []string{"tcp", "unix"})
+		c.positive("tcpclient.retry-interval", l.TcpClient.RetryInterval)
+		c.mode("tcpclient.mode", l.TcpClient.Mode)
+		c.textFormat("tcpclient.text-format", l.TcpClient.TextFormat)
+		c.spool("tcpclient", l.TcpClient.Spool)
+	case "syslog":
+		c.oneOf("syslog.severity", strings.ToUpper(l.Syslog.Severity), syslogPriorities)
+		c.oneOf("syslog.facility", strings.ToUpper(l.Syslog.Facility), syslogPriorities)
+		c.oneOf("syslog.transport", l.Syslog.Transport, []string{"local", "udp", "tcp", "unix", "tcp+tls"})
+		c.mode("syslog.mode", l.Syslog.Mode)
+		c.textFormat("syslog.text-format", l.Syslog.TextFormat)
+	case "fluentd":
+		if len(l.Fluentd.SockPath) == 0 {
+			c.port("fluentd.remote-port", l.Fluentd.RemotePort)
+		}
+		c.oneOf("fluentd.transport", l.Fluentd.Transport, []string{"tcp", "unix"})
+		c.positive("fluentd.retry-interval", l.Fluentd.RetryInterval)
+		c.spool("fluentd", l.Fluentd.Spool)
+	case "pcapfile":
+		if len(l.PcapFile.FilePath) == 0 {
+			c.add("pcapfile.file-path: is required")
+		}
+		c.positive("pcapfile.max-size", l.PcapFile.MaxSize)
+		c.positive("pcapfile.compress-interval", l.PcapFile.CompressInterval)
+	case "dnstapfile":
+		if len(l.DnstapFile.FilePath) == 0 {
+			c.add("dnstapfile.file-path: is required")
+		}
+		c.positive("dnstapfile.max-size", l.DnstapFile.MaxSize)
+		c.positive("dnstapfile.compress-interval", l.DnstapFile.CompressInterval)
+	case "influxdb":
+		if len(l.InfluxDB.ServerURL) == 0 {
+			c.add("influxdb.server-url: is required")
+		}
+	case "lokiclient":
+		if len(l.LokiClient.ServerURL) == 0 {
+			c.add("lokiclient.server-url: is required")
+		}
+		c.positive("lokiclient.flush-interval", l.LokiClient.FlushInterval)
+		c.positive("lokiclient.batch-size", l.LokiClient.BatchSize)
+		c.positive("lokiclient.retry-interval", l.LokiClient.RetryInterval)
+		c.textFormat("lokiclient.text-format", l.LokiClient.TextFormat)
+		c.spool("lokiclient", l.LokiClient.Spool)
+	case "statsd":
+		c.port("statsd.remote-port", l.Statsd.RemotePort)
+		c.oneOf("statsd.transport", l.Statsd.Transport, []string{"udp", "tcp"})
+		c.positive("statsd.flush-interval", l.Statsd.FlushInterval)
+	}
+}
+
+// CheckConfig validates the options of all the enabled collectors and loggers, the options of the
+// multiplexer and the shared sections. All errors found are returned.
+func CheckConfig(config *Config) []error {
+	c := &checker{}
+
+	c.checkSubprocessors(config)
+	c.positive("fanout.queue-size", config.FanOut.QueueSize)
+	if config.FanOut.DrainTimeout < 0 {
+		c.add("fanout.drain-timeout: must be positive, got %d", config.FanOut.DrainTimeout)
+	}
+	if !IsValidPolicy(config.FanOut.OverflowPolicy) {
+		c.add("fanout.overflow-policy: invalid value %q", config.FanOut.OverflowPolicy)
+	}
+
+	c.positive("supervisor.backoff-min", config.Supervisor.BackoffMin)
+	c.positive("supervisor.backoff-max", config.Supervisor.BackoffMax)
+	if config.Supervisor.MaxRestarts < 0 {
+		c.add("supervisor.max-restarts: must be positive, got %d", config.Supervisor.MaxRestarts)
+	}
+
+	if config.ControlPlane.Enable {
+		c.port("control-plane.listen-port", config.ControlPlane.ListenPort)
+		if config.ControlPlane.MaxQueueUsage < 1 || config.ControlPlane.MaxQueueUsage > 100 {
+			c.add("control-plane.max-queue-usage: must be between 1 and 100, got %d", config.ControlPlane.MaxQueueUsage)
+		}
+	}
+
+	c.prefix = "collectors."
+	for _, kind := range config.GetEnabledCollectors() {
+		c.checkCollector(kind, config)
+	}
+	c.prefix = "loggers."
+	for _, kind := range config.GetEnabledLoggers() {
+		c.checkLogger(kind, config)
+	}
+
+	for _, section := range []string{"collectors", "loggers"} {
+		items := config.Multiplexer.Collectors
+		if section == "loggers" {
+			items = config.Multiplexer.Loggers
+		}
+		for _, item := range items {
+			kind, subcfg, err := GetItemConfig(section, config, item)
+			if err != nil {
+				c.errors = append(c.errors, fmt.Errorf("multiplexer.%v", err))
+				continue
+			}
+			c.prefix = fmt.Sprintf("multiplexer.%s %s - ", section, item.Name)
+			if section == "collectors" {
+				c.checkCollector(kind, subcfg)
+			} else {
+				c.checkLogger(kind, subcfg)
+			}
+
+			subcfg, err = GetItemSubprocessors(config, item)
+			if err != nil {
+				c.errors = append(c.errors, fmt.Errorf("multiplexer.%s %v", section, err))
+				continue
+			}
+			if subcfg != nil {
+				c.checkSubprocessors(subcfg)
+			}
+		}
+	}
+
+	return c.errors
+}
@@ -0,0 +1,113 @@
+package dnsutils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidationTextFormat(t *testing.T) {
+	if err := CheckTextFormat("timestamp identity qname qtype"); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	err := CheckTextFormat("timestamp qnam qtype unknown")
+	if err == nil {
+		t.Fatalf("error expected for unknown directives")
+	}
+	if !strings.Contains(err.Error(), "qnam, unknown") {
+		t.Errorf("all unknown directives must be listed: %s", err)
+	}
+}
+
+func TestValidationDefaultConfig(t *testing.T) {
+	config := GetFakeConfig()
+	if errs := CheckConfig(config); len(errs) > 0 {
+		t.Errorf("default config must be valid: %v", errs)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	config := GetFakeConfig()
+	config.Loggers.Stdout.Enable = true
+	config.Loggers.Stdout.Mode = "xml"
+	config.Loggers.Stdout.TextFormat = "qname bad"
+	config.Loggers.WebServer.Enable = true
+	config.Loggers.WebServer.ListenPort = 0
+	config.Loggers.WebServer.TlsSupport = true
+	config.Loggers.WebServer.CertFile = "/nonexistent/cert.pem"
+	config.Loggers.WebServer.KeyFile = "/nonexistent/key.pem"
+	config.FanOut.OverflowPolicy = "drop-all"
+
+	errs := CheckConfig(config)
+	want := []string{
+		"fanout.overflow-policy",
+		"loggers.webserver.listen-port",
+		"loggers.webserver.cert-file",
+		"loggers.webserver.key-file",
+		"loggers.stdout.mode",
+		"loggers.stdout.text-format",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("want %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for i, key := range want {
+		if !strings.HasPrefix(errs[i].Error(), key) {
+			t.Errorf("want error on %s, got %s", key, errs[i])
+		}
+	}
+}
+
+func TestValidationBpfFilter(t *testing.T) {
+	config := GetFakeConfig()
+	config.Collectors.DnsSniffer.Enable = true
+	config.Collectors.DnsSniffer.BpfFilter = "port 53 and not src host 192.168.1.254"
+	if errs := CheckConfig(config); len(errs) > 0 {
+		t.Errorf("bpf filter must be valid: %v", errs)
+	}
+
+	// the filter is compiled when the configuration is loaded
+	config.Collectors.DnsSniffer.BpfFilter = "port 53 and"
+	errs := CheckConfig(config)
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "collectors.dns-sniffer.bpf-filter") {
+		t.Errorf("want error on the bpf filter, got %v", errs)
+	}
+}
+
+func TestValidationMultiplexer(t *testing.T) {
+	config := GetFakeConfig()
+	config.Multiplexer.Loggers = []MultiplexInOut{
+		{
+			Name:   "siem",
+			Params: map[string]interface{}{"tcpclient": map[string]interface{}{"remote-prt": 9999}},
+		},
+		{
+			Name:          "console",
+			Params:        map[string]interface{}{"stdout": map[string]interface{}{"mode": "xml"}},
+			Subprocessors: map[string]interface{}{"transforms": []string{"geoip", "unknown"}},
+		},
+	}
+
+	errs := CheckConfig(config)
+	if len(errs) != 3 {
+		t.Fatalf("want 3 errors, got %d: %v", len(errs), errs)
+	}
+	if !strings.Contains(errs[0].Error(), "remote-prt") {
+		t.Errorf("unknown option expected, got %s", errs[0])
+	}
+	if !strings.HasPrefix(errs[1].Error(), "multiplexer.loggers console - stdout.mode") {
+		t.Errorf("invalid mode expected, got %s", errs[1])
+	}
+	if !strings.Contains(errs[2].Error(), "subprocessors.transforms") {
+		t.Errorf("unknown transform expected, got %s", errs[2])
+	}
+}
+
+func TestValidationConfigFile(t *testing.T) {
+	config, err := LoadConfig("../config.yml")
+	if err != nil {
+		t.Fatalf("unable to load config: %s", err)
+	}
+	if errs := CheckConfig(config); len(errs) > 0 {
+		t.Errorf("config file must be valid: %v", errs)
+	}
+}
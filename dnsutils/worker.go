@@ -1,7 +1,73 @@
 package dnsutils
 
+import (
+	"fmt"
+	"sync/atomic"
+)
+
 type Worker interface {
 	Stop()
 	Run()
 	Channel() chan DnsMessage
 }
+
+// ReadinessProbe is implemented by the workers able to report if they are ready, a collector
+// is ready when it is listening and a network logger when it is connected to its remote destination
+type ReadinessProbe interface {
+	IsReady() bool
+}
+
+// IsWorkerReady returns true if the worker is ready or if it does not implement ReadinessProbe
+func IsWorkerReady(w Worker) bool {
+	if probe, ok := w.(ReadinessProbe); ok {
+		return probe.IsReady()
+	}
+	return true
+}
+
+// Releaser is implemented by the workers holding sockets or files not released when Run fails,
+// Stop can't be called on a failed worker so the supervisor calls Release before to replace it
+type Releaser interface {
+	Release()
+}
+
+// ReleaseWorker releases the resources of the failed worker if it implements Releaser,
+// a panic is returned as an error
+func ReleaseWorker(w Worker) error {
+	c, ok := w.(Releaser)
+	if !ok {
+		return nil
+	}
+	return RecoverError(func() error {
+		c.Release()
+		return nil
+	})
+}
+
+// RecoverError calls the function and returns its panic as an error. The supervisor only recovers
+// the panics of Run, the goroutines spawned by the workers use it to report their failures to Run.
+func RecoverError(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return f()
+}
+
+// ReadyState is a thread safe flag, embedded by the workers to implement ReadinessProbe
+type ReadyState struct {
+	ready int32
+}
+
+func (r *ReadyState) SetReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&r.ready, v)
+}
+
+func (r *ReadyState) IsReady() bool {
+	return atomic.LoadInt32(&r.ready) == 1
+}
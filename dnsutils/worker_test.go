@@ -0,0 +1,79 @@
+package dnsutils
+
+import (
+	"errors"
+	"testing"
+)
+
+type fakeWorker struct {
+	ReadyState
+}
+
+func (w *fakeWorker) Stop()                    {}
+func (w *fakeWorker) Run()                     {}
+func (w *fakeWorker) Channel() chan DnsMessage { return nil }
+
+type noProbeWorker struct{}
+
+func (w *noProbeWorker) Stop()                    {}
+func (w *noProbeWorker) Run()                     {}
+func (w *noProbeWorker) Channel() chan DnsMessage { return nil }
+
+// releaserWorker panics on release after the first call
+type releaserWorker struct {
+	noProbeWorker
+	released int
+}
+
+func (w *releaserWorker) Release() {
+	w.released++
+	if w.released > 1 {
+		panic("already released")
+	}
+}
+
+func TestWorkerReadiness(t *testing.T) {
+	w := &fakeWorker{}
+	if IsWorkerReady(w) {
+		t.Errorf("worker should not be ready")
+	}
+	w.SetReady(true)
+	if !IsWorkerReady(w) {
+		t.Errorf("worker should be ready")
+	}
+
+	// the workers without probe are always ready
+	if !IsWorkerReady(&noProbeWorker{}) {
+		t.Errorf("worker without probe should be ready")
+	}
+}
+
+func TestWorkerRecoverError(t *testing.T) {
+	err := RecoverError(func() error { panic("capture error") })
+	if err == nil || err.Error() != "capture error" {
+		t.Errorf("panic should be returned as an error: %v", err)
+	}
+
+	failure := errors.New("read error")
+	if err := RecoverError(func() error { return failure }); err != failure {
+		t.Errorf("error should be returned: %v", err)
+	}
+	if err := RecoverError(func() error { return nil }); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWorkerRelease(t *testing.T) {
+	w := &releaserWorker{}
+	if err := ReleaseWorker(w); err != nil || w.released != 1 {
+		t.Errorf("worker should be released: %v", err)
+	}
+	if err := ReleaseWorker(w); err == nil || err.Error() != "already released" {
+		t.Errorf("panic should be returned as an error: %v", err)
+	}
+
+	// nothing to do for the workers without release
+	if err := ReleaseWorker(&noProbeWorker{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package loggers
 import (
 	"bufio"
 	"crypto/tls"
+	"fmt"
 	"net"
 	"strconv"
 	"time"
@@ -15,21 +16,25 @@ import (
 )
 
 type DnstapSender struct {
+	dnsutils.ReadyState
 	done    chan bool
 	channel chan dnsutils.DnsMessage
 	config  *dnsutils.Config
 	logger  *logger.Logger
+	name    string
 	exit    chan bool
 	conn    net.Conn
+	spool   *Spool
 }
 
-func NewDnstapSender(config *dnsutils.Config, logger *logger.Logger) *DnstapSender {
+func NewDnstapSender(config *dnsutils.Config, logger *logger.Logger, name string) *DnstapSender {
 	logger.Info("logger dnstap sender - enabled")
 	s := &DnstapSender{
 		done:    make(chan bool),
 		exit:    make(chan bool),
 		channel: make(chan dnsutils.DnsMessage, 512),
 		logger:  logger,
+		name:    name,
 		config:  config,
 	}
 
@@ -39,7 +44,14 @@ func NewDnstapSender(config *dnsutils.Config, logger *logger.Logger) *DnstapSend
 }
 
 func (o *DnstapSender) ReadConfig() {
-	//tbc
+	if o.config.Loggers.Dnstap.Spool.Enable {
+		spool, err := NewSpool("dnstap", o.config.Loggers.Dnstap.Spool, o.logger)
+		if err != nil {
+			o.LogError("spool disabled: %v", err)
+		} else {
+			o.spool = spool
+		}
+	}
 }
 
 func (o *DnstapSender) LogInfo(msg string, v ...interface{}) {
@@ -54,6 +66,16 @@ func (o *DnstapSender) Channel() chan dnsutils.DnsMessage {
 	return o.channel
 }
 
+// Release closes the connection and the spool after a failure of run
+func (o *DnstapSender) Release() {
+	if o.conn != nil {
+		o.conn.Close()
+	}
+	if o.spool != nil {
+		o.spool.Close()
+	}
+}
+
 func (o *DnstapSender) Stop() {
 	o.LogInfo("stopping...")
 
@@ -65,12 +87,85 @@ func (o *DnstapSender) Stop() {
 	close(o.done)
 }
 
+// DnstapEncode converts the dns message to a serialized dnstap message
+func DnstapEncode(dt *dnstap.Dnstap, dm dnsutils.DnsMessage, identity string) ([]byte, error) {
+	dt.Reset()
+
+	t := dnstap.Dnstap_MESSAGE
+	dt.Identity = []byte(identity)
+	dt.Version = []byte("-")
+	dt.Type = &t
+
+	mt := dnstap.Message_Type(dnstap.Message_Type_value[dm.DnsTap.Operation])
+	sf := dnstap.SocketFamily(dnstap.SocketFamily_value[dm.NetworkInfo.Family])
+	sp := dnstap.SocketProtocol(dnstap.SocketProtocol_value[dm.NetworkInfo.Protocol])
+	tsec := uint64(dm.DnsTap.TimeSec)
+	tnsec := uint32(dm.DnsTap.TimeNsec)
+	rportint, err := strconv.Atoi(dm.NetworkInfo.ResponsePort)
+	if err != nil {
+		return nil, fmt.Errorf("response port: %s", err)
+	}
+	rport := uint32(rportint)
+	qportint, err := strconv.Atoi(dm.NetworkInfo.QueryPort)
+	if err != nil {
+		return nil, fmt.Errorf("query port: %s", err)
+	}
+	qport := uint32(qportint)
+
+	msg := &dnstap.Message{Type: &mt}
+
+	msg.SocketFamily = &sf
+	msg.SocketProtocol = &sp
+	msg.QueryAddress = net.ParseIP(dm.NetworkInfo.QueryIp)
+	msg.QueryPort = &qport
+	msg.ResponseAddress = net.ParseIP(dm.NetworkInfo.ResponseIp)
+	msg.ResponsePort = &rport
+
+	if dm.DNS.Type == dnsutils.DnsQuery {
+		msg.QueryMessage = dm.DNS.Payload
+		msg.QueryTimeSec = &tsec
+		msg.QueryTimeNsec = &tnsec
+	} else {
+		msg.ResponseTimeSec = &tsec
+		msg.ResponseTimeNsec = &tnsec
+		msg.ResponseMessage = dm.DNS.Payload
+	}
+
+	dt.Message = msg
+
+	return proto.Marshal(dt)
+}
+
+func (o *DnstapSender) Send(fs *framestream.Fstrm, dt *dnstap.Dnstap, frame *framestream.Frame, dm dnsutils.DnsMessage) error {
+	data, err := DnstapEncode(dt, dm, o.config.Subprocessors.ServerId)
+	if err != nil {
+		o.LogError("error to encode dnstap %s", err)
+		return nil
+	}
+
+	frame.Write(data)
+	return fs.SendFrame(frame)
+}
+
+// Wait before the next connection attempt, the dns messages are spooled on disk in the meantime
+func (o *DnstapSender) Wait() {
+	interval := time.Duration(o.config.Loggers.Dnstap.RetryInterval) * time.Second
+	if o.spool != nil {
+		o.spool.Hold(o.channel, interval)
+	} else {
+		time.Sleep(interval)
+	}
+}
+
 func (o *DnstapSender) Run() {
 	o.LogInfo("running in background...")
 
 	dt := &dnstap.Dnstap{}
 	frame := &framestream.Frame{}
 
+	reconnects := dnsutils.Telemetry.Get(dnsutils.MetricReconnects, o.name)
+	attempts := 0
+
 LOOP:
 	for {
 	LOOP_RECONNECT:
@@ -90,7 +185,12 @@ LOOP:
 					transport = "tcp"
 				}
 
-				// make the connection
+				// make the connection, the next attempts are reconnections
+				if attempts > 0 {
+					reconnects.Inc()
+				}
+				attempts++
+				o.SetReady(false)
 				o.LogInfo("connecting to %s", address)
 				var conn net.Conn
 				var err error
@@ -110,6 +210,7 @@ LOOP:
 
 				if conn != nil {
 					o.LogInfo("connected with remote")
+					o.SetReady(true)
 					o.conn = conn
 					// frame stream library
 					r := bufio.NewReader(conn)
@@ -124,67 +225,31 @@ LOOP:
 						o.LogInfo("framestream initialized")
 					}
 
+					// replay messages spooled during the outage
+					if o.spool != nil {
+						if err := o.spool.Replay(func(dm dnsutils.DnsMessage) error { return o.Send(fs, dt, frame, dm) }); err != nil {
+							o.LogError("replay error: %s", err)
+							break LOOP_RECONNECT
+						}
+					}
+
 					for {
 						select {
 						case dm := <-o.channel:
-
-							dt.Reset()
-
-							t := dnstap.Dnstap_MESSAGE
-							dt.Identity = []byte(o.config.Subprocessors.ServerId)
-							dt.Version = []byte("-")
-							dt.Type = &t
-
-							mt := dnstap.Message_Type(dnstap.Message_Type_value[dm.DnsTap.Operation])
-							sf := dnstap.SocketFamily(dnstap.SocketFamily_value[dm.NetworkInfo.Family])
-							sp := dnstap.SocketProtocol(dnstap.SocketProtocol_value[dm.NetworkInfo.Protocol])
-							tsec := uint64(dm.DnsTap.TimeSec)
-							tnsec := uint32(dm.DnsTap.TimeNsec)
-							rportint, err := strconv.Atoi(dm.NetworkInfo.ResponsePort)
-							if err != nil {
-								o.LogError("error to encode dnstap response port %s", err)
-								continue
-							}
-							rport := uint32(rportint)
-							qportint, err := strconv.Atoi(dm.NetworkInfo.QueryPort)
-							if err != nil {
-								o.LogError("error to encode dnstap query port %s", err)
-								continue
-							}
-							qport := uint32(qportint)
-
-							msg := &dnstap.Message{Type: &mt}
-
-							msg.SocketFamily = &sf
-							msg.SocketProtocol = &sp
-							msg.QueryAddress = net.ParseIP(dm.NetworkInfo.QueryIp)
-							msg.QueryPort = &qport
-							msg.ResponseAddress = net.ParseIP(dm.NetworkInfo.ResponseIp)
-							msg.ResponsePort = &rport
-
-							if dm.DNS.Type == dnsutils.DnsQuery {
-								msg.QueryMessage = dm.DNS.Payload
-								msg.QueryTimeSec = &tsec
-								msg.QueryTimeNsec = &tnsec
-							} else {
-								msg.ResponseTimeSec = &tsec
-								msg.ResponseTimeNsec = &tnsec
-								msg.ResponseMessage = dm.DNS.Payload
-							}
-
-							dt.Message = msg
-
-							data, err := proto.Marshal(dt)
-							if err != nil {
-								o.LogError("proto marshal error %s", err)
-							}
-
-							frame.Write(data)
-							if err := fs.SendFrame(frame); err != nil {
+							if err := o.Send(fs, dt, frame, dm); err != nil {
+								dnsutils.Telemetry.Get(dnsutils.MetricSendErrors, o.name).Inc()
 								o.LogError("send frame error %s", err)
+								if o.spool == nil || o.spool.Write(dm) != nil {
+									dnsutils.Lost.Add(o.name, 1)
+								}
 								break LOOP_RECONNECT
 							}
 						case <-o.exit:
+							// send the messages still in the channel before to close the framestream
+							if lost := drainChannel(o.channel, o.spool, func(dm dnsutils.DnsMessage) error { return o.Send(fs, dt, frame, dm) }); lost > 0 {
+								dnsutils.Lost.Add(o.name, uint64(lost))
+								o.LogError("%d messages lost", lost)
+							}
 							o.logger.Info("closing framestream")
 							if err = fs.ResetSender(); err != nil {
 								o.LogError("reset framestream error %s", err)
@@ -195,15 +260,25 @@ LOOP:
 
 				}
 				o.LogInfo("retry to connect in 5 seconds")
-				time.Sleep(time.Duration(o.config.Loggers.Dnstap.RetryInterval) * time.Second)
+				o.Wait()
 			}
 		}
 	}
 
+	// the remaining messages are spooled if the remote is unreachable
+	if lost := drainChannel(o.channel, o.spool, nil); lost > 0 {
+		dnsutils.Lost.Add(o.name, uint64(lost))
+		o.LogError("%d messages lost", lost)
+	}
+
 	if o.conn != nil {
 		o.LogInfo("closing tcp connection")
 		o.conn.Close()
 	}
+	if o.spool != nil {
+		o.spool.Close()
+	}
+	o.SetReady(false)
 	o.LogInfo("run terminated")
 	o.done <- true
 }
@@ -0,0 +1,348 @@
+package loggers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnstap-protobuf"
+	"github.com/dmachard/go-framestream"
+	"github.com/dmachard/go-logger"
+)
+
+// DnstapWriter writes the dns messages in dnstap frame stream files, each file holds
+// one complete stream from the start frame to the stop frame
+type DnstapWriter struct {
+	done          chan bool
+	channel       chan dnsutils.DnsMessage
+	config        *dnsutils.Config
+	logger        *logger.Logger
+	name          string
+	fs            *framestream.Fstrm
+	dt            *dnstap.Dnstap
+	frame         *framestream.Frame
+	fd            *os.File
+	size          int64
+	filedir       string
+	filename      string
+	fileext       string
+	fileprefix    string
+	compressTimer *time.Timer
+}
+
+func NewDnstapFile(config *dnsutils.Config, console *logger.Logger, name string) *DnstapWriter {
+	console.Info("logger to dnstap file - enabled")
+	o := &DnstapWriter{
+		done:    make(chan bool),
+		channel: make(chan dnsutils.DnsMessage, 512),
+		logger:  console,
+		name:    name,
+		config:  config,
+		dt:      &dnstap.Dnstap{},
+		frame:   &framestream.Frame{},
+	}
+	o.ReadConfig()
+
+	// the stream of the previous run is archived, a stream can't be continued
+	if fileinfo, err := os.Stat(o.config.Loggers.DnstapFile.FilePath); err == nil && fileinfo.Size() > 0 {
+		if err := o.Archive(); err != nil {
+			o.logger.Fatal("unable to rotate file: ", err)
+		}
+	}
+
+	if err := o.OpenFile(); err != nil {
+		o.logger.Fatal("unable to create file: ", err)
+	}
+
+	return o
+}
+
+func (o *DnstapWriter) ReadConfig() {
+	o.filedir = filepath.Dir(o.config.Loggers.DnstapFile.FilePath)
+	o.filename = filepath.Base(o.config.Loggers.DnstapFile.FilePath)
+	o.fileext = filepath.Ext(o.filename)
+	o.fileprefix = strings.TrimSuffix(o.filename, o.fileext)
+}
+
+func (o *DnstapWriter) LogInfo(msg string, v ...interface{}) {
+	o.logger.Info("logger to dnstap file - "+msg, v...)
+}
+
+func (o *DnstapWriter) LogError(msg string, v ...interface{}) {
+	o.logger.Error("logger to dnstap file - "+msg, v...)
+}
+
+func (o *DnstapWriter) Channel() chan dnsutils.DnsMessage {
+	return o.channel
+}
+
+// Release closes the file after a failure of run
+func (o *DnstapWriter) Release() {
+	if o.fd != nil {
+		o.fd.Close()
+	}
+}
+
+func (o *DnstapWriter) Stop() {
+	o.LogInfo("stopping...")
+
+	// close output channel
+	o.LogInfo("closing channel")
+	close(o.channel)
+
+	// read done channel and block until run is terminated
+	<-o.done
+	close(o.done)
+
+	// closing the stream and the file when all messages are written
+	o.CloseFile()
+}
+
+// OpenFile creates a new file and writes the start frame of the stream
+func (o *DnstapWriter) OpenFile() error {
+	var err error
+	o.fd, err = os.OpenFile(o.config.Loggers.DnstapFile.FilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	// frame stream library, unidirectional mode without handshake
+	o.fs = framestream.NewFstrm(nil, bufio.NewWriter(o.fd), nil, 0, []byte("protobuf:dnstap.Dnstap"), false)
+	if err := o.fs.InitSender(); err != nil {
+		return err
+	}
+
+	fileinfo, err := o.fd.Stat()
+	if err != nil {
+		return err
+	}
+	o.size = fileinfo.Size()
+
+	return nil
+}
+
+// CloseFile writes the stop frame of the stream and closes the file
+func (o *DnstapWriter) CloseFile() {
+	if err := o.fs.ResetSender(); err != nil {
+		o.LogError("unable to close the stream: %s", err)
+	}
+	o.fd.Close()
+}
+
+func (o *DnstapWriter) MaxSize() int64 {
+	return int64(1024*1024) * int64(o.config.Loggers.DnstapFile.MaxSize)
+}
+
+func (o *DnstapWriter) Cleanup() error {
+	// remove old files ?
+	files, err := ioutil.ReadDir(o.filedir)
+	if err != nil {
+		return err
+	}
+
+	// extract timestamp from filename
+	re := regexp.MustCompile(`^` + regexp.QuoteMeta(o.fileprefix) + `-(?P<ts>\d+)` + regexp.QuoteMeta(o.fileext))
+	tsIndex := re.SubexpIndex("ts")
+
+	logFiles := []int{}
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		matches := re.FindStringSubmatch(f.Name())
+		if len(matches) == 0 {
+			continue
+		}
+
+		// convert timestamp to int
+		i, err := strconv.Atoi(matches[tsIndex])
+		if err != nil {
+			continue
+		}
+		logFiles = append(logFiles, i)
+	}
+	sort.Ints(logFiles)
+
+	// too much log files ?
+	diff_nb := len(logFiles) - o.config.Loggers.DnstapFile.MaxFiles
+	for i := 0; i < diff_nb; i++ {
+		filename := fmt.Sprintf("%s-%d%s", o.fileprefix, logFiles[i], o.fileext)
+		f := filepath.Join(o.filedir, filename)
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			f = filepath.Join(o.filedir, filename+compressSuffix)
+		}
+
+		os.Remove(f)
+	}
+
+	return nil
+}
+
+// CompressFile replaces the rotated file by its gzip version
+func (o *DnstapWriter) CompressFile(src string) error {
+	fl, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fl.Close()
+
+	dst := src + compressSuffix
+	gzf, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer gzf.Close()
+
+	gz := gzip.NewWriter(gzf)
+	if _, err := io.Copy(gz, fl); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	if err := gzf.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return nil
+}
+
+func (o *DnstapWriter) Compress() {
+	files, err := ioutil.ReadDir(o.filedir)
+	if err != nil {
+		o.LogError("unable to list all files: %s", err)
+	}
+
+	re := regexp.MustCompile(`^` + regexp.QuoteMeta(o.fileprefix) + `-\d+` + regexp.QuoteMeta(o.fileext) + `$`)
+	for _, f := range files {
+		// ignore folder
+		if f.IsDir() || !re.MatchString(f.Name()) {
+			continue
+		}
+
+		if err := o.CompressFile(filepath.Join(o.filedir, f.Name())); err != nil {
+			o.LogError("compress - failed to compress dnstap file: %s", err)
+		}
+	}
+
+	o.compressTimer.Reset(time.Duration(o.config.Loggers.DnstapFile.CompressInterval) * time.Second)
+}
+
+func (o *DnstapWriter) PostRotateCommand(filename string) {
+	if len(o.config.Loggers.DnstapFile.PostRotateCommand) > 0 {
+		out, err := exec.Command(o.config.Loggers.DnstapFile.PostRotateCommand, filename).Output()
+		if err != nil {
+			o.LogError("postrotate command error: %s", err)
+			o.LogError("postrotate output: %s", out)
+		} else {
+			if o.config.Loggers.DnstapFile.PostRotateDelete {
+				os.Remove(filename)
+			}
+		}
+	}
+}
+
+// Archive renames the current file with a timestamp, then runs the post rotate command
+// and keeps only max files
+func (o *DnstapWriter) Archive() error {
+	bfpath := filepath.Join(o.filedir, fmt.Sprintf("%s-%d%s", o.fileprefix, time.Now().Unix(), o.fileext))
+	if err := os.Rename(o.config.Loggers.DnstapFile.FilePath, bfpath); err != nil {
+		return err
+	}
+
+	// post rotate command?
+	o.PostRotateCommand(bfpath)
+
+	// keep only max files
+	if err := o.Cleanup(); err != nil {
+		o.LogError("unable to cleanup dnstap files: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (o *DnstapWriter) Rotate() error {
+	// closing current stream and file
+	o.CloseFile()
+
+	if err := o.Archive(); err != nil {
+		return err
+	}
+
+	// re-create the main file.
+	if err := o.OpenFile(); err != nil {
+		o.LogError("unable to re-create dnstap file: %s", err)
+	}
+
+	return nil
+}
+
+func (o *DnstapWriter) Write(dm dnsutils.DnsMessage) {
+	data, err := DnstapEncode(o.dt, dm, o.config.Subprocessors.ServerId)
+	if err != nil {
+		o.LogError("error to encode dnstap %s", err)
+		return
+	}
+	o.frame.Write(data)
+
+	// rotate dnstap file ?
+	write_len := int64(o.frame.Len())
+	if (o.size + write_len) > o.MaxSize() {
+		if err := o.Rotate(); err != nil {
+			o.LogError("failed to rotate file: %s", err)
+			return
+		}
+	}
+
+	if err := o.fs.SendFrame(o.frame); err != nil {
+		o.LogError("write error: %s", err)
+		return
+	}
+
+	// increase size file
+	o.size += write_len
+}
+
+func (o *DnstapWriter) Run() {
+	o.LogInfo("running in background...")
+
+	o.compressTimer = time.NewTimer(time.Duration(o.config.Loggers.DnstapFile.CompressInterval) * time.Second)
+LOOP:
+	for {
+		select {
+		case dm, opened := <-o.channel:
+			if !opened {
+				o.LogInfo("channel closed")
+				break LOOP
+			}
+			o.Write(dm)
+
+		case <-o.compressTimer.C:
+			if o.config.Loggers.DnstapFile.Compress {
+				o.Compress()
+			}
+		}
+	}
+	o.LogInfo("run terminated")
+
+	// the job is done
+	o.done <- true
+}
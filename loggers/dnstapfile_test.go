@@ -0,0 +1,86 @@
+package loggers
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnstap-protobuf"
+	"github.com/dmachard/go-framestream"
+	"github.com/dmachard/go-logger"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDnstapFileWrite(t *testing.T) {
+	dir, err := os.MkdirTemp("", "dnstapfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// config
+	config := dnsutils.GetFakeConfig()
+	config.Loggers.DnstapFile.FilePath = filepath.Join(dir, "dnstap.fstrm")
+
+	// write a fake dns message, the stream is closed on stop
+	g := NewDnstapFile(config, logger.New(false), "dnstapfile")
+	go g.Run()
+	g.Channel() <- dnsutils.GetFakeDnsMessage()
+	g.Stop()
+
+	// read the file as a unidirectional frame stream
+	f, err := os.Open(config.Loggers.DnstapFile.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	fs := framestream.NewFstrm(bufio.NewReader(f), nil, nil, 0, []byte("protobuf:dnstap.Dnstap"), false)
+	if err := fs.InitReceiver(); err != nil {
+		t.Fatalf("invalid start of stream: %s", err)
+	}
+
+	frames := make(chan []byte, 10)
+	if err := fs.ProcessFrame(frames); err != nil {
+		t.Fatalf("frame stream error: %s", err)
+	}
+	if len(frames) != 1 {
+		t.Fatalf("want 1 frame, got %d", len(frames))
+	}
+
+	dt := &dnstap.Dnstap{}
+	if err := proto.Unmarshal(<-frames, dt); err != nil {
+		t.Fatalf("dnstap proto unmarshal error %s", err)
+	}
+	if dt.GetMessage().GetType() != dnstap.Message_CLIENT_QUERY {
+		t.Errorf("want CLIENT_QUERY, got %s", dt.GetMessage().GetType())
+	}
+}
+
+func TestDnstapFileRotateAtStartup(t *testing.T) {
+	dir, err := os.MkdirTemp("", "dnstapfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := dnsutils.GetFakeConfig()
+	config.Loggers.DnstapFile.FilePath = filepath.Join(dir, "dnstap.fstrm")
+
+	// a stream of a previous run
+	g := NewDnstapFile(config, logger.New(false), "dnstapfile")
+	go g.Run()
+	g.Stop()
+
+	// the previous stream is archived, a new one is started
+	g = NewDnstapFile(config, logger.New(false), "dnstapfile")
+	go g.Run()
+	g.Stop()
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "dnstap-*.fstrm"))
+	if len(matches) != 1 {
+		t.Errorf("the previous file should be rotated, got %v", matches)
+	}
+}
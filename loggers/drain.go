@@ -0,0 +1,32 @@
+package loggers
+
+import (
+	"github.com/dmachard/go-dnscollector/dnsutils"
+)
+
+// drainChannel reads the dns messages still buffered in the channel without blocking and sends them,
+// after the first send error or if send is nil the remaining messages are written in the spool if enabled.
+// The number of lost messages is returned.
+func drainChannel(channel chan dnsutils.DnsMessage, spool *Spool, send func(dm dnsutils.DnsMessage) error) int {
+	lost := 0
+	for {
+		select {
+		case dm, opened := <-channel:
+			if !opened {
+				return lost
+			}
+			if send != nil {
+				if err := send(dm); err == nil {
+					continue
+				}
+				send = nil
+			}
+			if spool != nil && spool.Write(dm) == nil {
+				continue
+			}
+			lost++
+		default:
+			return lost
+		}
+	}
+}
@@ -12,21 +12,25 @@ import (
 )
 
 type FluentdClient struct {
+	dnsutils.ReadyState
 	done    chan bool
 	channel chan dnsutils.DnsMessage
 	config  *dnsutils.Config
 	logger  *logger.Logger
+	name    string
 	exit    chan bool
 	conn    net.Conn
+	spool   *Spool
 }
 
-func NewFluentdClient(config *dnsutils.Config, logger *logger.Logger) *FluentdClient {
+func NewFluentdClient(config *dnsutils.Config, logger *logger.Logger, name string) *FluentdClient {
 	logger.Info("logger to fluentd - enabled")
 	s := &FluentdClient{
 		done:    make(chan bool),
 		exit:    make(chan bool),
 		channel: make(chan dnsutils.DnsMessage, 512),
 		logger:  logger,
+		name:    name,
 		config:  config,
 	}
 
@@ -36,7 +40,14 @@ func NewFluentdClient(config *dnsutils.Config, logger *logger.Logger) *FluentdCl
 }
 
 func (o *FluentdClient) ReadConfig() {
-	//tbc
+	if o.config.Loggers.Fluentd.Spool.Enable {
+		spool, err := NewSpool("fluentd", o.config.Loggers.Fluentd.Spool, o.logger)
+		if err != nil {
+			o.LogError("spool disabled: %v", err)
+		} else {
+			o.spool = spool
+		}
+	}
 }
 
 func (o *FluentdClient) LogInfo(msg string, v ...interface{}) {
@@ -51,6 +62,16 @@ func (o *FluentdClient) Channel() chan dnsutils.DnsMessage {
 	return o.channel
 }
 
+// Release closes the connection and the spool after a failure of run
+func (o *FluentdClient) Release() {
+	if o.conn != nil {
+		o.conn.Close()
+	}
+	if o.spool != nil {
+		o.spool.Close()
+	}
+}
+
 func (o *FluentdClient) Stop() {
 	o.LogInfo("stopping...")
 
@@ -62,9 +83,45 @@ func (o *FluentdClient) Stop() {
 	close(o.done)
 }
 
+func (o *FluentdClient) Send(tag []byte, dm dnsutils.DnsMessage) error {
+	// prepare event
+	tm, _ := msgpack.Marshal(dm.DnsTap.TimeSec)
+	record, err := msgpack.Marshal(dm)
+	if err != nil {
+		o.LogError("msgpack error:", err.Error())
+		return nil
+	}
+
+	// Message ::= [ Tag, Time, Record, Option? ]
+	encoded := []byte{}
+	// array, size 3
+	encoded = append(encoded, 0x93)
+	// append tag, time and record
+	encoded = append(encoded, tag...)
+	encoded = append(encoded, tm...)
+	encoded = append(encoded, record...)
+
+	// write event message
+	_, err = o.conn.Write(encoded)
+	return err
+}
+
+// Wait before the next connection attempt, the dns messages are spooled on disk in the meantime
+func (o *FluentdClient) Wait() {
+	interval := time.Duration(o.config.Loggers.Fluentd.RetryInterval) * time.Second
+	if o.spool != nil {
+		o.spool.Hold(o.channel, interval)
+	} else {
+		time.Sleep(interval)
+	}
+}
+
 func (o *FluentdClient) Run() {
 	o.LogInfo("running in background...")
 
+	reconnects := dnsutils.Telemetry.Get(dnsutils.MetricReconnects, o.name)
+	attempts := 0
+
 LOOP:
 	for {
 	LOOP_RECONNECT:
@@ -81,7 +138,12 @@ LOOP:
 					address = o.config.Loggers.Fluentd.RemoteAddress + ":" + strconv.Itoa(o.config.Loggers.Fluentd.RemotePort)
 				}
 
-				// make the connection
+				// make the connection, the next attempts are reconnections
+				if attempts > 0 {
+					reconnects.Inc()
+				}
+				attempts++
+				o.SetReady(false)
 				o.LogInfo("connecting to %s", address)
 				//var conn net.Conn
 				var err error
@@ -102,52 +164,61 @@ LOOP:
 				// loop
 				if o.conn != nil {
 					o.LogInfo("connected")
+					o.SetReady(true)
 					tag, _ := msgpack.Marshal(o.config.Loggers.Fluentd.Tag)
+
+					// replay messages spooled during the outage
+					if o.spool != nil {
+						if err := o.spool.Replay(func(dm dnsutils.DnsMessage) error { return o.Send(tag, dm) }); err != nil {
+							o.LogError("replay error: %s", err)
+							break LOOP_RECONNECT
+						}
+					}
+
 					for {
 						select {
 						case dm := <-o.channel:
-							// prepare event
-							tm, _ := msgpack.Marshal(dm.DnsTap.TimeSec)
-							record, err := msgpack.Marshal(dm)
-							if err != nil {
-								o.LogError("msgpack error:", err.Error())
-								continue
-							}
-
-							// Message ::= [ Tag, Time, Record, Option? ]
-							encoded := []byte{}
-							// array, size 3
-							encoded = append(encoded, 0x93)
-							// append tag, time and record
-							encoded = append(encoded, tag...)
-							encoded = append(encoded, tm...)
-							encoded = append(encoded, record...)
-
-							// write event message
-							_, err = o.conn.Write(encoded)
-
-							// flusth the buffer
+							err = o.Send(tag, dm)
 							if err != nil {
+								dnsutils.Telemetry.Get(dnsutils.MetricSendErrors, o.name).Inc()
 								o.LogError("connection error:", err.Error())
+								if o.spool == nil || o.spool.Write(dm) != nil {
+									dnsutils.Lost.Add(o.name, 1)
+								}
 								break LOOP_RECONNECT
 							}
 						case <-o.exit:
 							o.logger.Info("closing loop...")
+							// send the messages still in the channel before to close the connection
+							if lost := drainChannel(o.channel, o.spool, func(dm dnsutils.DnsMessage) error { return o.Send(tag, dm) }); lost > 0 {
+								dnsutils.Lost.Add(o.name, uint64(lost))
+								o.LogError("%d messages lost", lost)
+							}
 							break LOOP
 						}
 					}
 
 				}
 				o.LogInfo("retry to connect in %d seconds", o.config.Loggers.Fluentd.RetryInterval)
-				time.Sleep(time.Duration(o.config.Loggers.Fluentd.RetryInterval) * time.Second)
+				o.Wait()
 			}
 		}
 	}
 
+	// the remaining messages are spooled if the remote is unreachable
+	if lost := drainChannel(o.channel, o.spool, nil); lost > 0 {
+		dnsutils.Lost.Add(o.name, uint64(lost))
+		o.LogError("%d messages lost", lost)
+	}
+
 	if o.conn != nil {
 		o.LogInfo("closing tcp connection")
 		o.conn.Close()
 	}
+	if o.spool != nil {
+		o.spool.Close()
+	}
+	o.SetReady(false)
 	o.LogInfo("run terminated")
 	o.done <- true
 }
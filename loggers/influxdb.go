@@ -16,12 +16,13 @@ type InfluxDBClient struct {
 	channel      chan dnsutils.DnsMessage
 	config       *dnsutils.Config
 	logger       *logger.Logger
+	name         string
 	influxdbConn influxdb2.Client
 	writeAPI     api.WriteAPI
 	exit         chan bool
 }
 
-func NewInfluxDBClient(config *dnsutils.Config, logger *logger.Logger) *InfluxDBClient {
+func NewInfluxDBClient(config *dnsutils.Config, logger *logger.Logger, name string) *InfluxDBClient {
 	logger.Info("logger to influxdb - enabled")
 
 	s := &InfluxDBClient{
@@ -29,6 +30,7 @@ func NewInfluxDBClient(config *dnsutils.Config, logger *logger.Logger) *InfluxDB
 		exit:    make(chan bool),
 		channel: make(chan dnsutils.DnsMessage, 512),
 		logger:  logger,
+		name:    name,
 		config:  config,
 	}
 
@@ -53,6 +55,13 @@ func (o *InfluxDBClient) Channel() chan dnsutils.DnsMessage {
 	return o.channel
 }
 
+// Release closes the client after a failure of run
+func (o *InfluxDBClient) Release() {
+	if o.influxdbConn != nil {
+		o.influxdbConn.Close()
+	}
+}
+
 func (o *InfluxDBClient) Stop() {
 	o.LogInfo("stopping...")
 
@@ -60,14 +69,14 @@ func (o *InfluxDBClient) Stop() {
 	o.LogInfo("closing channel")
 	close(o.channel)
 
+	// read done channel and block until run is terminated
+	<-o.done
+	close(o.done)
+
 	// Force all unwritten data to be sent
 	o.writeAPI.Flush()
 	// Ensures background processes finishes
 	o.influxdbConn.Close()
-
-	// read done channel and block until run is terminated
-	<-o.done
-	close(o.done)
 }
 
 func (o *InfluxDBClient) Run() {
@@ -91,6 +100,15 @@ func (o *InfluxDBClient) Run() {
 
 	o.influxdbConn = influxClient
 	o.writeAPI = writeAPI
+
+	// the write errors are reported asynchronously
+	writeErrors := writeAPI.Errors()
+	go func() {
+		for err := range writeErrors {
+			dnsutils.Telemetry.Get(dnsutils.MetricSendErrors, o.name).Inc()
+			o.LogError("write error: %v", err)
+		}
+	}()
 	for dm := range o.channel {
 		p := influxdb2.NewPointWithMeasurement("dns").
 			AddTag("Identity", dm.DnsTap.Identity).
@@ -32,6 +32,7 @@ type LogFile struct {
 	file           *os.File
 	config         *dnsutils.Config
 	logger         *logger.Logger
+	name           string
 	size           int64
 	filedir        string
 	filename       string
@@ -41,13 +42,14 @@ type LogFile struct {
 	textFormat     []string
 }
 
-func NewLogFile(config *dnsutils.Config, logger *logger.Logger) *LogFile {
+func NewLogFile(config *dnsutils.Config, logger *logger.Logger, name string) *LogFile {
 	logger.Info("logger logfile - enabled")
 	o := &LogFile{
 		done:    make(chan bool),
 		channel: make(chan dnsutils.DnsMessage, 512),
 		config:  config,
 		logger:  logger,
+		name:    name,
 	}
 
 	o.ReadConfig()
@@ -131,19 +133,26 @@ func (o *LogFile) Flush() {
 	o.writer.Flush()
 }
 
+// Release closes the file after a failure of run
+func (o *LogFile) Release() {
+	if o.file != nil {
+		o.file.Close()
+	}
+}
+
 func (o *LogFile) Stop() {
 	o.LogInfo("stopping...")
 
 	// close output channel
 	close(o.channel)
 
-	// close the file
-	o.LogInfo("closing file")
-	o.file.Close()
-
 	// read done channel and block until run is terminated
 	<-o.done
 	close(o.done)
+
+	// close the file, the buffered writer is flushed at the end of the run
+	o.LogInfo("closing file")
+	o.file.Close()
 }
 
 func (o *LogFile) Cleanup() error {
@@ -342,6 +351,9 @@ LOOP:
 				delimiter := "\n"
 				o.Write(dm.Bytes(o.textFormat, delimiter))
 			case "json":
+				if o.config.Loggers.LogFile.RdataFields {
+					dm = dm.WithRdataFields()
+				}
 				json.NewEncoder(buffer).Encode(dm)
 				o.Write(buffer.Bytes())
 				buffer.Reset()
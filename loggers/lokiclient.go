@@ -21,19 +21,23 @@ import (
 )
 
 type LokiClient struct {
+	dnsutils.ReadyState
 	done        chan bool
 	channel     chan dnsutils.DnsMessage
 	config      *dnsutils.Config
 	logger      *logger.Logger
+	name        string
 	exit        chan bool
 	stream      *logproto.Stream
 	pushrequest *logproto.PushRequest
 	httpclient  *http.Client
 	textFormat  []string
 	sizeentries int
+	spool       *Spool
+	pending     []dnsutils.DnsMessage
 }
 
-func NewLokiClient(config *dnsutils.Config, logger *logger.Logger) *LokiClient {
+func NewLokiClient(config *dnsutils.Config, logger *logger.Logger, name string) *LokiClient {
 	logger.Info("logger loki - enabled")
 
 	s := &LokiClient{
@@ -41,6 +45,7 @@ func NewLokiClient(config *dnsutils.Config, logger *logger.Logger) *LokiClient {
 		exit:    make(chan bool),
 		channel: make(chan dnsutils.DnsMessage, 512),
 		logger:  logger,
+		name:    name,
 		config:  config,
 	}
 
@@ -79,6 +84,15 @@ func (o *LokiClient) ReadConfig() {
 	}
 
 	o.httpclient = &http.Client{Transport: tr}
+
+	if o.config.Loggers.LokiClient.Spool.Enable {
+		spool, err := NewSpool("lokiclient", o.config.Loggers.LokiClient.Spool, o.logger)
+		if err != nil {
+			o.LogError("spool disabled: %v", err)
+		} else {
+			o.spool = spool
+		}
+	}
 }
 
 func (o *LokiClient) LogInfo(msg string, v ...interface{}) {
@@ -93,6 +107,13 @@ func (o *LokiClient) Channel() chan dnsutils.DnsMessage {
 	return o.channel
 }
 
+// Release closes the spool after a failure of run
+func (o *LokiClient) Release() {
+	if o.spool != nil {
+		o.spool.Close()
+	}
+}
+
 func (o *LokiClient) Stop() {
 	o.LogInfo("stopping...")
 
@@ -123,21 +144,38 @@ func (o *LokiClient) Run() {
 
 	tflush_interval := time.Duration(o.config.Loggers.LokiClient.FlushInterval) * time.Second
 	tflush := time.NewTimer(tflush_interval)
+	channel := o.channel
+
+	// the remote is considered reachable until the first error
+	o.SetReady(true)
 
 LOOP:
 	for {
+		// replay messages spooled during the outage
+		if err := o.ReplaySpool(); err != nil {
+			o.LogError("replay error - %v", err)
+			o.LogInfo("retry in %d seconds", o.config.Loggers.LokiClient.RetryInterval)
+			dnsutils.Telemetry.Get(dnsutils.MetricReconnects, o.name).Inc()
+			o.Wait()
+			select {
+			case <-o.exit:
+				o.logger.Info("closing loop...")
+				break LOOP
+			default:
+				continue
+			}
+		}
+
 	LOOP_RECONNECT:
 		for {
 			select {
-			case dm := <-o.channel:
-				// prepare entry
-				entry := logproto.Entry{}
-				entry.Timestamp = time.Unix(int64(dm.DnsTap.TimeSec), int64(dm.DnsTap.TimeNsec))
-				entry.Line = dm.String(o.textFormat)
-				o.sizeentries += len(entry.Line)
-
-				// append entry to the stream
-				o.stream.Entries = append(o.stream.Entries, entry)
+			case dm, opened := <-channel:
+				// the channel is closed on stop
+				if !opened {
+					channel = nil
+					continue
+				}
+				o.AddEntry(dm)
 
 				if o.sizeentries >= o.config.Loggers.LokiClient.BatchSize {
 					// encode log entries
@@ -153,6 +191,7 @@ LOOP:
 					err = o.SendEntries(buf)
 					if err != nil {
 						o.LogError("error sending log entries - %v", err)
+						o.SpoolEntries()
 						break LOOP_RECONNECT
 					}
 
@@ -178,6 +217,7 @@ LOOP:
 					err = o.SendEntries(buf)
 					if err != nil {
 						o.LogError("error sending log entries - %v", err)
+						o.SpoolEntries()
 						// restart timer
 						tflush.Reset(tflush_interval)
 
@@ -197,15 +237,127 @@ LOOP:
 
 		}
 		o.LogInfo("retry in %d seconds", o.config.Loggers.LokiClient.RetryInterval)
-		time.Sleep(time.Duration(o.config.Loggers.LokiClient.RetryInterval) * time.Second)
+		dnsutils.Telemetry.Get(dnsutils.MetricReconnects, o.name).Inc()
+		o.Wait()
 	}
 
-	// if buffer is not empty, we accept to lose log entries
+	// send the entries not yet sent and the messages still in the channel
+	drainChannel(o.channel, nil, func(dm dnsutils.DnsMessage) error {
+		o.AddEntry(dm)
+		return nil
+	})
+	o.FlushEntries()
+	if o.spool != nil {
+		o.spool.Close()
+	}
+	o.SetReady(false)
 	o.LogInfo("run terminated")
 	// the job is done
 	o.done <- true
 }
 
+func (o *LokiClient) NewEntry(dm dnsutils.DnsMessage) logproto.Entry {
+	entry := logproto.Entry{}
+	entry.Timestamp = time.Unix(int64(dm.DnsTap.TimeSec), int64(dm.DnsTap.TimeNsec))
+	entry.Line = dm.String(o.textFormat)
+	return entry
+}
+
+func (o *LokiClient) AddEntry(dm dnsutils.DnsMessage) {
+	// prepare entry
+	entry := o.NewEntry(dm)
+	o.sizeentries += len(entry.Line)
+
+	// append entry to the stream
+	o.stream.Entries = append(o.stream.Entries, entry)
+
+	// keep the message until the entries are sent
+	if o.spool != nil {
+		o.pending = append(o.pending, dm)
+	}
+}
+
+// FlushEntries sends the entries not yet sent, on error they are written in the spool
+// if enabled, otherwise they are lost
+func (o *LokiClient) FlushEntries() {
+	if len(o.stream.Entries) == 0 {
+		return
+	}
+
+	buf, err := o.ProtoEncode()
+	if err == nil {
+		err = o.SendEntries(buf)
+	}
+	if err != nil {
+		o.LogError("error sending log entries - %v", err)
+		if o.spool != nil {
+			o.SpoolEntries()
+			return
+		}
+		dnsutils.Lost.Add(o.name, uint64(len(o.stream.Entries)))
+		o.LogError("%d messages lost", len(o.stream.Entries))
+	}
+	o.ResetEntries()
+}
+
+// SpoolEntries writes the messages not yet sent on disk and resets the entries
+func (o *LokiClient) SpoolEntries() {
+	if o.spool == nil {
+		return
+	}
+	for _, dm := range o.pending {
+		o.spool.Write(dm)
+	}
+	o.ResetEntries()
+}
+
+// ReplaySpool sends the spooled messages by batch, the replay is stopped on the first error
+func (o *LokiClient) ReplaySpool() error {
+	if o.spool == nil || o.spool.Empty() {
+		return nil
+	}
+
+	o.LogInfo("replaying spool...")
+	for !o.spool.Empty() {
+		dms, err := o.spool.Peek(512)
+		if err != nil {
+			return err
+		}
+		if len(dms) == 0 {
+			continue
+		}
+
+		stream := o.stream
+		o.stream = &logproto.Stream{Labels: stream.Labels}
+		for _, dm := range dms {
+			o.stream.Entries = append(o.stream.Entries, o.NewEntry(dm))
+		}
+
+		buf, err := o.ProtoEncode()
+		o.pushrequest.Reset()
+		o.stream = stream
+		if err != nil {
+			return err
+		}
+		if err := o.SendEntries(buf); err != nil {
+			return err
+		}
+		o.spool.Ack(len(dms))
+	}
+	o.LogInfo("replay terminated")
+	return nil
+}
+
+// Wait before the next attempt, the dns messages are spooled on disk in the meantime
+func (o *LokiClient) Wait() {
+	interval := time.Duration(o.config.Loggers.LokiClient.RetryInterval) * time.Second
+	if o.spool != nil {
+		o.spool.Hold(o.channel, interval)
+	} else {
+		time.Sleep(interval)
+	}
+}
+
 func (o *LokiClient) ProtoEncode() ([]byte, error) {
 	o.pushrequest.Streams = append(o.pushrequest.Streams, *o.stream)
 
@@ -219,6 +371,7 @@ func (o *LokiClient) ProtoEncode() ([]byte, error) {
 
 func (o *LokiClient) ResetEntries() {
 	o.stream.Entries = nil
+	o.pending = nil
 	o.sizeentries = 0
 	o.pushrequest.Reset()
 }
@@ -245,10 +398,15 @@ func (o *LokiClient) SendEntries(buf []byte) error {
 	// send post and read response
 	resp, err := o.httpclient.Do(post)
 	if err != nil {
+		dnsutils.Telemetry.Get(dnsutils.MetricSendErrors, o.name).Inc()
+		o.SetReady(false)
 		return err
 	}
 
+	// the remote is reachable, even if the entries are refused
+	o.SetReady(true)
 	if resp.StatusCode/100 != 2 {
+		dnsutils.Telemetry.Get(dnsutils.MetricSendErrors, o.name).Inc()
 		scanner := bufio.NewScanner(io.LimitReader(resp.Body, 1024))
 		line := ""
 		if scanner.Scan() {
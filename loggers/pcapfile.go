@@ -32,6 +32,7 @@ type PcapWriter struct {
 	channel        chan dnsutils.DnsMessage
 	config         *dnsutils.Config
 	logger         *logger.Logger
+	name           string
 	pcapw          *pcapgo.Writer
 	fd             *os.File
 	size           int64
@@ -42,12 +43,13 @@ type PcapWriter struct {
 	commpressTimer *time.Timer
 }
 
-func NewPcapFile(config *dnsutils.Config, console *logger.Logger) *PcapWriter {
+func NewPcapFile(config *dnsutils.Config, console *logger.Logger, name string) *PcapWriter {
 	console.Info("logger to pcap file - enabled")
 	o := &PcapWriter{
 		done:    make(chan bool),
 		channel: make(chan dnsutils.DnsMessage, 512),
 		logger:  console,
+		name:    name,
 		config:  config,
 	}
 	o.ReadConfig()
@@ -78,6 +80,13 @@ func (o *PcapWriter) Channel() chan dnsutils.DnsMessage {
 	return o.channel
 }
 
+// Release closes the file after a failure of run
+func (o *PcapWriter) Release() {
+	if o.fd != nil {
+		o.fd.Close()
+	}
+}
+
 func (o *PcapWriter) Stop() {
 	o.LogInfo("stopping...")
 
@@ -85,12 +94,12 @@ func (o *PcapWriter) Stop() {
 	o.LogInfo("closing channel")
 	close(o.channel)
 
-	// closing file
-	o.fd.Close()
-
 	// read done channel and block until run is terminated
 	<-o.done
 	close(o.done)
+
+	// closing file when all packets are written
+	o.fd.Close()
 }
 
 func (o *PcapWriter) GetIpPort(dm *dnsutils.DnsMessage) (string, int, string, int) {
@@ -18,14 +18,75 @@ type TopMaps struct {
 	rcodes *topmap.TopMap
 }
 
+// DroppedCollector exports the number of messages dropped by the queue of each logger
+type DroppedCollector struct {
+	desc *prometheus.Desc
+}
+
+func NewDroppedCollector(prefix string) *DroppedCollector {
+	return &DroppedCollector{
+		desc: prometheus.NewDesc(
+			fmt.Sprintf("%s_fanout_dropped_total", prefix),
+			"The total number of messages dropped by the queue of the logger",
+			[]string{"logger"}, nil,
+		),
+	}
+}
+
+func (c *DroppedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *DroppedCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, name := range dnsutils.Dropped.Names() {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, float64(dnsutils.Dropped.Get(name)), name)
+	}
+}
+
+// TelemetryCollector exports the internal metrics of the collectors, subprocessors and loggers
+type TelemetryCollector struct {
+	descs map[*dnsutils.TelemetryMetric]*prometheus.Desc
+}
+
+func NewTelemetryCollector(prefix string) *TelemetryCollector {
+	c := &TelemetryCollector{descs: make(map[*dnsutils.TelemetryMetric]*prometheus.Desc)}
+	for _, metric := range dnsutils.TelemetryMetrics {
+		c.descs[metric] = prometheus.NewDesc(
+			fmt.Sprintf("%s_%s", prefix, metric.Name),
+			metric.Help,
+			metric.Labels, nil,
+		)
+	}
+	return c
+}
+
+func (c *TelemetryCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+func (c *TelemetryCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range dnsutils.TelemetryMetrics {
+		valueType := prometheus.CounterValue
+		if metric.Gauge {
+			valueType = prometheus.GaugeValue
+		}
+		for _, v := range dnsutils.Telemetry.Values(metric) {
+			ch <- prometheus.MustNewConstMetric(c.descs[metric], valueType, float64(v.Get()), v.Labels()...)
+		}
+	}
+}
+
 type Prometheus struct {
 	done         chan bool
-	done_api     chan bool
+	done_api     chan error
 	httpserver   net.Listener
 	httpmux      *http.ServeMux
 	channel      chan dnsutils.DnsMessage
 	config       *dnsutils.Config
 	logger       *logger.Logger
+	name         string
 	promRegistry *prometheus.Registry
 	ver          string
 
@@ -36,14 +97,15 @@ type Prometheus struct {
 	metricsTop map[string]*TopMaps
 }
 
-func NewPrometheus(config *dnsutils.Config, logger *logger.Logger, version string) *Prometheus {
+func NewPrometheus(config *dnsutils.Config, logger *logger.Logger, version string, name string) *Prometheus {
 	logger.Info("prometheus - enabled")
 	o := &Prometheus{
 		done:         make(chan bool),
-		done_api:     make(chan bool),
+		done_api:     make(chan error, 1),
 		config:       config,
 		channel:      make(chan dnsutils.DnsMessage, 512),
 		logger:       logger,
+		name:         name,
 		ver:          version,
 		promRegistry: prometheus.NewRegistry(),
 
@@ -80,6 +142,9 @@ func (o *Prometheus) InitProm() {
 		[]string{"stream", "rcode"},
 	)
 	o.promRegistry.MustRegister(o.metricTotalRcodes)
+
+	o.promRegistry.MustRegister(NewDroppedCollector(o.config.Loggers.Prometheus.PromPrefix))
+	o.promRegistry.MustRegister(NewTelemetryCollector(o.config.Loggers.Prometheus.PromPrefix))
 }
 
 func (o *Prometheus) LogInfo(msg string, v ...interface{}) {
@@ -94,13 +159,17 @@ func (o *Prometheus) Channel() chan dnsutils.DnsMessage {
 	return o.channel
 }
 
+// Release stops the http server after a failure of run
+func (o *Prometheus) Release() {
+	if o.httpserver != nil {
+		o.httpserver.Close()
+	}
+}
+
 func (o *Prometheus) Stop() {
 	o.LogInfo("stopping...")
 
-	// stopping http server
-	o.httpserver.Close()
-
-	// close output channel
+	// close output channel, the http server is stopped by run
 	o.LogInfo("closing channel")
 	close(o.channel)
 
@@ -108,10 +177,6 @@ func (o *Prometheus) Stop() {
 	<-o.done
 	close(o.done)
 
-	// block and wait until http api is terminated
-	<-o.done_api
-	close(o.done_api)
-
 	o.LogInfo(" stopped")
 }
 
@@ -146,7 +211,7 @@ func (o *Prometheus) Record(dm dnsutils.DnsMessage) {
 	o.metricTotalRcodes.WithLabelValues(dm.DnsTap.Identity, dm.DNS.Rcode).Inc()
 }
 
-func (s *Prometheus) ListenAndServe() {
+func (s *Prometheus) Listen() error {
 	s.LogInfo("starting prometheus metrics...")
 
 	mux := http.NewServeMux()
@@ -161,7 +226,7 @@ func (s *Prometheus) ListenAndServe() {
 		var cer tls.Certificate
 		cer, err = tls.LoadX509KeyPair(s.config.Loggers.Prometheus.CertFile, s.config.Loggers.Prometheus.KeyFile)
 		if err != nil {
-			s.logger.Fatal("loading certificate failed:", err)
+			return err
 		}
 		config := &tls.Config{Certificates: []tls.Certificate{cer}}
 		listener, err = tls.Listen("tcp", addrlisten, config)
@@ -173,35 +238,55 @@ func (s *Prometheus) ListenAndServe() {
 
 	// something wrong ?
 	if err != nil {
-		s.logger.Fatal("listening failed:", err)
+		return err
 	}
 
 	s.httpserver = listener
 	s.httpmux = mux
 	s.LogInfo("is listening on %s", listener.Addr())
+	return nil
+}
 
-	http.Serve(s.httpserver, s.httpmux)
+// Serve serves the http api until the listener is closed, the error is reported to run
+func (s *Prometheus) Serve() {
+	err := dnsutils.RecoverError(func() error {
+		return http.Serve(s.httpserver, s.httpmux)
+	})
 	s.LogInfo("terminated")
-	s.done_api <- true
+	s.done_api <- err
 }
 
 func (s *Prometheus) Run() {
 	s.LogInfo("running in background...")
 
 	// start http server
-	go s.ListenAndServe()
+	if err := s.Listen(); err != nil {
+		panic(fmt.Sprintf("listening failed: %v", err))
+	}
+	go s.Serve()
 
 LOOP:
 	for {
-		dm, opened := <-s.channel
-		if !opened {
-			s.LogInfo("channel closed")
-			break LOOP
+		select {
+		case dm, opened := <-s.channel:
+			if !opened {
+				s.LogInfo("channel closed")
+				break LOOP
+			}
+			// record the dnstap message
+			s.Record(dm)
+
+		case err := <-s.done_api:
+			// the logger is restarted by the supervisor
+			s.httpserver.Close()
+			panic(fmt.Sprintf("http api failed: %v", err))
 		}
-		// record the dnstap message
-		s.Record(dm)
-
 	}
+
+	// stopping http server
+	s.httpserver.Close()
+	<-s.done_api
+
 	s.LogInfo("run terminated")
 
 	// the job is done
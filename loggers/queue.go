@@ -0,0 +1,243 @@
+package loggers
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-logger"
+)
+
+type queueUpdate struct {
+	worker dnsutils.Worker
+	detach bool
+	config *dnsutils.Config
+}
+
+// LoggerQueue buffers the dns messages sent by the collectors to a logger in a bounded queue,
+// a stalled logger does not block anymore the collectors and the other loggers
+type LoggerQueue struct {
+	// number of messages in the queue and maximum size read by the probes,
+	// first fields to be 64-bit aligned for atomic operations
+	length   int64
+	capacity int64
+	sync.RWMutex
+	done    chan bool
+	channel chan dnsutils.DnsMessage
+	update  chan queueUpdate
+	updated chan dnsutils.Worker
+	worker  dnsutils.Worker
+	name    string
+	size    int
+	policy  string
+	timeout time.Duration
+	expired bool
+	lost    int
+	dropped *dnsutils.DropCounters
+	depth   *dnsutils.TelemetryValue
+	config  *dnsutils.Config
+	logger  *logger.Logger
+}
+
+func NewLoggerQueue(name string, worker dnsutils.Worker, config *dnsutils.Config, console *logger.Logger) *LoggerQueue {
+	o := &LoggerQueue{
+		done:    make(chan bool),
+		channel: make(chan dnsutils.DnsMessage, 512),
+		update:  make(chan queueUpdate),
+		updated: make(chan dnsutils.Worker),
+		worker:  worker,
+		name:    name,
+		dropped: dnsutils.Dropped,
+		depth:   dnsutils.Telemetry.Get(dnsutils.MetricChannelLength, "loggers/"+name),
+		config:  config,
+		logger:  console,
+	}
+	o.ReadConfig()
+	o.dropped.Register(name)
+	return o
+}
+
+func (o *LoggerQueue) ReadConfig() {
+	o.size = o.config.FanOut.QueueSize
+	if o.size <= 0 {
+		o.size = 1
+	}
+
+	if !dnsutils.IsValidPolicy(o.config.FanOut.OverflowPolicy) {
+		o.LogError("invalid overflow policy %s, fallback to %s", o.config.FanOut.OverflowPolicy, dnsutils.PolicyDropNewest)
+		o.policy = dnsutils.PolicyDropNewest
+	} else {
+		o.policy = o.config.FanOut.OverflowPolicy
+	}
+
+	o.timeout = time.Duration(o.config.FanOut.DrainTimeout) * time.Second
+	atomic.StoreInt64(&o.capacity, int64(o.size))
+}
+
+func (o *LoggerQueue) LogInfo(msg string, v ...interface{}) {
+	o.logger.Info("logger queue "+o.name+" - "+msg, v...)
+}
+
+func (o *LoggerQueue) LogError(msg string, v ...interface{}) {
+	o.logger.Error("logger queue "+o.name+" - "+msg, v...)
+}
+
+func (o *LoggerQueue) Channel() chan dnsutils.DnsMessage {
+	return o.channel
+}
+
+// Usage returns the number of messages in the queue and the size of the queue
+func (o *LoggerQueue) Usage() (int, int) {
+	return int(atomic.LoadInt64(&o.length)), int(atomic.LoadInt64(&o.capacity))
+}
+
+// IsReady returns true if the logger is ready
+func (o *LoggerQueue) IsReady() bool {
+	o.RLock()
+	defer o.RUnlock()
+	return o.worker != nil && dnsutils.IsWorkerReady(o.worker)
+}
+
+// Lost returns the number of messages not sent to the logger before the drain timeout on stop
+func (o *LoggerQueue) Lost() int {
+	return o.lost
+}
+
+// Stop flushes the queue and waits until the logger has read all the messages of its channel,
+// the messages remaining after the drain timeout are lost. Then the logger is stopped.
+func (o *LoggerQueue) Stop() {
+	o.LogInfo("stopping...")
+	deadline := time.Now().Add(o.timeout)
+
+	// close input channel and wait until the queue is flushed
+	close(o.channel)
+	<-o.done
+	close(o.done)
+
+	// no logger if its replacement has failed on reload
+	if o.worker == nil {
+		o.LogError("no logger, %d messages lost", o.lost)
+		return
+	}
+
+	// wait until the logger is ready to be stopped
+	channel := o.worker.Channel()
+	for !o.expired && len(channel) > 0 {
+		if time.Now().After(deadline) {
+			o.expired = true
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if o.expired {
+		o.lost += drainChannel(channel, nil, nil)
+	}
+	if o.lost > 0 {
+		o.LogError("drain timeout exceeded, %d messages lost", o.lost)
+	}
+
+	// then stop the logger
+	o.worker.Stop()
+}
+
+// Reload applies the new fanout options and replaces the logger if the factory is not nil,
+// the queue and its channel are kept, the collectors don't need to be restarted. The current
+// logger is stopped before creating the new one, the messages are kept in the queue meanwhile.
+func (o *LoggerQueue) Reload(factory func() (dnsutils.Worker, error), config *dnsutils.Config) error {
+	if factory == nil {
+		o.update <- queueUpdate{config: config}
+		<-o.updated
+		return nil
+	}
+
+	o.update <- queueUpdate{detach: true, config: config}
+	old := <-o.updated
+
+	o.LogInfo("replacing logger...")
+	old.Stop()
+
+	worker, err := factory()
+	if err != nil {
+		return err
+	}
+	o.update <- queueUpdate{worker: worker}
+	<-o.updated
+	go worker.Run()
+	return nil
+}
+
+func (o *LoggerQueue) Run() {
+	o.LogInfo("running in background with a queue of %d messages, policy %s", o.size, o.policy)
+
+	go o.worker.Run()
+
+	queue := []dnsutils.DnsMessage{}
+	input := o.channel
+	var drain <-chan time.Time
+	for input != nil || len(queue) > 0 {
+		atomic.StoreInt64(&o.length, int64(len(queue)))
+		o.depth.Set(int64(len(queue)))
+
+		// nothing to send when the queue is empty or when the logger is being replaced
+		var output chan dnsutils.DnsMessage
+		var next dnsutils.DnsMessage
+		if len(queue) > 0 && o.worker != nil {
+			output = o.worker.Channel()
+			next = queue[0]
+		}
+
+		// the collectors are blocked when the queue is full
+		recv := input
+		if o.policy == dnsutils.PolicyBlock && len(queue) >= o.size {
+			recv = nil
+		}
+
+		select {
+		case dm, opened := <-recv:
+			if !opened {
+				// flush the queue before to terminate
+				input = nil
+				drain = time.After(o.timeout)
+				continue
+			}
+			if len(queue) >= o.size {
+				o.dropped.Inc(o.name)
+				if o.policy == dnsutils.PolicyDropNewest {
+					continue
+				}
+				queue = queue[1:]
+			}
+			queue = append(queue, dm)
+
+		case output <- next:
+			queue = queue[1:]
+
+		case <-drain:
+			// the logger is too slow, the remaining messages are lost
+			o.expired = true
+			o.lost += len(queue)
+			queue = nil
+
+		case u := <-o.update:
+			// detach the current logger, it is stopped by the caller
+			old := o.worker
+			if u.detach || u.worker != nil {
+				o.Lock()
+				o.worker = u.worker
+				o.Unlock()
+			}
+			if u.config != nil {
+				o.config = u.config
+				o.ReadConfig()
+			}
+			o.updated <- old
+		}
+	}
+	atomic.StoreInt64(&o.length, 0)
+	o.depth.Set(0)
+	o.LogInfo("run terminated")
+
+	// the job is done
+	o.done <- true
+}
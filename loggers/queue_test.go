@@ -0,0 +1,196 @@
+package loggers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-logger"
+)
+
+// stalledLogger never reads its channel
+type stalledLogger struct {
+	channel chan dnsutils.DnsMessage
+}
+
+func (o *stalledLogger) Stop()                             {}
+func (o *stalledLogger) Run()                              {}
+func (o *stalledLogger) Channel() chan dnsutils.DnsMessage { return o.channel }
+
+func runQueue(t *testing.T, name string, policy string, wantDropped uint64, wantQnames []string) {
+	config := dnsutils.GetFakeConfig()
+	config.FanOut.QueueSize = 2
+	config.FanOut.OverflowPolicy = policy
+
+	sl := &stalledLogger{channel: make(chan dnsutils.DnsMessage)}
+	o := NewLoggerQueue(name, sl, config, logger.New(false))
+	go o.Run()
+
+	for i := 0; i < 4; i++ {
+		dm := dnsutils.GetFakeDnsMessage()
+		dm.DNS.Qname = fmt.Sprintf("q%d", i)
+		o.Channel() <- dm
+	}
+
+	// wait until all messages are processed by the queue
+	for i := 0; i < 100 && dnsutils.Dropped.Get(name) < wantDropped; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, want := range wantQnames {
+		dm := <-sl.Channel()
+		if dm.DNS.Qname != want {
+			t.Errorf("want %s, got %s", want, dm.DNS.Qname)
+		}
+	}
+	o.Stop()
+
+	if dropped := dnsutils.Dropped.Get(name); dropped != wantDropped {
+		t.Errorf("want %d dropped messages, got %d", wantDropped, dropped)
+	}
+}
+
+func TestLoggerQueueDropNewest(t *testing.T) {
+	runQueue(t, "queue-newest", dnsutils.PolicyDropNewest, 2, []string{"q0", "q1"})
+}
+
+func TestLoggerQueueDropOldest(t *testing.T) {
+	runQueue(t, "queue-oldest", dnsutils.PolicyDropOldest, 2, []string{"q2", "q3"})
+}
+
+func TestLoggerQueueBlock(t *testing.T) {
+	runQueue(t, "queue-block", dnsutils.PolicyBlock, 0, []string{"q0", "q1", "q2", "q3"})
+}
+
+func TestLoggerQueueReload(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+
+	sl := &stalledLogger{channel: make(chan dnsutils.DnsMessage)}
+	o := NewLoggerQueue("queue-reload", sl, config, logger.New(false))
+	go o.Run()
+
+	dm := dnsutils.GetFakeDnsMessage()
+	o.Channel() <- dm
+	<-sl.Channel()
+
+	// the logger is replaced, the queue and its channel are kept
+	newsl := &stalledLogger{channel: make(chan dnsutils.DnsMessage)}
+	o.Reload(func() (dnsutils.Worker, error) { return newsl, nil }, config)
+
+	o.Channel() <- dm
+	<-newsl.Channel()
+	o.Stop()
+}
+
+// stoppedLogger records when it is stopped
+type stoppedLogger struct {
+	stalledLogger
+	stopped bool
+}
+
+func (o *stoppedLogger) Stop() { o.stopped = true }
+
+func TestLoggerQueueReloadStopFirst(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+
+	sl := &stoppedLogger{stalledLogger: stalledLogger{channel: make(chan dnsutils.DnsMessage)}}
+	o := NewLoggerQueue("queue-reload-stop", sl, config, logger.New(false))
+	go o.Run()
+
+	// the old logger must be stopped before the new one is created
+	newsl := &stalledLogger{channel: make(chan dnsutils.DnsMessage)}
+	err := o.Reload(func() (dnsutils.Worker, error) {
+		if !sl.stopped {
+			t.Errorf("old logger not stopped before creating the new one")
+		}
+		return newsl, nil
+	}, config)
+	if err != nil {
+		t.Fatalf("reload error: %v", err)
+	}
+
+	o.Channel() <- dnsutils.GetFakeDnsMessage()
+	<-newsl.Channel()
+	o.Stop()
+}
+
+func TestLoggerQueueReloadError(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+
+	sl := &stalledLogger{channel: make(chan dnsutils.DnsMessage)}
+	o := NewLoggerQueue("queue-reload-error", sl, config, logger.New(false))
+	go o.Run()
+
+	err := o.Reload(func() (dnsutils.Worker, error) { return nil, errors.New("failure") }, config)
+	if err == nil {
+		t.Errorf("reload error expected")
+	}
+	if o.IsReady() {
+		t.Errorf("queue without logger must not be ready")
+	}
+	o.Stop()
+}
+
+// slowLogger reads its channel until it is stopped
+type slowLogger struct {
+	channel  chan dnsutils.DnsMessage
+	done     chan bool
+	received int
+}
+
+func (o *slowLogger) Stop() {
+	close(o.channel)
+	<-o.done
+}
+
+func (o *slowLogger) Run() {
+	for range o.channel {
+		o.received++
+		time.Sleep(time.Millisecond)
+	}
+	o.done <- true
+}
+
+func (o *slowLogger) Channel() chan dnsutils.DnsMessage { return o.channel }
+
+func TestLoggerQueueDrain(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+
+	sl := &slowLogger{channel: make(chan dnsutils.DnsMessage, 8), done: make(chan bool)}
+	o := NewLoggerQueue("queue-drain", sl, config, logger.New(false))
+	go o.Run()
+
+	for i := 0; i < 50; i++ {
+		o.Channel() <- dnsutils.GetFakeDnsMessage()
+	}
+
+	// all messages are sent to the logger before to stop it
+	o.Stop()
+	if sl.received != 50 {
+		t.Errorf("want 50 messages received, got %d", sl.received)
+	}
+	if o.Lost() != 0 {
+		t.Errorf("want no lost messages, got %d", o.Lost())
+	}
+}
+
+func TestLoggerQueueDrainTimeout(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+	config.FanOut.DrainTimeout = 0
+
+	sl := &stalledLogger{channel: make(chan dnsutils.DnsMessage, 1)}
+	o := NewLoggerQueue("queue-drain-timeout", sl, config, logger.New(false))
+	go o.Run()
+
+	for i := 0; i < 3; i++ {
+		o.Channel() <- dnsutils.GetFakeDnsMessage()
+	}
+
+	// the logger is stalled, the messages in the queue and in its channel are lost
+	o.Stop()
+	if o.Lost() != 3 {
+		t.Errorf("want 3 lost messages, got %d", o.Lost())
+	}
+}
@@ -0,0 +1,83 @@
+package loggers
+
+import (
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-logger"
+)
+
+// LoggerRouter forwards the dns messages of a collector to its loggers, the list of loggers
+// can be updated when the configuration is reloaded without restarting the collector
+type LoggerRouter struct {
+	done    chan bool
+	channel chan dnsutils.DnsMessage
+	update  chan []dnsutils.Worker
+	loggers []dnsutils.Worker
+	name    string
+	depth   *dnsutils.TelemetryValue
+	logger  *logger.Logger
+}
+
+func NewLoggerRouter(name string, loggers []dnsutils.Worker, console *logger.Logger) *LoggerRouter {
+	o := &LoggerRouter{
+		done:    make(chan bool),
+		channel: make(chan dnsutils.DnsMessage, 512),
+		update:  make(chan []dnsutils.Worker),
+		loggers: loggers,
+		name:    name,
+		depth:   dnsutils.Telemetry.Get(dnsutils.MetricChannelLength, "collectors/"+name),
+		logger:  console,
+	}
+	return o
+}
+
+func (o *LoggerRouter) LogInfo(msg string, v ...interface{}) {
+	o.logger.Info("logger router "+o.name+" - "+msg, v...)
+}
+
+func (o *LoggerRouter) LogError(msg string, v ...interface{}) {
+	o.logger.Error("logger router "+o.name+" - "+msg, v...)
+}
+
+func (o *LoggerRouter) Channel() chan dnsutils.DnsMessage {
+	return o.channel
+}
+
+// SetLoggers replaces the loggers, the next dns messages are forwarded to the new ones
+func (o *LoggerRouter) SetLoggers(loggers []dnsutils.Worker) {
+	o.update <- loggers
+}
+
+func (o *LoggerRouter) Stop() {
+	o.LogInfo("stopping...")
+
+	// close input channel and wait until all messages are forwarded
+	close(o.channel)
+	<-o.done
+	close(o.done)
+}
+
+func (o *LoggerRouter) Run() {
+	o.LogInfo("running in background...")
+
+	input := o.channel
+	for input != nil {
+		select {
+		case dm, opened := <-input:
+			if !opened {
+				input = nil
+				continue
+			}
+			o.depth.Set(int64(len(input)))
+			for _, w := range o.loggers {
+				w.Channel() <- dm
+			}
+		case loggers := <-o.update:
+			o.loggers = loggers
+		}
+	}
+	o.depth.Set(0)
+	o.LogInfo("run terminated")
+
+	// the job is done
+	o.done <- true
+}
@@ -0,0 +1,373 @@
+package loggers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-logger"
+)
+
+const (
+	spoolExt        = ".spool"
+	spoolOffsetFile = "offset"
+	// a record is the length of the body (4 bytes) followed by the body,
+	// the body is the spool time in unix nanoseconds (8 bytes) and the gob encoded message
+	spoolHeaderLen = 4
+	spoolTimeLen   = 8
+)
+
+type spoolSegment struct {
+	id   uint64
+	size int64
+}
+
+// Spool is a write-ahead log on disk used by the network loggers to keep the dns messages
+// while the remote destination is unreachable, the messages are replayed in the same
+// order on reconnect. The spool is not safe for concurrent use, it must be used only
+// from the Run loop of the logger.
+type Spool struct {
+	name     string
+	dir      string
+	maxSize  int64
+	maxAge   time.Duration
+	segSize  int64
+	segments []spoolSegment
+	wfile    *os.File
+	offset   int64
+	peeked   []int64
+	size     int64
+	evicted  int
+	logger   *logger.Logger
+}
+
+// NewSpool opens the spool located in the directory of the config, the messages
+// already present in the directory are kept and will be replayed first
+func NewSpool(name string, config dnsutils.SpoolConfig, console *logger.Logger) (*Spool, error) {
+	s := &Spool{
+		name:    name,
+		dir:     config.Path,
+		maxSize: int64(config.MaxSize) * 1024 * 1024,
+		maxAge:  time.Duration(config.MaxAge) * time.Second,
+		logger:  console,
+	}
+
+	if len(s.dir) == 0 {
+		return nil, fmt.Errorf("spool path is missing")
+	}
+	if s.maxSize <= 0 {
+		return nil, fmt.Errorf("invalid spool max size %d", config.MaxSize)
+	}
+
+	// the spool is rotated in several segments, the oldest one is removed when the spool is full
+	s.segSize = s.maxSize / 4
+
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) LogInfo(msg string, v ...interface{}) {
+	s.logger.Info("spool "+s.name+" - "+msg, v...)
+}
+
+func (s *Spool) LogError(msg string, v ...interface{}) {
+	s.logger.Error("spool "+s.name+" - "+msg, v...)
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, spoolExt))
+}
+
+func (s *Spool) load() error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), spoolExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(f.Name(), spoolExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return err
+		}
+
+		// the whole segment is too old
+		if s.maxAge > 0 && time.Since(info.ModTime()) > s.maxAge {
+			s.LogInfo("segment %d expired, removed", id)
+			os.Remove(s.segmentPath(id))
+			continue
+		}
+		s.segments = append(s.segments, spoolSegment{id: id, size: info.Size()})
+		s.size += info.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].id < s.segments[j].id })
+
+	// restore the read position in the oldest segment
+	if len(s.segments) > 0 {
+		if b, err := os.ReadFile(filepath.Join(s.dir, spoolOffsetFile)); err == nil {
+			fields := strings.Fields(string(b))
+			if len(fields) == 2 {
+				id, _ := strconv.ParseUint(fields[0], 10, 64)
+				offset, _ := strconv.ParseInt(fields[1], 10, 64)
+				if id == s.segments[0].id && offset <= s.segments[0].size {
+					s.offset = offset
+				}
+			}
+		}
+		s.LogInfo("%d bytes to replay", s.size-s.offset)
+	}
+	return nil
+}
+
+// Empty returns true when there is no message to replay
+func (s *Spool) Empty() bool {
+	return len(s.segments) == 0
+}
+
+// Write appends the dns message at the end of the spool, the message is lost on error
+func (s *Spool) Write(dm dnsutils.DnsMessage) error {
+	err := s.write(dm)
+	if err != nil {
+		s.LogError("write error: %v", err)
+	}
+	return err
+}
+
+func (s *Spool) write(dm dnsutils.DnsMessage) error {
+	var body bytes.Buffer
+	binary.Write(&body, binary.BigEndian, time.Now().UnixNano())
+	if err := gob.NewEncoder(&body).Encode(dm); err != nil {
+		return err
+	}
+
+	// open a new segment if needed
+	last := len(s.segments) - 1
+	if s.wfile == nil || s.segments[last].size >= s.segSize {
+		if s.wfile != nil {
+			s.wfile.Close()
+		}
+		var id uint64
+		if last >= 0 {
+			id = s.segments[last].id + 1
+		}
+		f, err := os.OpenFile(s.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			s.wfile = nil
+			return err
+		}
+		s.wfile = f
+		s.segments = append(s.segments, spoolSegment{id: id})
+		last++
+	}
+
+	record := make([]byte, spoolHeaderLen, spoolHeaderLen+body.Len())
+	binary.BigEndian.PutUint32(record, uint32(body.Len()))
+	record = append(record, body.Bytes()...)
+	n, err := s.wfile.Write(record)
+	s.segments[last].size += int64(n)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	// spool is full, evict the oldest segment
+	for s.size > s.maxSize && len(s.segments) > 1 {
+		s.LogError("spool is full, oldest segment %d evicted", s.segments[0].id)
+		s.removeHead()
+	}
+	return nil
+}
+
+func (s *Spool) removeHead() {
+	head := s.segments[0]
+	if len(s.segments) == 1 && s.wfile != nil {
+		s.wfile.Close()
+		s.wfile = nil
+	}
+	os.Remove(s.segmentPath(head.id))
+	s.segments = s.segments[1:]
+	s.size -= head.size
+	s.offset = 0
+	s.peeked = nil
+}
+
+// Peek returns up to max of the oldest messages without removing them from the spool,
+// the messages older than the max age are evicted
+func (s *Spool) Peek(max int) ([]dnsutils.DnsMessage, error) {
+	dms := []dnsutils.DnsMessage{}
+	s.peeked = nil
+
+	for len(dms) < max && len(s.segments) > 0 {
+		head := s.segments[0]
+		if s.offset >= head.size {
+			// the segment is fully replayed
+			if len(s.peeked) > 0 {
+				break
+			}
+			s.removeHead()
+			continue
+		}
+
+		f, err := os.Open(s.segmentPath(head.id))
+		if err != nil {
+			return dms, err
+		}
+		if _, err := f.Seek(s.offset, io.SeekStart); err != nil {
+			f.Close()
+			return dms, err
+		}
+
+		pos := s.offset
+		for len(dms) < max && pos < head.size {
+			header := make([]byte, spoolHeaderLen)
+			if _, err := io.ReadFull(f, header); err != nil {
+				break
+			}
+			body := make([]byte, binary.BigEndian.Uint32(header))
+			if _, err := io.ReadFull(f, body); err != nil || len(body) < spoolTimeLen {
+				break
+			}
+			reclen := int64(spoolHeaderLen + len(body))
+			pos += reclen
+
+			// too old, removed directly
+			ts := time.Unix(0, int64(binary.BigEndian.Uint64(body[:spoolTimeLen])))
+			if s.maxAge > 0 && time.Since(ts) > s.maxAge {
+				s.evicted++
+				s.skip(reclen)
+				continue
+			}
+
+			var dm dnsutils.DnsMessage
+			if err := gob.NewDecoder(bytes.NewReader(body[spoolTimeLen:])).Decode(&dm); err != nil {
+				s.LogError("unable to decode message: %v", err)
+				s.skip(reclen)
+				continue
+			}
+			dms = append(dms, dm)
+			s.peeked = append(s.peeked, reclen)
+		}
+		f.Close()
+
+		// truncated record at the end of the segment, ignore it
+		if pos < head.size && len(dms) < max {
+			s.LogError("segment %d truncated, %d bytes ignored", head.id, head.size-pos)
+			s.size -= head.size - pos
+			s.segments[0].size = pos
+		}
+
+		if len(s.peeked) > 0 {
+			break
+		}
+	}
+
+	if s.evicted > 0 {
+		s.LogInfo("%d messages evicted, max age exceeded", s.evicted)
+		s.evicted = 0
+	}
+	return dms, nil
+}
+
+// skip ignores a record, it is removed with the previous peeked message
+func (s *Spool) skip(reclen int64) {
+	if len(s.peeked) == 0 {
+		s.offset += reclen
+	} else {
+		s.peeked[len(s.peeked)-1] += reclen
+	}
+}
+
+// Ack removes from the spool the n oldest messages returned by the last call to Peek
+func (s *Spool) Ack(n int) {
+	if n > len(s.peeked) {
+		n = len(s.peeked)
+	}
+	for _, reclen := range s.peeked[:n] {
+		s.offset += reclen
+	}
+	s.peeked = s.peeked[n:]
+
+	if len(s.segments) > 0 && s.offset >= s.segments[0].size && len(s.peeked) == 0 {
+		s.removeHead()
+	}
+}
+
+// Replay sends the spooled messages in order and removes them from the spool,
+// the replay is stopped on the first error
+func (s *Spool) Replay(send func(dm dnsutils.DnsMessage) error) error {
+	if s.Empty() {
+		return nil
+	}
+	s.LogInfo("replaying...")
+	for !s.Empty() {
+		dms, err := s.Peek(1)
+		if err != nil {
+			return err
+		}
+		for _, dm := range dms {
+			if err := send(dm); err != nil {
+				return err
+			}
+			s.Ack(1)
+		}
+	}
+	s.LogInfo("replay terminated")
+	return nil
+}
+
+// Hold writes the messages received on the channel in the spool during the duration,
+// it replaces the sleep between two connection attempts and returns as soon as the
+// channel is closed
+func (s *Spool) Hold(channel chan dnsutils.DnsMessage, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	for {
+		select {
+		case dm, opened := <-channel:
+			if !opened {
+				return
+			}
+			s.Write(dm)
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+// Close saves the read position, the remaining messages will be replayed on the next start
+func (s *Spool) Close() {
+	if s.wfile != nil {
+		s.wfile.Close()
+		s.wfile = nil
+	}
+
+	path := filepath.Join(s.dir, spoolOffsetFile)
+	if len(s.segments) == 0 {
+		os.Remove(path)
+		return
+	}
+	data := fmt.Sprintf("%d %d\n", s.segments[0].id, s.offset)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		s.LogError("unable to save offset: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package loggers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-logger"
+)
+
+func writeSpool(t *testing.T, s *Spool, first int, last int) {
+	for i := first; i < last; i++ {
+		dm := dnsutils.GetFakeDnsMessage()
+		dm.DNS.Qname = fmt.Sprintf("q%d", i)
+		if err := s.Write(dm); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	config := dnsutils.SpoolConfig{Enable: true, Path: t.TempDir(), MaxSize: 1, MaxAge: 60}
+
+	s, err := NewSpool("test", config, logger.New(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSpool(t, s, 0, 4)
+
+	// the replay stops on the first error, the message is kept
+	qnames := []string{}
+	err = s.Replay(func(dm dnsutils.DnsMessage) error {
+		if len(qnames) == 2 {
+			return errors.New("remote down")
+		}
+		qnames = append(qnames, dm.DNS.Qname)
+		return nil
+	})
+	if err == nil {
+		t.Errorf("replay error expected")
+	}
+
+	// messages are kept on disk and replayed in order after a restart
+	writeSpool(t, s, 4, 5)
+	s.Close()
+	s, err = NewSpool("test", config, logger.New(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Replay(func(dm dnsutils.DnsMessage) error {
+		qnames = append(qnames, dm.DNS.Qname)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(qnames) != "[q0 q1 q2 q3 q4]" {
+		t.Errorf("invalid replay order: %v", qnames)
+	}
+	if !s.Empty() {
+		t.Errorf("spool must be empty after replay")
+	}
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	config := dnsutils.SpoolConfig{Enable: true, Path: t.TempDir(), MaxSize: 1, MaxAge: 0}
+
+	s, err := NewSpool("test", config, logger.New(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// write more than 1MB, the oldest segments are evicted
+	writeSpool(t, s, 0, 10000)
+	if s.size > s.maxSize {
+		t.Errorf("spool size %d exceeds the max size %d", s.size, s.maxSize)
+	}
+
+	dms, err := s.Peek(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dms) != 1 || dms[0].DNS.Qname == "q0" {
+		t.Errorf("oldest messages must be evicted")
+	}
+}
+
+func TestSpoolHoldClosed(t *testing.T) {
+	config := dnsutils.SpoolConfig{Enable: true, Path: t.TempDir(), MaxSize: 1, MaxAge: 60}
+
+	s, err := NewSpool("test", config, logger.New(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	channel := make(chan dnsutils.DnsMessage, 2)
+	channel <- dnsutils.GetFakeDnsMessage()
+	channel <- dnsutils.GetFakeDnsMessage()
+	close(channel)
+
+	// the messages are spooled and the retry interval is not waited
+	start := time.Now()
+	s.Hold(channel, time.Hour)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hold should return once the channel is closed, returned after %s", elapsed)
+	}
+
+	dms, err := s.Peek(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dms) != 2 {
+		t.Errorf("want 2 spooled messages, got %d", len(dms))
+	}
+}
@@ -18,12 +18,13 @@ type StatsdClient struct {
 	channel chan dnsutils.DnsMessage
 	config  *dnsutils.Config
 	logger  *logger.Logger
+	name    string
 	stats   *subprocessors.StatsStreams
 	exit    chan bool
 	version string
 }
 
-func NewStatsdClient(config *dnsutils.Config, logger *logger.Logger, version string) *StatsdClient {
+func NewStatsdClient(config *dnsutils.Config, logger *logger.Logger, version string, name string) *StatsdClient {
 	logger.Info("logger to statsd - enabled")
 
 	s := &StatsdClient{
@@ -31,6 +32,7 @@ func NewStatsdClient(config *dnsutils.Config, logger *logger.Logger, version str
 		exit:    make(chan bool),
 		channel: make(chan dnsutils.DnsMessage, 512),
 		logger:  logger,
+		name:    name,
 		config:  config,
 		version: version,
 	}
@@ -120,6 +122,7 @@ LOOP:
 
 			// something is wrong during connection ?
 			if err != nil {
+				dnsutils.Telemetry.Get(dnsutils.MetricSendErrors, o.name).Inc()
 				o.LogError("dial error: %s", err)
 			}
 
@@ -140,6 +143,7 @@ LOOP:
 					topRrtypes := o.stats.GetTopRrtypes(stream)
 					topTransports := o.stats.GetTopTransports(stream)
 					topIpProto := o.stats.GetTopIpProto(stream)
+					topEdnsOptions := o.stats.GetTopEdnsOptions(stream)
 
 					b.WriteString(fmt.Sprintf("%s_%s_total_bytes_received:%d|c\n", prefix, stream, counters.ReceivedBytesTotal))
 					b.WriteString(fmt.Sprintf("%s_%s_total_bytes_sent:%d|c\n", prefix, stream, counters.SentBytesTotal))
@@ -161,6 +165,11 @@ LOOP:
 						b.WriteString(fmt.Sprintf("%s_%s_total_packets_%s:%d|c\n", prefix, stream, v.Name, v.Hit))
 					}
 
+					// edns options repartition
+					for _, v := range topEdnsOptions {
+						b.WriteString(fmt.Sprintf("%s_%s_total_edns_option_%s:%d|c\n", prefix, stream, v.Name, v.Hit))
+					}
+
 					// qtypes repartition
 					for _, v := range topRrtypes {
 						b.WriteString(fmt.Sprintf("%s_%s_total_replies_rrtype_%s:%d|c\n", prefix, stream, v.Name, v.Hit))
@@ -177,6 +186,7 @@ LOOP:
 				// send data
 				err = b.Flush()
 				if err != nil {
+					dnsutils.Telemetry.Get(dnsutils.MetricSendErrors, o.name).Inc()
 					o.LogError("sent data error:", err.Error())
 				}
 			}
@@ -18,15 +18,17 @@ type StdOut struct {
 	textFormat []string
 	config     *dnsutils.Config
 	logger     *logger.Logger
+	name       string
 	stdout     *log.Logger
 }
 
-func NewStdOut(config *dnsutils.Config, console *logger.Logger) *StdOut {
+func NewStdOut(config *dnsutils.Config, console *logger.Logger, name string) *StdOut {
 	console.Info("logger to stdout - enabled")
 	o := &StdOut{
 		done:    make(chan bool),
 		channel: make(chan dnsutils.DnsMessage, 512),
 		logger:  console,
+		name:    name,
 		config:  config,
 		stdout:  log.New(os.Stdout, "", 0),
 	}
@@ -79,6 +81,9 @@ func (o *StdOut) Run() {
 		case "text":
 			o.stdout.Print(dm.String(o.textFormat))
 		case "json":
+			if o.config.Loggers.Stdout.RdataFields {
+				dm = dm.WithRdataFields()
+			}
 			json.NewEncoder(buffer).Encode(dm)
 			fmt.Print(buffer.String())
 			buffer.Reset()
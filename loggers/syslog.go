@@ -51,22 +51,25 @@ func GetPriority(facility string) (syslog.Priority, error) {
 }
 
 type Syslog struct {
+	dnsutils.ReadyState
 	done       chan bool
 	channel    chan dnsutils.DnsMessage
 	config     *dnsutils.Config
 	logger     *logger.Logger
+	name       string
 	severity   syslog.Priority
 	facility   syslog.Priority
 	syslogConn *syslog.Writer
 	textFormat []string
 }
 
-func NewSyslog(config *dnsutils.Config, console *logger.Logger) *Syslog {
+func NewSyslog(config *dnsutils.Config, console *logger.Logger, name string) *Syslog {
 	console.Info("logger syslog - enabled")
 	o := &Syslog{
 		done:    make(chan bool),
 		channel: make(chan dnsutils.DnsMessage, 512),
 		logger:  console,
+		name:    name,
 		config:  config,
 	}
 	o.ReadConfig()
@@ -108,6 +111,13 @@ func (c *Syslog) LogError(msg string, v ...interface{}) {
 	c.logger.Error("logger to syslog - "+msg, v...)
 }
 
+// Release closes the connection to the syslog daemon after a failure of run
+func (o *Syslog) Release() {
+	if o.syslogConn != nil {
+		o.syslogConn.Close()
+	}
+}
+
 func (o *Syslog) Stop() {
 	o.LogInfo("stopping...")
 
@@ -115,13 +125,13 @@ func (o *Syslog) Stop() {
 	o.LogInfo("closing channel")
 	close(o.channel)
 
-	// close connection
-	o.LogInfo("closing connection")
-	o.syslogConn.Close()
-
 	// read done channel and block until run is terminated
 	<-o.done
 	close(o.done)
+
+	// close connection when all messages are sent
+	o.LogInfo("closing connection")
+	o.syslogConn.Close()
 }
 
 func (o *Syslog) Run() {
@@ -134,7 +144,7 @@ func (o *Syslog) Run() {
 	if o.config.Loggers.Syslog.Transport == "local" {
 		syslogconn, err = syslog.New(o.facility|o.severity, "")
 		if err != nil {
-			o.logger.Fatal("failed to connect to the local syslog daemon:", err)
+			panic(fmt.Sprintf("failed to connect to the local syslog daemon: %v", err))
 		}
 	} else {
 		if o.config.Loggers.Syslog.TlsSupport {
@@ -143,29 +153,38 @@ func (o *Syslog) Run() {
 			}
 			syslogconn, err = syslog.DialWithTLSConfig(o.config.Loggers.Syslog.Transport, o.config.Loggers.Syslog.RemoteAddress, o.facility|o.severity, "", tlsconf)
 			if err != nil {
-				o.logger.Fatal("failed to connect to the remote tls syslog:", err)
+				panic(fmt.Sprintf("failed to connect to the remote tls syslog: %v", err))
 			}
 		} else {
 			syslogconn, err = syslog.Dial(o.config.Loggers.Syslog.Transport, o.config.Loggers.Syslog.RemoteAddress, o.facility|o.severity, "")
 			if err != nil {
-				o.logger.Fatal("failed to connect to the remote syslog:", err)
+				panic(fmt.Sprintf("failed to connect to the remote syslog: %v", err))
 			}
 		}
 	}
 	o.syslogConn = syslogconn
+	o.SetReady(true)
 
+	sendErrors := dnsutils.Telemetry.Get(dnsutils.MetricSendErrors, o.name)
 	for dm := range o.channel {
 		switch o.config.Loggers.Syslog.Mode {
 		case "text":
 			delimiter := "\n"
-			o.syslogConn.Write(dm.Bytes(o.textFormat, delimiter))
+			_, err = o.syslogConn.Write(dm.Bytes(o.textFormat, delimiter))
 		case "json":
+			if o.config.Loggers.Syslog.RdataFields {
+				dm = dm.WithRdataFields()
+			}
 			json.NewEncoder(buffer).Encode(dm)
-			o.syslogConn.Write(buffer.Bytes())
+			_, err = o.syslogConn.Write(buffer.Bytes())
 			buffer.Reset()
 		}
+		if err != nil {
+			sendErrors.Inc()
+		}
 	}
 
+	o.SetReady(false)
 	o.LogInfo("run terminated")
 	// the job is done
 	o.done <- true
@@ -14,22 +14,26 @@ import (
 )
 
 type TcpClient struct {
+	dnsutils.ReadyState
 	done       chan bool
 	channel    chan dnsutils.DnsMessage
 	config     *dnsutils.Config
 	logger     *logger.Logger
+	name       string
 	exit       chan bool
 	conn       net.Conn
 	textFormat []string
+	spool      *Spool
 }
 
-func NewTcpClient(config *dnsutils.Config, logger *logger.Logger) *TcpClient {
+func NewTcpClient(config *dnsutils.Config, logger *logger.Logger, name string) *TcpClient {
 	logger.Info("logger to tcp client - enabled")
 	s := &TcpClient{
 		done:    make(chan bool),
 		exit:    make(chan bool),
 		channel: make(chan dnsutils.DnsMessage, 512),
 		logger:  logger,
+		name:    name,
 		config:  config,
 	}
 
@@ -44,6 +48,15 @@ func (o *TcpClient) ReadConfig() {
 	} else {
 		o.textFormat = strings.Fields(o.config.Subprocessors.TextFormat)
 	}
+
+	if o.config.Loggers.TcpClient.Spool.Enable {
+		spool, err := NewSpool("tcpclient", o.config.Loggers.TcpClient.Spool, o.logger)
+		if err != nil {
+			o.LogError("spool disabled: %v", err)
+		} else {
+			o.spool = spool
+		}
+	}
 }
 
 func (o *TcpClient) LogInfo(msg string, v ...interface{}) {
@@ -58,6 +71,16 @@ func (o *TcpClient) Channel() chan dnsutils.DnsMessage {
 	return o.channel
 }
 
+// Release closes the connection and the spool after a failure of run
+func (o *TcpClient) Release() {
+	if o.conn != nil {
+		o.conn.Close()
+	}
+	if o.spool != nil {
+		o.spool.Close()
+	}
+}
+
 func (o *TcpClient) Stop() {
 	o.LogInfo("stopping...")
 
@@ -69,9 +92,39 @@ func (o *TcpClient) Stop() {
 	close(o.done)
 }
 
+func (o *TcpClient) Send(w *bufio.Writer, dm dnsutils.DnsMessage) error {
+	if o.config.Loggers.TcpClient.Mode == "text" {
+		w.Write(dm.Bytes(o.textFormat, o.config.Loggers.TcpClient.Delimiter))
+	}
+
+	if o.config.Loggers.TcpClient.Mode == "json" {
+		if o.config.Loggers.TcpClient.RdataFields {
+			dm = dm.WithRdataFields()
+		}
+		json.NewEncoder(w).Encode(dm)
+		w.WriteString(o.config.Loggers.TcpClient.Delimiter)
+	}
+
+	// flusth the buffer
+	return w.Flush()
+}
+
+// Wait before the next connection attempt, the dns messages are spooled on disk in the meantime
+func (o *TcpClient) Wait() {
+	interval := time.Duration(o.config.Loggers.TcpClient.RetryInterval) * time.Second
+	if o.spool != nil {
+		o.spool.Hold(o.channel, interval)
+	} else {
+		time.Sleep(interval)
+	}
+}
+
 func (o *TcpClient) Run() {
 	o.LogInfo("running in background...")
 
+	reconnects := dnsutils.Telemetry.Get(dnsutils.MetricReconnects, o.name)
+	attempts := 0
+
 LOOP:
 	for {
 	LOOP_RECONNECT:
@@ -88,7 +141,12 @@ LOOP:
 					address = o.config.Loggers.TcpClient.RemoteAddress + ":" + strconv.Itoa(o.config.Loggers.TcpClient.RemotePort)
 				}
 
-				// make the connection
+				// make the connection, the next attempts are reconnections
+				if attempts > 0 {
+					reconnects.Inc()
+				}
+				attempts++
+				o.SetReady(false)
 				o.LogInfo("connecting to %s", address)
 				var conn net.Conn
 				var err error
@@ -109,44 +167,62 @@ LOOP:
 				// loop
 				if conn != nil {
 					o.LogInfo("connected")
+					o.SetReady(true)
 					o.conn = conn
 					w := bufio.NewWriter(conn)
+
+					// replay messages spooled during the outage
+					if o.spool != nil {
+						if err := o.spool.Replay(func(dm dnsutils.DnsMessage) error { return o.Send(w, dm) }); err != nil {
+							o.LogError("replay error: %s", err)
+							break LOOP_RECONNECT
+						}
+					}
+
 					for {
 						select {
 						case dm := <-o.channel:
-
-							if o.config.Loggers.TcpClient.Mode == "text" {
-								w.Write(dm.Bytes(o.textFormat, o.config.Loggers.TcpClient.Delimiter))
-							}
-
-							if o.config.Loggers.TcpClient.Mode == "json" {
-								json.NewEncoder(w).Encode(dm)
-								w.WriteString(o.config.Loggers.TcpClient.Delimiter)
-							}
-
-							// flusth the buffer
-							err = w.Flush()
+							err = o.Send(w, dm)
 							if err != nil {
+								dnsutils.Telemetry.Get(dnsutils.MetricSendErrors, o.name).Inc()
 								o.LogError("connection error:", err.Error())
+								if o.spool == nil || o.spool.Write(dm) != nil {
+									dnsutils.Lost.Add(o.name, 1)
+								}
 								break LOOP_RECONNECT
 							}
 						case <-o.exit:
 							o.logger.Info("closing loop...")
+							// send the messages still in the channel before to close the connection
+							if lost := drainChannel(o.channel, o.spool, func(dm dnsutils.DnsMessage) error { return o.Send(w, dm) }); lost > 0 {
+								dnsutils.Lost.Add(o.name, uint64(lost))
+								o.LogError("%d messages lost", lost)
+							}
 							break LOOP
 						}
 					}
 
 				}
 				o.LogInfo("retry to connect in %d seconds", o.config.Loggers.TcpClient.RetryInterval)
-				time.Sleep(time.Duration(o.config.Loggers.TcpClient.RetryInterval) * time.Second)
+				o.Wait()
 			}
 		}
 	}
 
+	// the remaining messages are spooled if the remote is unreachable
+	if lost := drainChannel(o.channel, o.spool, nil); lost > 0 {
+		dnsutils.Lost.Add(o.name, uint64(lost))
+		o.LogError("%d messages lost", lost)
+	}
+
 	if o.conn != nil {
 		o.LogInfo("closing tcp connection")
 		o.conn.Close()
 	}
+	if o.spool != nil {
+		o.spool.Close()
+	}
+	o.SetReady(false)
 	o.LogInfo("run terminated")
 	o.done <- true
 }
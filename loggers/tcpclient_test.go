@@ -12,7 +12,7 @@ import (
 
 func TestTcpClientJsonRun(t *testing.T) {
 	// init logger
-	g := NewTcpClient(dnsutils.GetFakeConfig(), logger.New(false))
+	g := NewTcpClient(dnsutils.GetFakeConfig(), logger.New(false), "tcpclient")
 
 	// fake json receiver
 	fakeRcvr, err := net.Listen("tcp", ":9999")
@@ -45,3 +45,27 @@ func TestTcpClientJsonRun(t *testing.T) {
 		t.Errorf("qname error want %s, got %s", dm.DNS.Qname, dmRcv.DNS.Qname)
 	}
 }
+
+func TestTcpClientLost(t *testing.T) {
+	// remote not listening
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := dnsutils.GetFakeConfig()
+	config.Loggers.TcpClient.RemotePort = l.Addr().(*net.TCPAddr).Port
+	config.Loggers.TcpClient.RetryInterval = 1
+	l.Close()
+
+	g := NewTcpClient(config, logger.New(false), "tcpclient-lost")
+	for i := 0; i < 3; i++ {
+		g.channel <- dnsutils.GetFakeDnsMessage()
+	}
+	go g.Run()
+
+	// without spool the messages not sent on stop are counted as lost
+	g.Stop()
+	if lost := dnsutils.Lost.Get("tcpclient-lost"); lost != 3 {
+		t.Errorf("want 3 lost messages, got %d", lost)
+	}
+}
@@ -0,0 +1,79 @@
+package loggers
+
+import (
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-dnscollector/subprocessors"
+	"github.com/dmachard/go-logger"
+)
+
+// LoggerTransforms applies a dedicated chain of transforms on the dns messages
+// received from the collectors before to forward them to the logger
+type LoggerTransforms struct {
+	done    chan bool
+	channel chan dnsutils.DnsMessage
+	worker  dnsutils.Worker
+	name    string
+	config  *dnsutils.Config
+	logger  *logger.Logger
+}
+
+func NewLoggerTransforms(name string, worker dnsutils.Worker, config *dnsutils.Config, console *logger.Logger) *LoggerTransforms {
+	o := &LoggerTransforms{
+		done:    make(chan bool),
+		channel: make(chan dnsutils.DnsMessage, 512),
+		worker:  worker,
+		name:    name,
+		config:  config,
+		logger:  console,
+	}
+	return o
+}
+
+func (o *LoggerTransforms) LogInfo(msg string, v ...interface{}) {
+	o.logger.Info("logger transforms "+o.name+" - "+msg, v...)
+}
+
+func (o *LoggerTransforms) LogError(msg string, v ...interface{}) {
+	o.logger.Error("logger transforms "+o.name+" - "+msg, v...)
+}
+
+func (o *LoggerTransforms) Channel() chan dnsutils.DnsMessage {
+	return o.channel
+}
+
+func (o *LoggerTransforms) IsReady() bool {
+	return dnsutils.IsWorkerReady(o.worker)
+}
+
+func (o *LoggerTransforms) Stop() {
+	o.LogInfo("stopping...")
+
+	// close input channel and wait until all messages are forwarded
+	close(o.channel)
+	<-o.done
+	close(o.done)
+
+	// then stop the logger
+	o.worker.Stop()
+}
+
+func (o *LoggerTransforms) Run() {
+	o.LogInfo("running in background...")
+
+	go o.worker.Run()
+
+	transforms := subprocessors.NewTransforms(o.config, o.logger)
+	for dm := range o.channel {
+		// apply all enabled transformers
+		if transforms.ProcessMessage(&dm) {
+			continue
+		}
+		o.worker.Channel() <- dm
+	}
+
+	transforms.Reset()
+	o.LogInfo("run terminated")
+
+	// the job is done
+	o.done <- true
+}
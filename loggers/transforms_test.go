@@ -0,0 +1,80 @@
+package loggers
+
+import (
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-logger"
+)
+
+func TestLoggerTransformsForward(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+	config.Subprocessors.UserPrivacy.AnonymizeIP = true
+	config.Subprocessors.QnameLowerCase = true
+	config.Subprocessors.Transforms = []string{"qname-lowercase", "anonymize-ip"}
+
+	fl := NewFakeLogger()
+	o := NewLoggerTransforms("fake", fl, config, logger.New(false))
+	go o.Run()
+
+	dm := dnsutils.GetFakeDnsMessage()
+	dm.DNS.Qname = "DNS.Collector"
+	dm.DNS.Questions = []dnsutils.DnsQuestion{{Qname: "DNS.Collector", Qtype: "A"}}
+	o.Channel() <- dm
+
+	dmOut := <-fl.Channel()
+	if dmOut.NetworkInfo.QueryIp != "1.2.0.0" {
+		t.Errorf("query ip should be anonymized: %s", dmOut.NetworkInfo.QueryIp)
+	}
+	if dmOut.DNS.Qname != "dns.collector" || dmOut.DNS.Questions[0].Qname != "dns.collector" {
+		t.Errorf("qname should be lowercased: %s %s", dmOut.DNS.Qname, dmOut.DNS.Questions[0].Qname)
+	}
+	// the original message is not updated, its questions are not shared with the copy
+	if dm.NetworkInfo.QueryIp != "1.2.3.4" {
+		t.Errorf("invalid original query ip: %s", dm.NetworkInfo.QueryIp)
+	}
+	if dm.DNS.Qname != "DNS.Collector" || dm.DNS.Questions[0].Qname != "DNS.Collector" {
+		t.Errorf("invalid original qname: %s %s", dm.DNS.Qname, dm.DNS.Questions[0].Qname)
+	}
+
+	o.Stop()
+}
+
+func TestLoggerTransformsDrop(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+	config.Subprocessors.Filtering.LogQueries = false
+	config.Subprocessors.Transforms = []string{"filtering"}
+
+	fl := NewFakeLogger()
+	o := NewLoggerTransforms("fake", fl, config, logger.New(false))
+	go o.Run()
+
+	dm := dnsutils.GetFakeDnsMessage()
+	o.Channel() <- dm
+	o.Stop()
+
+	if len(fl.Channel()) != 0 {
+		t.Errorf("dns query should be dropped")
+	}
+}
+
+func TestLoggerTransformsEmpty(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+	config.Subprocessors.Transforms = []string{}
+
+	fl := NewFakeLogger()
+	o := NewLoggerTransforms("fake", fl, config, logger.New(false))
+	go o.Run()
+
+	// only the transforms listed are applied
+	dm := dnsutils.GetFakeDnsMessage()
+	dm.DNS.Qname = "DNS.Collector"
+	o.Channel() <- dm
+
+	dmOut := <-fl.Channel()
+	if dmOut.DNS.Qname != "DNS.Collector" {
+		t.Errorf("qname should not be updated: %s", dmOut.DNS.Qname)
+	}
+
+	o.Stop()
+}
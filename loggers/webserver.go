@@ -4,9 +4,11 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
@@ -16,24 +18,26 @@ import (
 
 type Webserver struct {
 	done       chan bool
-	done_api   chan bool
+	done_api   chan error
 	httpserver net.Listener
 	httpmux    *http.ServeMux
 	channel    chan dnsutils.DnsMessage
 	config     *dnsutils.Config
 	logger     *logger.Logger
+	name       string
 	stats      *subprocessors.StatsStreams
 	ver        string
 }
 
-func NewWebserver(config *dnsutils.Config, logger *logger.Logger, version string) *Webserver {
+func NewWebserver(config *dnsutils.Config, logger *logger.Logger, version string, name string) *Webserver {
 	logger.Info("webserver - enabled")
 	o := &Webserver{
 		done:     make(chan bool),
-		done_api: make(chan bool),
+		done_api: make(chan error, 1),
 		config:   config,
 		channel:  make(chan dnsutils.DnsMessage, 512),
 		logger:   logger,
+		name:     name,
 		ver:      version,
 	}
 
@@ -54,13 +58,17 @@ func (o *Webserver) Channel() chan dnsutils.DnsMessage {
 	return o.channel
 }
 
+// Release stops the http server after a failure of run
+func (o *Webserver) Release() {
+	if o.httpserver != nil {
+		o.httpserver.Close()
+	}
+}
+
 func (o *Webserver) Stop() {
 	o.LogInfo("stopping...")
 
-	// stopping http server
-	o.httpserver.Close()
-
-	// close output channel
+	// close output channel, the http server is stopped by run
 	o.LogInfo("closing channel")
 	close(o.channel)
 
@@ -68,10 +76,6 @@ func (o *Webserver) Stop() {
 	<-o.done
 	close(o.done)
 
-	// block and wait until http api is terminated
-	<-o.done_api
-	close(o.done_api)
-
 	o.LogInfo(" stopped")
 }
 
@@ -112,11 +116,63 @@ func (s *Webserver) metricsHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
 		s.stats.GetMetrics(w, r)
+		s.GetDroppedMetrics(w)
+		s.GetTelemetryMetrics(w)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Webserver) healthHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.BasicAuth(w, r) {
+		http.Error(w, "Not authorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		t := map[string]dnsutils.WorkerHealth{}
+		for _, name := range dnsutils.Health.Names() {
+			t[name], _ = dnsutils.Health.Get(name)
+		}
+		json.NewEncoder(w).Encode(t)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
+func (s *Webserver) GetDroppedMetrics(w io.Writer) {
+	prefix := s.config.Subprocessors.Statistics.PromPrefix
+
+	fmt.Fprintf(w, "# HELP %s_fanout_dropped_total Number of messages dropped by the queue of the logger\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_fanout_dropped_total counter\n", prefix)
+	for _, name := range dnsutils.Dropped.Names() {
+		fmt.Fprintf(w, "%s_fanout_dropped_total{logger=\"%s\"} %d\n", prefix, name, dnsutils.Dropped.Get(name))
+	}
+}
+
+func (s *Webserver) GetTelemetryMetrics(w io.Writer) {
+	prefix := s.config.Subprocessors.Statistics.PromPrefix
+
+	for _, metric := range dnsutils.TelemetryMetrics {
+		metricType := "counter"
+		if metric.Gauge {
+			metricType = "gauge"
+		}
+		fmt.Fprintf(w, "# HELP %s_%s %s\n", prefix, metric.Name, metric.Help)
+		fmt.Fprintf(w, "# TYPE %s_%s %s\n", prefix, metric.Name, metricType)
+		for _, v := range dnsutils.Telemetry.Values(metric) {
+			labels := []string{}
+			for i, value := range v.Labels() {
+				labels = append(labels, fmt.Sprintf("%s=\"%s\"", metric.Labels[i], value))
+			}
+			fmt.Fprintf(w, "%s_%s{%s} %d\n", prefix, metric.Name, strings.Join(labels, ","), v.Get())
+		}
+	}
+}
+
 func (s *Webserver) dumpRequestersHandler(w http.ResponseWriter, r *http.Request) {
 	if !s.BasicAuth(w, r) {
 		http.Error(w, "Not authorized", http.StatusUnauthorized)
@@ -369,12 +425,13 @@ func (s *Webserver) topSuspiciousClientsHandler(w http.ResponseWriter, r *http.R
 	}
 }
 
-func (s *Webserver) ListenAndServe() {
+func (s *Webserver) Listen() error {
 	s.LogInfo("starting http api...")
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/metrics", s.metricsHandler)
 	mux.HandleFunc("/reset", s.resetHandler)
+	mux.HandleFunc("/health", s.healthHandler)
 
 	mux.HandleFunc("/top/requesters", s.topRequestersHandler)
 	mux.HandleFunc("/top/requesters/suspicious", s.topSuspiciousClientsHandler)
@@ -399,7 +456,7 @@ func (s *Webserver) ListenAndServe() {
 		var cer tls.Certificate
 		cer, err = tls.LoadX509KeyPair(s.config.Loggers.WebServer.CertFile, s.config.Loggers.WebServer.KeyFile)
 		if err != nil {
-			s.logger.Fatal("loading certificate failed:", err)
+			return err
 		}
 		config := &tls.Config{Certificates: []tls.Certificate{cer}}
 		listener, err = tls.Listen("tcp", addrlisten, config)
@@ -411,23 +468,32 @@ func (s *Webserver) ListenAndServe() {
 
 	// something wrong ?
 	if err != nil {
-		s.logger.Fatal("listening failed:", err)
+		return err
 	}
 
 	s.httpserver = listener
 	s.httpmux = mux
 	s.LogInfo("is listening on %s", listener.Addr())
+	return nil
+}
 
-	http.Serve(s.httpserver, s.httpmux)
+// Serve serves the http api until the listener is closed, the error is reported to run
+func (s *Webserver) Serve() {
+	err := dnsutils.RecoverError(func() error {
+		return http.Serve(s.httpserver, s.httpmux)
+	})
 	s.LogInfo("terminated")
-	s.done_api <- true
+	s.done_api <- err
 }
 
 func (s *Webserver) Run() {
 	s.LogInfo("running in background...")
 
 	// start http server
-	go s.ListenAndServe()
+	if err := s.Listen(); err != nil {
+		panic(fmt.Sprintf("listening failed: %v", err))
+	}
+	go s.Serve()
 
 	// init timer to compute qps
 	t1_interval := 1 * time.Second
@@ -451,9 +517,18 @@ LOOP:
 
 			// reset the timer
 			t1.Reset(t1_interval)
+
+		case err := <-s.done_api:
+			// the logger is restarted by the supervisor
+			s.httpserver.Close()
+			panic(fmt.Sprintf("http api failed: %v", err))
 		}
 	}
 
+	// stopping http server
+	s.httpserver.Close()
+	<-s.done_api
+
 	s.LogInfo("run terminated")
 
 	// the job is done
@@ -14,7 +14,7 @@ import (
 func TestWebServerBadBasicAuth(t *testing.T) {
 	// init the logger
 	config := dnsutils.GetFakeConfig()
-	g := NewWebserver(config, logger.New(false), "dev")
+	g := NewWebserver(config, logger.New(false), "dev", "webserver")
 
 	tt := []struct {
 		name       string
@@ -60,11 +60,21 @@ func TestWebServerBadBasicAuth(t *testing.T) {
 func TestWebServerGet(t *testing.T) {
 	// init the logger
 	config := dnsutils.GetFakeConfig()
-	g := NewWebserver(config, logger.New(false), "dev")
+	g := NewWebserver(config, logger.New(false), "dev", "webserver")
 
 	// record one dns message to simulate some incoming data
 	g.stats.Record(dnsutils.GetFakeDnsMessage())
 
+	// simulate one message dropped by the queue of a logger
+	dnsutils.Dropped.Register("webserver-test")
+	dnsutils.Dropped.Inc("webserver-test")
+
+	// simulate one send error of a logger
+	dnsutils.Telemetry.Get(dnsutils.MetricSendErrors, "webserver-test").Inc()
+
+	// simulate one supervised worker
+	dnsutils.Health.Set("loggers/webserver-test", dnsutils.WorkerHealth{State: dnsutils.WorkerRestarting, Restarts: 2})
+
 	tt := []struct {
 		name       string
 		uri        string
@@ -89,6 +99,30 @@ func TestWebServerGet(t *testing.T) {
 			want:       config.Subprocessors.Statistics.PromPrefix + `_requesters_total{stream="global"} 1`,
 			statusCode: http.StatusOK,
 		},
+		{
+			name:       "dropped messages",
+			uri:        "/metrics",
+			handler:    g.metricsHandler,
+			method:     http.MethodGet,
+			want:       config.Subprocessors.Statistics.PromPrefix + `_fanout_dropped_total{logger="webserver-test"} 1`,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "send errors",
+			uri:        "/metrics",
+			handler:    g.metricsHandler,
+			method:     http.MethodGet,
+			want:       config.Subprocessors.Statistics.PromPrefix + `_send_errors_total{logger="webserver-test"} 1`,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "health",
+			uri:        "/health",
+			handler:    g.healthHandler,
+			method:     http.MethodGet,
+			want:       `"loggers/webserver-test":{"state":"restarting","restarts":2}`,
+			statusCode: http.StatusOK,
+		},
 	}
 
 	for _, tc := range tt {
@@ -118,7 +152,7 @@ func TestWebServerGet(t *testing.T) {
 func TestWebServerBadMethod(t *testing.T) {
 	// init the logger
 	config := dnsutils.GetFakeConfig()
-	g := NewWebserver(config, logger.New(false), "dev")
+	g := NewWebserver(config, logger.New(false), "dev", "webserver")
 
 	// record one dns message to simulate some incoming data
 	g.stats.Record(dnsutils.GetFakeDnsMessage())
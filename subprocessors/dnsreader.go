@@ -19,10 +19,11 @@ func GetFakeDns() ([]byte, error) {
 }
 
 type DnsProcessor struct {
-	done     chan bool
-	recvFrom chan dnsutils.DnsMessage
-	logger   *logger.Logger
-	config   *dnsutils.Config
+	done      chan bool
+	recvFrom  chan dnsutils.DnsMessage
+	logger    *logger.Logger
+	config    *dnsutils.Config
+	malformed *dnsutils.TelemetryValue
 }
 
 func NewDnsProcessor(config *dnsutils.Config, logger *logger.Logger) DnsProcessor {
@@ -51,6 +52,11 @@ func (c *DnsProcessor) LogError(msg string, v ...interface{}) {
 	c.logger.Error("procesor dns - "+msg, v...)
 }
 
+// SetCollector identifies the collector in the internal metrics
+func (d *DnsProcessor) SetCollector(name string) {
+	d.malformed = dnsutils.Telemetry.Get(dnsutils.MetricMalformedPackets, name)
+}
+
 func (d *DnsProcessor) GetChannel() chan dnsutils.DnsMessage {
 	return d.recvFrom
 }
@@ -74,22 +80,9 @@ func (d *DnsProcessor) Run(sendTo []chan dnsutils.DnsMessage) {
 	// dns cache to compute latency between response and query
 	cache_ttl := NewCacheDnsProcessor(time.Duration(d.config.Subprocessors.Cache.QueryTimeout) * time.Second)
 
-	// geoip
-	geoip := NewDnsGeoIpProcessor(d.config, d.logger)
-	if err := geoip.Open(); err != nil {
-		d.LogError("geoip init failed: %v+", err)
-	}
-	if geoip.IsEnabled() {
-		d.LogInfo("geoip is enabled")
-	}
-	defer geoip.Close()
-
-	// filtering
-	filtering := NewFilteringProcessor(d.config, d.logger)
-
-	// user privacy
-	ipPrivacy := NewIpAnonymizerSubprocessor(d.config)
-	qnamePrivacy := NewQnameReducerSubprocessor(d.config)
+	// transforms applied on all dns messages
+	transforms := NewTransforms(d.config, d.logger)
+	defer transforms.Reset()
 
 	// read incoming dns message
 	d.LogInfo("running... waiting incoming dns message")
@@ -148,21 +141,33 @@ func (d *DnsProcessor) Run(sendTo []chan dnsutils.DnsMessage) {
 		if dnsHeader.Ad == 1 {
 			dm.DNS.Flags.AD = true
 		}
+		if dnsHeader.Rd == 1 {
+			dm.DNS.Flags.RD = true
+		}
+		if dnsHeader.Cd == 1 {
+			dm.DNS.Flags.CD = true
+		}
 
-		// continue to decode the dns payload to extract the qname and rrtype
+		// keep the number of records announced in the header
+		dm.DNS.Counts.Qdcount = dnsHeader.Qdcount
+		dm.DNS.Counts.Ancount = dnsHeader.Ancount
+		dm.DNS.Counts.Nscount = dnsHeader.Nscount
+		dm.DNS.Counts.Arcount = dnsHeader.Arcount
+
+		// continue to decode the dns payload to extract the questions, the qname and
+		// rrtype are the ones of the first question
 		var dns_offsetrr int
 		if dnsHeader.Qdcount > 0 && dm.DNS.MalformedPacket == 0 {
-			dns_qname, dns_rrtype, offsetrr, err := dnsutils.DecodeQuestion(dm.DNS.Payload)
+			var offsetrr int
+			dm.DNS.Questions, offsetrr, err = dnsutils.DecodeQuestions(dnsHeader.Qdcount, dm.DNS.Payload)
 			if err != nil {
 				dm.DNS.MalformedPacket = 1
 				d.LogError("dns parser malformed question: %s - %v+", err, dm)
 			}
-			if d.config.Subprocessors.QnameLowerCase {
-				dm.DNS.Qname = strings.ToLower(dns_qname)
-			} else {
-				dm.DNS.Qname = dns_qname
+			if len(dm.DNS.Questions) > 0 {
+				dm.DNS.Qname = dm.DNS.Questions[0].Qname
+				dm.DNS.Qtype = dm.DNS.Questions[0].Qtype
 			}
-			dm.DNS.Qtype = dnsutils.RdatatypeToString(dns_rrtype)
 			dns_offsetrr = offsetrr
 		}
 
@@ -208,6 +213,9 @@ func (d *DnsProcessor) Run(sendTo []chan dnsutils.DnsMessage) {
 		}
 
 		if dm.DNS.MalformedPacket == 1 {
+			if d.malformed != nil {
+				d.malformed.Inc()
+			}
 			if d.config.Trace.LogMalformed {
 				d.LogInfo("payload: %v", dm.DNS.Payload)
 			}
@@ -237,34 +245,11 @@ func (d *DnsProcessor) Run(sendTo []chan dnsutils.DnsMessage) {
 		// convert latency to human
 		dm.DnsTap.LatencySec = fmt.Sprintf("%.6f", dm.DnsTap.Latency)
 
-		// qname privacy
-		if qnamePrivacy.IsEnabled() {
-			dm.DNS.Qname = qnamePrivacy.Minimaze(dm.DNS.Qname)
-		}
-
-		// filtering
-		if filtering.CheckIfDrop(&dm) {
+		// apply all transforms, the message can be dropped
+		if transforms.ProcessMessage(&dm) {
 			continue
 		}
 
-		// geoip feature ?
-		if geoip.IsEnabled() {
-			geoInfo, err := geoip.Lookup(dm.NetworkInfo.QueryIp)
-			if err != nil {
-				d.LogError("geoip loopkup failed: %v+", err)
-			}
-			dm.Geo.Continent = geoInfo.Continent
-			dm.Geo.CountryIsoCode = geoInfo.CountryISOCode
-			dm.Geo.City = geoInfo.City
-			dm.NetworkInfo.AutonomousSystemNumber = geoInfo.ASN
-			dm.NetworkInfo.AutonomousSystemOrg = geoInfo.ASO
-		}
-
-		// ip anonymisation ?
-		if ipPrivacy.IsEnabled() {
-			dm.NetworkInfo.QueryIp = ipPrivacy.Anonymize(dm.NetworkInfo.QueryIp)
-		}
-
 		// dispatch dns message to all generators
 		for i := range sendTo {
 			sendTo[i] <- dm
@@ -73,19 +73,24 @@ func GetFakeDnstap(dnsquery []byte) *dnstap.Dnstap {
 }
 
 type DnstapProcessor struct {
-	done     chan bool
-	recvFrom chan []byte
-	logger   *logger.Logger
-	config   *dnsutils.Config
+	done         chan bool
+	recvFrom     chan []byte
+	logger       *logger.Logger
+	config       *dnsutils.Config
+	frames       *dnsutils.TelemetryValue
+	decodeErrors *dnsutils.TelemetryValue
+	malformed    *dnsutils.TelemetryValue
 }
 
 func NewDnstapProcessor(config *dnsutils.Config, logger *logger.Logger) DnstapProcessor {
 	logger.Info("dnstap processor - initialization...")
 	d := DnstapProcessor{
-		done:     make(chan bool),
-		recvFrom: make(chan []byte, 512),
-		logger:   logger,
-		config:   config,
+		done:         make(chan bool),
+		recvFrom:     make(chan []byte, 512),
+		logger:       logger,
+		config:       config,
+		decodeErrors: dnsutils.Telemetry.Get(dnsutils.MetricDecodeErrors, "dnstap"),
+		malformed:    dnsutils.Telemetry.Get(dnsutils.MetricMalformedPackets, "dnstap"),
 	}
 
 	d.ReadConfig()
@@ -93,6 +98,17 @@ func NewDnstapProcessor(config *dnsutils.Config, logger *logger.Logger) DnstapPr
 	return d
 }
 
+// SetCollector identifies the collector in the internal metrics
+func (d *DnstapProcessor) SetCollector(name string) {
+	d.decodeErrors = dnsutils.Telemetry.Get(dnsutils.MetricDecodeErrors, name)
+	d.malformed = dnsutils.Telemetry.Get(dnsutils.MetricMalformedPackets, name)
+}
+
+// SetConnection identifies the connection of the collector in the frames received metric
+func (d *DnstapProcessor) SetConnection(name string, connection string) {
+	d.frames = dnsutils.Telemetry.Get(dnsutils.MetricFramesReceived, name, connection)
+}
+
 func (d *DnstapProcessor) ReadConfig() {
 	// todo - checking settings
 }
@@ -123,29 +139,20 @@ func (d *DnstapProcessor) Run(sendTo []chan dnsutils.DnsMessage) {
 	// dns cache to compute latency between response and query
 	cache_ttl := NewCacheDnsProcessor(time.Duration(d.config.Subprocessors.Cache.QueryTimeout) * time.Second)
 
-	// geoip
-	geoip := NewDnsGeoIpProcessor(d.config, d.logger)
-	if err := geoip.Open(); err != nil {
-		d.LogError("geoip init failed: %v+", err)
-	}
-	if geoip.IsEnabled() {
-		d.LogInfo("geoip is enabled")
-	}
-	defer geoip.Close()
-
-	// filtering
-	filtering := NewFilteringProcessor(d.config, d.logger)
-
-	// user privacy
-	ipPrivacy := NewIpAnonymizerSubprocessor(d.config)
-	qnamePrivacy := NewQnameReducerSubprocessor(d.config)
+	// transforms applied on all dns messages
+	transforms := NewTransforms(d.config, d.logger)
+	defer transforms.Reset()
 
 	// read incoming dns message
 	d.LogInfo("running... waiting incoming dns message")
 	for data := range d.recvFrom {
+		if d.frames != nil {
+			d.frames.Inc()
+		}
 
 		err := proto.Unmarshal(data, dt)
 		if err != nil {
+			d.decodeErrors.Inc()
 			continue
 		}
 
@@ -241,22 +248,34 @@ func (d *DnstapProcessor) Run(sendTo []chan dnsutils.DnsMessage) {
 		if dnsHeader.Ad == 1 {
 			dm.DNS.Flags.AD = true
 		}
+		if dnsHeader.Rd == 1 {
+			dm.DNS.Flags.RD = true
+		}
+		if dnsHeader.Cd == 1 {
+			dm.DNS.Flags.CD = true
+		}
+
+		// keep the number of records announced in the header
+		dm.DNS.Counts.Qdcount = dnsHeader.Qdcount
+		dm.DNS.Counts.Ancount = dnsHeader.Ancount
+		dm.DNS.Counts.Nscount = dnsHeader.Nscount
+		dm.DNS.Counts.Arcount = dnsHeader.Arcount
 
-		// continue to decode the dns payload to extract the qname and rrtype
+		// continue to decode the dns payload to extract the questions, the qname and
+		// rrtype are the ones of the first question
 		var dns_offsetrr int
 		if dnsHeader.Qdcount > 0 && dm.DNS.MalformedPacket == 0 {
-			dns_qname, dns_rrtype, offsetrr, err := dnsutils.DecodeQuestion(dm.DNS.Payload)
+			var offsetrr int
+			dm.DNS.Questions, offsetrr, err = dnsutils.DecodeQuestions(dnsHeader.Qdcount, dm.DNS.Payload)
 			if err != nil {
 				dm.DNS.MalformedPacket = 1
 				d.LogError("dns parser malformed question: %s", err)
 				//continue
 			}
-			if d.config.Subprocessors.QnameLowerCase {
-				dm.DNS.Qname = strings.ToLower(dns_qname)
-			} else {
-				dm.DNS.Qname = dns_qname
+			if len(dm.DNS.Questions) > 0 {
+				dm.DNS.Qname = dm.DNS.Questions[0].Qname
+				dm.DNS.Qtype = dm.DNS.Questions[0].Qtype
 			}
-			dm.DNS.Qtype = dnsutils.RdatatypeToString(dns_rrtype)
 			dns_offsetrr = offsetrr
 		}
 
@@ -301,6 +320,7 @@ func (d *DnstapProcessor) Run(sendTo []chan dnsutils.DnsMessage) {
 		}
 
 		if dm.DNS.MalformedPacket == 1 {
+			d.malformed.Inc()
 			if d.config.Trace.LogMalformed {
 				d.LogInfo("payload: %v", dm.DNS.Payload)
 			}
@@ -329,46 +349,11 @@ func (d *DnstapProcessor) Run(sendTo []chan dnsutils.DnsMessage) {
 		// convert latency to human
 		dm.DnsTap.LatencySec = fmt.Sprintf("%.6f", dm.DnsTap.Latency)
 
-		// qname privacy
-		if qnamePrivacy.IsEnabled() {
-			dm.DNS.Qname = qnamePrivacy.Minimaze(dm.DNS.Qname)
-		}
-
-		// filtering
-		if filtering.CheckIfDrop(&dm) {
+		// apply all transforms, the message can be dropped
+		if transforms.ProcessMessage(&dm) {
 			continue
 		}
 
-		// geoip feature
-		if geoip.IsEnabled() {
-			geoInfo, err := geoip.Lookup(dm.NetworkInfo.QueryIp)
-			if err != nil {
-				d.LogError("geoip loopkup failed: %v+", err)
-			}
-			dm.Geo.Continent = geoInfo.Continent
-			dm.Geo.CountryIsoCode = geoInfo.CountryISOCode
-			dm.Geo.City = geoInfo.City
-			dm.NetworkInfo.AutonomousSystemNumber = geoInfo.ASN
-			dm.NetworkInfo.AutonomousSystemOrg = geoInfo.ASO
-		}
-
-		// ip anonymisation ?
-		if ipPrivacy.IsEnabled() {
-			dm.NetworkInfo.QueryIp = ipPrivacy.Anonymize(dm.NetworkInfo.QueryIp)
-		}
-
-		// quiet text for dnstap operation ?
-		if d.config.Subprocessors.QuietText.Dnstap {
-			if v, found := DnstapMessage[dm.DnsTap.Operation]; found {
-				dm.DnsTap.Operation = v
-			}
-		}
-		if d.config.Subprocessors.QuietText.Dns {
-			if v, found := DnsQr[dm.DNS.Type]; found {
-				dm.DNS.Type = v
-			}
-		}
-
 		// dispatch dns message to all generators
 		for i := range sendTo {
 			sendTo[i] <- dm
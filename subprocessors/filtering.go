@@ -23,6 +23,7 @@ func NewFilteringProcessor(config *dnsutils.Config, logger *logger.Logger) Filte
 	d := FilteringProcessor{
 		config:           config,
 		logger:           logger,
+		listQueryIp:      make(map[string]bool),
 		listFqdns:        make(map[string]bool),
 		listDomainsRegex: make(map[string]*regexp.Regexp),
 	}
@@ -94,6 +95,14 @@ func (p *FilteringProcessor) LogError(msg string, v ...interface{}) {
 	p.logger.Error("filtering - "+msg, v...)
 }
 
+func (p *FilteringProcessor) IsEnabled() bool {
+	return true
+}
+
+func (p *FilteringProcessor) Process(dm *dnsutils.DnsMessage) bool {
+	return p.CheckIfDrop(dm)
+}
+
 func (p *FilteringProcessor) CheckIfDrop(dm *dnsutils.DnsMessage) bool {
 	// ignore queries ?
 	if !p.config.Subprocessors.Filtering.LogQueries && dm.DNS.Type == dnsutils.DnsQuery {
@@ -121,17 +130,13 @@ func (p *FilteringProcessor) CheckIfDrop(dm *dnsutils.DnsMessage) bool {
 		}
 	}
 
-	// drop domains ?
+	// drop domains ? all the questions are checked
 	if p.dropDomains {
-		// fqdn
-		for k := range p.listFqdns {
-			if dm.DNS.Qname == k {
-				return true
-			}
+		if p.isDropDomain(dm.DNS.Qname) {
+			return true
 		}
-		// partiel fqdn with regexp
-		for _, p := range p.listDomainsRegex {
-			if p.MatchString(dm.DNS.Qname) {
+		for _, q := range dm.DNS.Questions {
+			if p.isDropDomain(q.Qname) {
 				return true
 			}
 		}
@@ -139,3 +144,19 @@ func (p *FilteringProcessor) CheckIfDrop(dm *dnsutils.DnsMessage) bool {
 
 	return false
 }
+
+func (p *FilteringProcessor) isDropDomain(qname string) bool {
+	// fqdn
+	for k := range p.listFqdns {
+		if qname == k {
+			return true
+		}
+	}
+	// partiel fqdn with regexp
+	for _, p := range p.listDomainsRegex {
+		if p.MatchString(qname) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package subprocessors
 
 import (
+	"os"
 	"testing"
 
 	"github.com/dmachard/go-dnscollector/dnsutils"
@@ -55,3 +56,30 @@ func TestFilteringByRcodeEmpty(t *testing.T) {
 		t.Errorf("dns query should not be dropped!")
 	}
 }
+
+func TestFilteringByFqdnQuestions(t *testing.T) {
+	// config
+	f, err := os.CreateTemp("", "filtering")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("mail.dns.collector\n")
+	f.Close()
+
+	config := dnsutils.GetFakeConfig()
+	config.Subprocessors.Filtering.DropFqdnFile = f.Name()
+
+	// init subproccesor
+	filtering := NewFilteringProcessor(config, logger.New(false))
+
+	// the fqdn is in the second question
+	dm := dnsutils.GetFakeDnsMessage()
+	dm.DNS.Questions = []dnsutils.DnsQuestion{
+		{Qname: dm.DNS.Qname, Qtype: "A"},
+		{Qname: "mail.dns.collector", Qtype: "A"},
+	}
+	if !filtering.CheckIfDrop(&dm) {
+		t.Errorf("dns query should be dropped")
+	}
+}
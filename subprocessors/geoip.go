@@ -145,3 +145,16 @@ func (p *GeoIpProcessor) Lookup(ip string) (GeoRecord, error) {
 
 	return rec, nil
 }
+
+func (p *GeoIpProcessor) Process(dm *dnsutils.DnsMessage) bool {
+	geoInfo, err := p.Lookup(dm.NetworkInfo.QueryIp)
+	if err != nil {
+		p.LogError("geoip loopkup failed: %v+", err)
+	}
+	dm.Geo.Continent = geoInfo.Continent
+	dm.Geo.CountryIsoCode = geoInfo.CountryISOCode
+	dm.Geo.City = geoInfo.City
+	dm.NetworkInfo.AutonomousSystemNumber = geoInfo.ASN
+	dm.NetworkInfo.AutonomousSystemOrg = geoInfo.ASO
+	return false
+}
@@ -52,3 +52,8 @@ func (s *IpAnonymizerSubproc) Anonymize(ip string) string {
 	// ipv6, /64 mask
 	return ipaddr.Mask(s.v6Mask).String()
 }
+
+func (s *IpAnonymizerSubproc) Process(dm *dnsutils.DnsMessage) bool {
+	dm.NetworkInfo.QueryIp = s.Anonymize(dm.NetworkInfo.QueryIp)
+	return false
+}
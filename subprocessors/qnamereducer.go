@@ -41,3 +41,8 @@ func (s *QnameReducer) Minimaze(qname string) string {
 	}
 	return qname[j+1:]
 }
+
+func (s *QnameReducer) Process(dm *dnsutils.DnsMessage) bool {
+	updateQnames(dm, s.Minimaze)
+	return false
+}
@@ -329,6 +329,18 @@ func (c *StatsStreams) GetTopIpProto(identity string) (ret []topmap.TopMapItem)
 	return v.GetTopIpProto()
 }
 
+func (c *StatsStreams) GetTopEdnsOptions(identity string) (ret []topmap.TopMapItem) {
+	c.RLock()
+	defer c.RUnlock()
+
+	v, found := c.streams[identity]
+	if !found {
+		return []topmap.TopMapItem{}
+	}
+
+	return v.GetTopEdnsOptions()
+}
+
 func (c *StatsStreams) GetClients(identity string) (ret map[string]int) {
 	c.RLock()
 	defer c.RUnlock()
@@ -423,6 +435,8 @@ func (s *StatsStreams) GetMetrics(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "# TYPE %s_transports_total counter\n", prefix)
 	fmt.Fprintf(w, "# HELP %s_ipproto_total Number of packets, partitioned by IP protocol\n", prefix)
 	fmt.Fprintf(w, "# TYPE %s_ipproto_total counter\n", prefix)
+	fmt.Fprintf(w, "# HELP %s_edns_options_total Number of edns options, partitioned by option\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_edns_options_total counter\n", prefix)
 	fmt.Fprintf(w, "# HELP %s_qtypes_total Number of qtypes, partitioned by qtype\n", prefix)
 	fmt.Fprintf(w, "# TYPE %s_qtypes_total counter\n", prefix)
 	fmt.Fprintf(w, "# HELP %s_rcodes_total Number of rcodes, partitioned by rcode type\n", prefix)
@@ -549,6 +563,11 @@ func (s *StatsStreams) GetMetrics(w http.ResponseWriter, r *http.Request) {
 			fmt.Fprintf(w, "%s_ipproto_total{stream=\"%s\",ip=\"%s\"} %d\n", prefix, stream, v.Name, v.Hit)
 		}
 
+		// edns options repartition
+		for _, v := range s.GetTopEdnsOptions(stream) {
+			fmt.Fprintf(w, "%s_edns_options_total{stream=\"%s\",option=\"%s\"} %d\n", prefix, stream, v.Name, v.Hit)
+		}
+
 		// qtypes repartition
 		for _, v := range s.GetTopRrtypes(stream) {
 			fmt.Fprintf(w, "%s_qtypes_total{stream=\"%s\",qtype=\"%s\"} %d\n", prefix, stream, v.Name, v.Hit)
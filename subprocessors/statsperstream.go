@@ -106,6 +106,9 @@ type StatsPerStream struct {
 	ipproto    map[string]int
 	ipprototop *topmap.TopMap
 
+	ednsoptions    map[string]int
+	ednsoptionstop *topmap.TopMap
+
 	MapHitAS  map[string]int
 	MapAS     map[string]string
 	ListTopAS *topmap.TopMap
@@ -161,6 +164,9 @@ func NewStatsPerStream(config *dnsutils.Config, name string) *StatsPerStream {
 		ipproto:    make(map[string]int),
 		ipprototop: topmap.NewTopMap(config.Subprocessors.Statistics.TopMaxItems),
 
+		ednsoptions:    make(map[string]int),
+		ednsoptionstop: topmap.NewTopMap(config.Subprocessors.Statistics.TopMaxItems),
+
 		commonQtypes: make(map[string]bool),
 	}
 
@@ -455,6 +461,16 @@ func (c *StatsPerStream) Record(dm dnsutils.DnsMessage) {
 	}
 	c.operationstop.Record(dm.DnsTap.Operation, c.operations[dm.DnsTap.Operation])
 
+	// record edns options
+	for _, opt := range dm.EDNS.Options {
+		if _, ok := c.ednsoptions[opt.Name]; !ok {
+			c.ednsoptions[opt.Name] = 1
+		} else {
+			c.ednsoptions[opt.Name]++
+		}
+		c.ednsoptionstop.Record(opt.Name, c.ednsoptions[opt.Name])
+	}
+
 	// dns flags
 	if dm.DNS.Flags.TC {
 		c.total.Truncated++
@@ -597,6 +613,9 @@ func (c *StatsPerStream) Reset() {
 	c.ipproto = make(map[string]int)
 	c.ipprototop = topmap.NewTopMap(c.config.Subprocessors.Statistics.TopMaxItems)
 
+	c.ednsoptions = make(map[string]int)
+	c.ednsoptionstop = topmap.NewTopMap(c.config.Subprocessors.Statistics.TopMaxItems)
+
 	c.MapHitAS = make(map[string]int)
 	c.MapAS = make(map[string]string)
 	c.ListTopAS = topmap.NewTopMap(c.config.Subprocessors.Statistics.TopMaxItems)
@@ -756,6 +775,13 @@ func (c *StatsPerStream) GetTopIpProto() (ret []topmap.TopMapItem) {
 	return c.ipprototop.Get()
 }
 
+func (c *StatsPerStream) GetTopEdnsOptions() (ret []topmap.TopMapItem) {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.ednsoptionstop.Get()
+}
+
 func (c *StatsPerStream) GetClients() (ret map[string]int) {
 	c.RLock()
 	defer c.RUnlock()
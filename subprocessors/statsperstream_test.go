@@ -24,3 +24,26 @@ func TestDnsStatisticsRecord(t *testing.T) {
 		t.Errorf("invalid number of domains, expected 1, got %d", nb)
 	}
 }
+
+func TestDnsStatisticsEdnsOptions(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+	stats := NewStatsPerStream(config, "test")
+
+	dm := dnsutils.DnsMessage{}
+	dm.Init()
+	dm.DNS.Type = dnsutils.DnsQuery
+	dm.DNS.Qname = "dnscollector.test."
+	dm.EDNS.Options = []dnsutils.DnsOption{{Code: 10, Name: "COOKIE"}, {Code: 3, Name: "NSID"}}
+	stats.Record(dm)
+
+	dm.EDNS.Options = []dnsutils.DnsOption{{Code: 10, Name: "COOKIE"}}
+	stats.Record(dm)
+
+	hits := map[string]int{}
+	for _, v := range stats.GetTopEdnsOptions() {
+		hits[v.Name] = v.Hit
+	}
+	if hits["COOKIE"] != 2 || hits["NSID"] != 1 {
+		t.Errorf("invalid edns options statistics: %v", hits)
+	}
+}
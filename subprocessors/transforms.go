@@ -0,0 +1,176 @@
+package subprocessors
+
+import (
+	"strings"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-logger"
+)
+
+// Transformer is implemented by all subprocessors which can update or drop a dns message
+type Transformer interface {
+	// IsEnabled returns true if the transformer must be added to the chain
+	IsEnabled() bool
+	// Process updates the dns message and returns true if the message must be dropped
+	Process(dm *dnsutils.DnsMessage) bool
+}
+
+type QnameLowercase struct {
+	config *dnsutils.Config
+}
+
+func NewQnameLowercaseSubprocessor(config *dnsutils.Config) QnameLowercase {
+	return QnameLowercase{config: config}
+}
+
+func (s *QnameLowercase) IsEnabled() bool {
+	return s.config.Subprocessors.QnameLowerCase
+}
+
+func (s *QnameLowercase) Process(dm *dnsutils.DnsMessage) bool {
+	updateQnames(dm, strings.ToLower)
+	return false
+}
+
+// updateQnames applies the update on the qname and on all the questions, the questions are
+// copied before because the slice is shared by the dns messages sent to the other loggers
+func updateQnames(dm *dnsutils.DnsMessage, update func(string) string) {
+	dm.DNS.Qname = update(dm.DNS.Qname)
+	if len(dm.DNS.Questions) == 0 {
+		return
+	}
+	qs := make([]dnsutils.DnsQuestion, len(dm.DNS.Questions))
+	copy(qs, dm.DNS.Questions)
+	for i := range qs {
+		qs[i].Qname = update(qs[i].Qname)
+	}
+	dm.DNS.Questions = qs
+}
+
+type QuietText struct {
+	config *dnsutils.Config
+}
+
+func NewQuietTextSubprocessor(config *dnsutils.Config) QuietText {
+	return QuietText{config: config}
+}
+
+func (s *QuietText) IsEnabled() bool {
+	return s.config.Subprocessors.QuietText.Dnstap || s.config.Subprocessors.QuietText.Dns
+}
+
+func (s *QuietText) Process(dm *dnsutils.DnsMessage) bool {
+	if s.config.Subprocessors.QuietText.Dnstap {
+		if v, found := DnstapMessage[dm.DnsTap.Operation]; found {
+			dm.DnsTap.Operation = v
+		}
+	}
+	if s.config.Subprocessors.QuietText.Dns {
+		if v, found := DnsQr[dm.DNS.Type]; found {
+			dm.DNS.Type = v
+		}
+	}
+	return false
+}
+
+type Transforms struct {
+	config  *dnsutils.Config
+	initial *dnsutils.Config
+	logger  *logger.Logger
+	geoip   *GeoIpProcessor
+	chain   []Transformer
+}
+
+// NewTransforms creates the chain with the last configuration reloaded from the initial one
+func NewTransforms(config *dnsutils.Config, logger *logger.Logger) Transforms {
+	d := Transforms{
+		config:  config.GetTransformsConfig(),
+		initial: config,
+		logger:  logger,
+	}
+
+	d.Prepare()
+
+	return d
+}
+
+func (p *Transforms) LogInfo(msg string, v ...interface{}) {
+	p.logger.Info("transforms - "+msg, v...)
+}
+
+func (p *Transforms) LogError(msg string, v ...interface{}) {
+	p.logger.Error("transforms - "+msg, v...)
+}
+
+// Prepare builds the chain of enabled transformers in the order of the configuration
+func (p *Transforms) Prepare() {
+	p.chain = []Transformer{}
+
+	for _, name := range p.config.Subprocessors.Transforms {
+		var t Transformer
+		switch name {
+		case "qname-lowercase":
+			s := NewQnameLowercaseSubprocessor(p.config)
+			t = &s
+		case "minimaze-qname":
+			s := NewQnameReducerSubprocessor(p.config)
+			t = &s
+		case "filtering":
+			s := NewFilteringProcessor(p.config, p.logger)
+			t = &s
+		case "geoip":
+			s := NewDnsGeoIpProcessor(p.config, p.logger)
+			if err := s.Open(); err != nil {
+				p.LogError("geoip init failed: %v+", err)
+			}
+			if s.IsEnabled() {
+				p.LogInfo("geoip is enabled")
+			}
+			p.geoip = &s
+			t = &s
+		case "anonymize-ip":
+			s := NewIpAnonymizerSubprocessor(p.config)
+			t = &s
+		case "quiet-text":
+			s := NewQuietTextSubprocessor(p.config)
+			t = &s
+		default:
+			p.LogError("unknown transform ignored: %s", name)
+			continue
+		}
+
+		if t.IsEnabled() {
+			p.chain = append(p.chain, t)
+		}
+	}
+}
+
+// Reload rebuilds the chain with the new configuration
+func (p *Transforms) Reload(config *dnsutils.Config) {
+	p.config = config
+
+	p.LogInfo("reloading...")
+	p.Reset()
+	p.geoip = nil
+	p.Prepare()
+}
+
+// ProcessMessage applies all transformers on the dns message and
+// returns true if the message must be dropped
+func (p *Transforms) ProcessMessage(dm *dnsutils.DnsMessage) bool {
+	if config := p.initial.GetTransformsConfig(); config != p.config {
+		p.Reload(config)
+	}
+	for _, t := range p.chain {
+		if t.Process(dm) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Transforms) Reset() {
+	if p.geoip != nil {
+		p.geoip.Close()
+	}
+}
@@ -0,0 +1,169 @@
+package subprocessors
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/dmachard/go-dnscollector/dnsutils"
+	"github.com/dmachard/go-logger"
+)
+
+func TestTransformsDefaultChain(t *testing.T) {
+	// enable some features
+	config := dnsutils.GetFakeConfig()
+	config.Subprocessors.UserPrivacy.AnonymizeIP = true
+	config.Subprocessors.UserPrivacy.MinimazeQname = true
+	config.Subprocessors.QuietText.Dnstap = true
+
+	transforms := NewTransforms(config, logger.New(false))
+	defer transforms.Reset()
+
+	dm := dnsutils.GetFakeDnsMessage()
+	dm.DNS.Qname = "WWW.Dns.Collector"
+	if transforms.ProcessMessage(&dm) {
+		t.Fatalf("dns message should not be dropped")
+	}
+
+	if dm.DNS.Qname != "dns.collector" {
+		t.Errorf("invalid qname: %s", dm.DNS.Qname)
+	}
+	if dm.NetworkInfo.QueryIp != "1.2.0.0" {
+		t.Errorf("invalid query ip: %s", dm.NetworkInfo.QueryIp)
+	}
+	if dm.DnsTap.Operation != "CQ" {
+		t.Errorf("invalid operation: %s", dm.DnsTap.Operation)
+	}
+}
+
+func TestTransformsQuestions(t *testing.T) {
+	// the qname transforms are applied on all the questions
+	config := dnsutils.GetFakeConfig()
+	config.Subprocessors.UserPrivacy.MinimazeQname = true
+
+	transforms := NewTransforms(config, logger.New(false))
+	dm := dnsutils.GetFakeDnsMessage()
+	dm.DNS.Qname = "WWW.Dns.Collector"
+	dm.DNS.Questions = []dnsutils.DnsQuestion{
+		{Qname: "WWW.Dns.Collector", Qtype: "A"},
+		{Qname: "Mail.Dns.Collector", Qtype: "AAAA"},
+	}
+	if transforms.ProcessMessage(&dm) {
+		t.Fatalf("dns message should not be dropped")
+	}
+	for _, q := range dm.DNS.Questions {
+		if q.Qname != "dns.collector" {
+			t.Errorf("invalid qname in questions: %s", q.Qname)
+		}
+	}
+}
+
+func TestTransformsQuestionsFanout(t *testing.T) {
+	dm := dnsutils.GetFakeDnsMessage()
+	dm.DNS.Questions = []dnsutils.DnsQuestion{{Qname: "WWW.Dns.Collector", Qtype: "A"}}
+
+	// the copies sent to the loggers share the questions
+	lowercase := dm
+	reduced := dm
+	untransformed := dm
+
+	config := dnsutils.GetFakeConfig()
+	config.Subprocessors.Transforms = []string{"qname-lowercase"}
+	configReducer := dnsutils.GetFakeConfig()
+	configReducer.Subprocessors.UserPrivacy.MinimazeQname = true
+	configReducer.Subprocessors.QnameLowerCase = false
+	configReducer.Subprocessors.Transforms = []string{"minimaze-qname"}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		transforms := NewTransforms(config, logger.New(false))
+		transforms.ProcessMessage(&lowercase)
+	}()
+	go func() {
+		defer wg.Done()
+		transforms := NewTransforms(configReducer, logger.New(false))
+		transforms.ProcessMessage(&reduced)
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = untransformed.DNS.Questions[0].Qname
+		}
+	}()
+	wg.Wait()
+
+	if qname := lowercase.DNS.Questions[0].Qname; qname != "www.dns.collector" {
+		t.Errorf("invalid lowercase qname: %s", qname)
+	}
+	if qname := reduced.DNS.Questions[0].Qname; qname != "Dns.Collector" {
+		t.Errorf("invalid reduced qname: %s", qname)
+	}
+	if qname := untransformed.DNS.Questions[0].Qname; qname != "WWW.Dns.Collector" {
+		t.Errorf("the qname of the other copies should not be updated: %s", qname)
+	}
+}
+
+func TestTransformsOrder(t *testing.T) {
+	// quiet text before filtering, the query is not detected anymore
+	config := dnsutils.GetFakeConfig()
+	config.Subprocessors.QuietText.Dns = true
+	config.Subprocessors.Filtering.LogQueries = false
+	config.Subprocessors.Transforms = []string{"quiet-text", "filtering"}
+
+	transforms := NewTransforms(config, logger.New(false))
+	dm := dnsutils.GetFakeDnsMessage()
+	if transforms.ProcessMessage(&dm) {
+		t.Errorf("dns query should not be dropped")
+	}
+
+	// default order, the query is dropped
+	config.Subprocessors.Transforms = []string{"filtering", "quiet-text"}
+	transforms = NewTransforms(config, logger.New(false))
+	dm = dnsutils.GetFakeDnsMessage()
+	if !transforms.ProcessMessage(&dm) {
+		t.Errorf("dns query should be dropped")
+	}
+}
+
+func TestTransformsDisabled(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+	config.Subprocessors.Transforms = []string{}
+
+	transforms := NewTransforms(config, logger.New(false))
+	dm := dnsutils.GetFakeDnsMessage()
+	dm.DNS.Qname = "DNS.Collector"
+	if transforms.ProcessMessage(&dm) {
+		t.Fatalf("dns message should not be dropped")
+	}
+	if dm.DNS.Qname != "DNS.Collector" {
+		t.Errorf("qname should not be updated: %s", dm.DNS.Qname)
+	}
+}
+
+func TestTransformsReload(t *testing.T) {
+	config := dnsutils.GetFakeConfig()
+	transforms := NewTransforms(config, logger.New(false))
+
+	dm := dnsutils.GetFakeDnsMessage()
+	if transforms.ProcessMessage(&dm) {
+		t.Fatalf("dns query should not be dropped")
+	}
+
+	// drop the queries with the new configuration, the chain is rebuilt in place
+	newconfig := dnsutils.GetFakeConfig()
+	newconfig.Subprocessors.Filtering.LogQueries = false
+	config.ReloadTransforms(newconfig)
+
+	dm = dnsutils.GetFakeDnsMessage()
+	if !transforms.ProcessMessage(&dm) {
+		t.Errorf("dns query should be dropped after reload")
+	}
+
+	// new transforms created with the initial configuration use the reloaded one
+	transforms = NewTransforms(config, logger.New(false))
+	dm = dnsutils.GetFakeDnsMessage()
+	if !transforms.ProcessMessage(&dm) {
+		t.Errorf("dns query should be dropped")
+	}
+}